@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 	"web-crawler/config"
 	"web-crawler/internal/api"
+	"web-crawler/internal/auth"
 	"web-crawler/internal/db"
+	"web-crawler/internal/events"
+	"web-crawler/internal/mail"
 	"web-crawler/internal/middleware"
 	"web-crawler/internal/queue"
+	"web-crawler/internal/scheduler"
+	"web-crawler/internal/webhook"
 	"web-crawler/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -28,17 +38,43 @@ func main() {
 	}
 	defer database.Close()
 
+	// Give the configured admins the admin role
+	cfg := config.Load()
+	if err := db.NewUserRepository(database).PromoteToAdmin(context.Background(), cfg.Admin.Usernames); err != nil {
+		log.Fatal("Failed to promote admins:", err)
+	}
+
 	// Initialize repositories
 	taskRepo := db.NewTaskRepository(database)
 	resultRepo := db.NewResultRepository(database)
 	linkRepo := db.NewLinkRepository(database)
+	eventRepo := db.NewEventRepository(database)
+	scheduleRepo := db.NewScheduleRepository(database)
+	webhookRepo := db.NewWebhookRepository(database)
+	deliveryRepo := db.NewDeliveryRepository(database)
+	workspaceRepo := db.NewWorkspaceRepository(database)
+
+	// Initialize the mailer used by the account emails
+	mailer, err := mail.NewMailer()
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+
+	// Initialize the event bus shared by the WebSocket and Server-Sent Events endpoints
+	bus := events.NewBus(eventRepo, workspaceRepo)
+	go bus.Run()
+
+	// Start the dispatcher that sends task lifecycle events to webhooks
+	hooks := webhook.NewDispatcher(webhookRepo, deliveryRepo)
+	hooks.Start()
 
-	// Initialize WebSocket hub
-	wsHub := websocket.NewHub()
-	go wsHub.Run()
+	// Initialize task queue with dependencies and resume pending tasks
+	taskQueue := queue.NewTaskQueue(taskRepo, resultRepo, linkRepo, bus, hooks)
+	taskQueue.Start()
 
-	// Initialize task queue with dependencies
-	taskQueue := queue.NewTaskQueue(taskRepo, resultRepo, linkRepo, wsHub)
+	// Start the scheduler that queues recurring crawls when they are due
+	crawlScheduler := scheduler.NewScheduler(scheduleRepo, taskQueue)
+	crawlScheduler.Start()
 
 	// Initialize Gin router
 	r := gin.Default()
@@ -55,17 +91,52 @@ func main() {
 	})
 
 	// API routes
-	api.SetupRoutes(r, database, taskQueue, wsHub, linkRepo)
+	api.SetupRoutes(r, database, taskQueue, bus, linkRepo, hooks, mailer)
 
-	// WebSocket endpoint
+	// WebSocket endpoint, authenticated with the same JWT as the API
+	jwtService := auth.NewJWTService(db.NewSessionRepository(database))
 	r.GET("/ws", func(c *gin.Context) {
-		websocket.ServeWS(wsHub, c.Writer, c.Request)
+		websocket.ServeWS(bus, jwtService, c.Writer, c.Request)
 	})
 
 	// Get port from config
-	cfg := config.Load()
 	port := strconv.Itoa(cfg.Server.Port)
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(r.Run(":" + port))
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+	// End long-lived event streams so shutdown does not wait for them
+	srv.RegisterOnShutdown(bus.DisconnectAll)
+
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Server failed:", err)
+		}
+	}()
+
+	// Wait for an interrupt, then stop accepting requests and cancel running crawls
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	if err := crawlScheduler.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Scheduler shutdown error: %v", err)
+	}
+	if err := taskQueue.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Task queue shutdown error: %v", err)
+	}
+	if err := hooks.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Webhook dispatcher shutdown error: %v", err)
+	}
+
+	log.Println("Server stopped")
 }
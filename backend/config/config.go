@@ -3,12 +3,23 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Database DatabaseConfig
-	Server   ServerConfig
-	JWT      JWTConfig
+	Database  DatabaseConfig
+	Server    ServerConfig
+	JWT       JWTConfig
+	Crawler   CrawlerConfig
+	Admin     AdminConfig
+	Queue     QueueConfig
+	Events    EventsConfig
+	Tasks     TasksConfig
+	Scheduler SchedulerConfig
+	Webhooks  WebhooksConfig
+	Mail      MailConfig
+	Account   AccountConfig
 }
 
 type DatabaseConfig struct {
@@ -25,7 +36,75 @@ type ServerConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string
+	Secret          string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type CrawlerConfig struct {
+	LinkCheckWorkers int
+	LinkCheckPerHost int
+	UserAgent        string
+	MaxCrawlDelay    time.Duration
+	TaskTimeout      time.Duration
+}
+
+type QueueConfig struct {
+	Workers              int
+	MaxConcurrentPerUser int
+	MaxQueuedPerUser     int
+	LeaseDuration        time.Duration
+	PollInterval         time.Duration
+	MaxAttempts          int
+}
+
+type EventsConfig struct {
+	LogSize   int
+	Persist   bool
+	Retention time.Duration
+}
+
+type TasksConfig struct {
+	RestoreWindow time.Duration
+}
+
+type SchedulerConfig struct {
+	PollInterval   time.Duration
+	MissedRunGrace time.Duration
+}
+
+type WebhooksConfig struct {
+	Workers             int
+	Timeout             time.Duration
+	MaxAttempts         int
+	RetryBaseDelay      time.Duration
+	RetryMaxDelay       time.Duration
+	PollInterval        time.Duration
+	DeliveryRetention   time.Duration
+	AllowPrivateTargets bool
+}
+
+type MailConfig struct {
+	Driver       string
+	From         string
+	Dir          string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Timeout      time.Duration
+}
+
+type AccountConfig struct {
+	AppURL           string
+	PasswordResetTTL time.Duration
+	VerificationTTL  time.Duration
+	EmailResendWait  time.Duration
+}
+
+type AdminConfig struct {
+	// Usernames are given the admin role at startup
+	Usernames []string
 }
 
 func Load() *Config {
@@ -42,7 +121,65 @@ func Load() *Config {
 			Mode: getEnv("GIN_MODE", "debug"),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
+			Secret:          getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
+			AccessTokenTTL:  time.Duration(getEnvAsInt("JWT_ACCESS_TOKEN_MINUTES", 15)) * time.Minute,
+			RefreshTokenTTL: time.Duration(getEnvAsInt("JWT_REFRESH_TOKEN_DAYS", 30)) * 24 * time.Hour,
+		},
+		Crawler: CrawlerConfig{
+			LinkCheckWorkers: getEnvAsInt("CRAWLER_LINK_CHECK_WORKERS", 20),
+			LinkCheckPerHost: getEnvAsInt("CRAWLER_LINK_CHECK_PER_HOST", 4),
+			UserAgent:        getEnv("CRAWLER_USER_AGENT", "WebCrawlerBot"),
+			MaxCrawlDelay:    time.Duration(getEnvAsInt("CRAWLER_MAX_CRAWL_DELAY_SECONDS", 10)) * time.Second,
+			TaskTimeout:      time.Duration(getEnvAsInt("CRAWLER_TASK_TIMEOUT_MINUTES", 30)) * time.Minute,
+		},
+		Queue: QueueConfig{
+			Workers:              getEnvAsInt("QUEUE_WORKERS", 10),
+			MaxConcurrentPerUser: getEnvAsInt("QUEUE_MAX_CONCURRENT_PER_USER", 3),
+			MaxQueuedPerUser:     getEnvAsInt("QUEUE_MAX_QUEUED_PER_USER", 100),
+			LeaseDuration:        time.Duration(getEnvAsInt("QUEUE_LEASE_SECONDS", 60)) * time.Second,
+			PollInterval:         time.Duration(getEnvAsInt("QUEUE_POLL_SECONDS", 5)) * time.Second,
+			MaxAttempts:          getEnvAsInt("QUEUE_MAX_ATTEMPTS", 3),
+		},
+		Events: EventsConfig{
+			LogSize:   getEnvAsInt("EVENTS_LOG_SIZE", 500),
+			Persist:   getEnvAsBool("EVENTS_PERSIST", false),
+			Retention: time.Duration(getEnvAsInt("EVENTS_RETENTION_HOURS", 24)) * time.Hour,
+		},
+		Tasks: TasksConfig{
+			RestoreWindow: time.Duration(getEnvAsInt("TASK_RESTORE_WINDOW_HOURS", 24)) * time.Hour,
+		},
+		Scheduler: SchedulerConfig{
+			PollInterval:   time.Duration(getEnvAsInt("SCHEDULER_POLL_SECONDS", 30)) * time.Second,
+			MissedRunGrace: time.Duration(getEnvAsInt("SCHEDULER_MISSED_RUN_GRACE_SECONDS", 300)) * time.Second,
+		},
+		Webhooks: WebhooksConfig{
+			Workers:             getEnvAsInt("WEBHOOK_WORKERS", 4),
+			Timeout:             time.Duration(getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+			MaxAttempts:         getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 6),
+			RetryBaseDelay:      time.Duration(getEnvAsInt("WEBHOOK_RETRY_BASE_SECONDS", 30)) * time.Second,
+			RetryMaxDelay:       time.Duration(getEnvAsInt("WEBHOOK_RETRY_MAX_MINUTES", 60)) * time.Minute,
+			PollInterval:        time.Duration(getEnvAsInt("WEBHOOK_POLL_SECONDS", 5)) * time.Second,
+			DeliveryRetention:   time.Duration(getEnvAsInt("WEBHOOK_DELIVERY_RETENTION_DAYS", 30)) * 24 * time.Hour,
+			AllowPrivateTargets: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "Web Crawler <no-reply@localhost>"),
+			Dir:          getEnv("MAIL_DIR", "mail"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			Timeout:      time.Duration(getEnvAsInt("MAIL_TIMEOUT_SECONDS", 30)) * time.Second,
+		},
+		Account: AccountConfig{
+			AppURL:           getEnv("APP_URL", "http://localhost:3000"),
+			PasswordResetTTL: time.Duration(getEnvAsInt("PASSWORD_RESET_TOKEN_MINUTES", 60)) * time.Minute,
+			VerificationTTL:  time.Duration(getEnvAsInt("EMAIL_VERIFICATION_TOKEN_HOURS", 48)) * time.Hour,
+			EmailResendWait:  time.Duration(getEnvAsInt("ACCOUNT_EMAIL_RESEND_SECONDS", 60)) * time.Second,
+		},
+		Admin: AdminConfig{
+			Usernames: getEnvAsList("ADMIN_USERNAMES", nil),
 		},
 	}
 }
@@ -62,3 +199,25 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsList(key string, defaultValue []string) []string {
+	if value := os.Getenv(key); value != "" {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return defaultValue
+}
@@ -0,0 +1,388 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"web-crawler/internal/db"
+	"web-crawler/internal/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles the admin API for managing users and the crawl tasks
+// of every user
+type AdminHandler struct {
+	userRepo    *db.UserRepository
+	taskRepo    *db.TaskRepository
+	sessionRepo *db.SessionRepository
+	taskQueue   *queue.TaskQueue
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(userRepo *db.UserRepository, taskRepo *db.TaskRepository, sessionRepo *db.SessionRepository, taskQueue *queue.TaskQueue) *AdminHandler {
+	return &AdminHandler{
+		userRepo:    userRepo,
+		taskRepo:    taskRepo,
+		sessionRepo: sessionRepo,
+		taskQueue:   taskQueue,
+	}
+}
+
+// UpdateRoleRequest represents the request to change the role of a user
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ListUsers retrieves every user with pagination, optionally searching the
+// username and email with "q" and keeping the users of one "role"
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := db.UserFilter{
+		Query: c.Query("q"),
+		Role:  c.Query("role"),
+	}
+	if filter.Role != "" && !slices.Contains(db.Roles, filter.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown role: " + filter.Role,
+			"roles": db.Roles,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	users, err := h.userRepo.List(ctx, filter, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve users",
+		})
+		return
+	}
+
+	total, err := h.userRepo.Count(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve users",
+		})
+		return
+	}
+
+	if users == nil {
+		users = []*db.User{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// GetUser retrieves a single user
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserRole changes the role of a user and logs them out, so that their
+// next login carries the new role. Admins cannot change their own role, so
+// there is always an admin left.
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if !slices.Contains(db.Roles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown role: " + req.Role,
+			"roles": db.Roles,
+		})
+		return
+	}
+
+	if h.isSelf(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot change your own role",
+		})
+		return
+	}
+
+	if req.Role != user.Role {
+		ctx := c.Request.Context()
+		if err := h.userRepo.UpdateRole(ctx, user.ID, req.Role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update role",
+			})
+			return
+		}
+		if _, err := h.sessionRepo.RevokeByUserID(ctx, user.ID, db.SessionRevokedRole); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update role",
+			})
+			return
+		}
+		user.Role = req.Role
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DisableUser disables the account of a user: they are logged out, their API
+// tokens stop working, their pending and running crawls are cancelled and
+// their schedules stop running
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if h.isSelf(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You cannot disable your own account",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.userRepo.SetDisabled(ctx, user.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to disable user",
+		})
+		return
+	}
+	if _, err := h.sessionRepo.RevokeByUserID(ctx, user.ID, db.SessionRevokedDisabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to disable user",
+		})
+		return
+	}
+
+	taskIDs, err := h.taskRepo.GetActiveIDsByUserID(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to cancel the user's tasks",
+		})
+		return
+	}
+	// Tasks that finished since they were listed are left as they are
+	for _, taskID := range taskIDs {
+		if _, err := h.taskQueue.CancelTask(ctx, taskID); err != nil {
+			log.Printf("Failed to cancel task %d of disabled user %d: %v", taskID, user.ID, err)
+		}
+	}
+
+	h.respondUser(c, user)
+}
+
+// EnableUser re-enables a disabled account
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.SetDisabled(c.Request.Context(), user.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to enable user",
+		})
+		return
+	}
+
+	h.respondUser(c, user)
+}
+
+// ListTasks retrieves the crawl tasks of every user, or of the user given as
+// "user_id" or the workspace given as "workspace_id", with the filter, search
+// and sort parameters of the task list
+func (h *AdminHandler) ListTasks(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter, err := parseTaskFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var ok bool
+	if filter.UserID, ok = idQuery(c, "user_id", "Invalid user ID"); !ok {
+		return
+	}
+	if filter.WorkspaceID, ok = idQuery(c, "workspace_id", "Invalid workspace ID"); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	tasks, err := h.taskRepo.List(ctx, 0, filter, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tasks",
+		})
+		return
+	}
+
+	total, err := h.taskRepo.Count(ctx, 0, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tasks",
+		})
+		return
+	}
+
+	if tasks == nil {
+		tasks = []*db.CrawlTask{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks": tasks,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// CancelTask cancels the pending or running crawl task of any user
+func (h *AdminHandler) CancelTask(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid task ID",
+		})
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve task",
+		})
+		return
+	}
+
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Task not found",
+		})
+		return
+	}
+
+	if !isActive(task.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Task cannot be stopped in current status",
+		})
+		return
+	}
+
+	cancelled, err := h.taskQueue.CancelTask(c.Request.Context(), task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update task status",
+		})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Task cannot be stopped in current status",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Task cancelled successfully",
+	})
+}
+
+// idQuery reads an optional ID query parameter, writing the error response
+// when it is invalid. It returns 0 when the parameter is not set.
+func idQuery(c *gin.Context, param, invalid string) (int, bool) {
+	value := c.Query(param)
+	if value == "" {
+		return 0, true
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": invalid,
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondUser writes a user, reloaded to pick up the changes just saved
+func (h *AdminHandler) respondUser(c *gin.Context, user *db.User) {
+	saved, err := h.userRepo.GetByID(c.Request.Context(), user.ID)
+	if err != nil || saved == nil {
+		saved = user
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// isSelf reports whether user is the authenticated admin
+func (h *AdminHandler) isSelf(c *gin.Context, user *db.User) bool {
+	userID, _ := c.Get("user_id")
+	return userID == user.ID
+}
+
+// loadUser loads the user named by the id parameter, writing the error
+// response when that fails
+func (h *AdminHandler) loadUser(c *gin.Context) (*db.User, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return nil, false
+	}
+
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve user",
+		})
+		return nil, false
+	}
+
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return nil, false
+	}
+
+	return user, true
+}
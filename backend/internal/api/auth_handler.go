@@ -1,25 +1,31 @@
 package api
 
 import (
+	"errors"
+	"io"
+	"log"
 	"net/http"
-	"strconv"
+	"strings"
 	"web-crawler/internal/auth"
 	"web-crawler/internal/db"
+	"web-crawler/internal/mail"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AuthHandler handles authentication-related requests
 type AuthHandler struct {
-	userRepo   *db.UserRepository
-	jwtService *auth.JWTService
+	userRepo *db.UserRepository
+	sessions *auth.SessionService
+	accounts *auth.AccountService
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(userRepo *db.UserRepository) *AuthHandler {
+func NewAuthHandler(userRepo *db.UserRepository, sessionRepo *db.SessionRepository, userTokenRepo *db.UserTokenRepository, mailer mail.Mailer) *AuthHandler {
 	return &AuthHandler{
-		userRepo:   userRepo,
-		jwtService: auth.NewJWTService(),
+		userRepo: userRepo,
+		sessions: auth.NewSessionService(sessionRepo, userRepo),
+		accounts: auth.NewAccountService(userRepo, userTokenRepo, sessionRepo, mailer),
 	}
 }
 
@@ -33,20 +39,63 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required,min=6,max=72"`
+}
+
+// RefreshTokenRequest carries the refresh token of a session
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // TokenResponse represents the token response
 type TokenResponse struct {
-	Token string    `json:"token"`
-	User  *UserInfo `json:"user"`
+	*auth.Tokens
+	User *UserInfo `json:"user"`
+}
+
+// ChangePasswordRequest represents the request to change the password of
+// the current user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6,max=72"`
+	ConfirmPassword string `json:"confirm_password" binding:"required"`
+}
+
+// PasswordResetRequest represents the request for a password reset email
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordResetConfirmRequest represents the request to set a new password
+// with the token from a password reset email
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6,max=72"`
+}
+
+// VerifyEmailRequest carries the token from a verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
 }
 
 // UserInfo represents user information in responses
 type UserInfo struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          string `json:"role"`
+}
+
+// newUserInfo returns the user information of user
+func newUserInfo(user *db.User) *UserInfo {
+	return &UserInfo{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Role:          user.Role,
+	}
 }
 
 // Login authenticates a user and returns a JWT token
@@ -60,7 +109,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Get user by username
-	user, err := h.userRepo.GetByUsername(req.Username)
+	user, err := h.userRepo.GetByUsername(c.Request.Context(), req.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
@@ -83,23 +132,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := h.jwtService.GenerateToken(user.ID, user.Username)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to generate token",
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Account is disabled",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": token,
-		"user": &UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-		},
-	})
+	h.startSession(c, http.StatusOK, user)
 }
 
 // Register creates a new user account
@@ -113,7 +153,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if user already exists by username
-	existingUser, err := h.userRepo.GetByUsername(req.Username)
+	existingUser, err := h.userRepo.GetByUsername(c.Request.Context(), req.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
@@ -129,7 +169,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Check if user already exists by email
-	existingUserByEmail, err := h.userRepo.GetByEmail(req.Email)
+	existingUserByEmail, err := h.userRepo.GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Internal server error",
@@ -157,42 +197,149 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	user := &db.User{
 		Username:     req.Username,
 		Email:        req.Email,
+		Role:         db.RoleMember,
 		PasswordHash: hashedPassword,
 	}
 
-	if err := h.userRepo.Create(user); err != nil {
+	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create user account",
 		})
 		return
 	}
 
-	// Generate JWT token for the new user
-	token, err := h.jwtService.GenerateToken(user.ID, user.Username)
+	// Ask the new user to verify their email address
+	if err := h.accounts.SendVerification(c.Request.Context(), user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	// Log the new user in
+	h.startSession(c, http.StatusCreated, user)
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token can only be used once; using one again
+// ends its session, since the token may have been stolen.
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	tokens, err := h.sessions.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Refresh token reuse detected, the session was revoked",
+		})
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or expired refresh token",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to generate token",
+			"error": "Failed to refresh token",
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"access_token": token,
-		"user": &UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-		},
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the session of the given refresh token, or of the access token
+// in the Authorization header. It succeeds even when neither is valid, so
+// clients can always clear their credentials.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if req.RefreshToken != "" {
+		if err := h.sessions.Logout(ctx, req.RefreshToken); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to log out",
+			})
+			return
+		}
+	}
+
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && !auth.IsAPIToken(token) {
+		if claims, err := h.sessions.JWTService().ValidateToken(ctx, token); err == nil {
+			if err := h.sessions.LogoutSession(ctx, claims.SessionID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to log out",
+				})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out successfully",
 	})
 }
 
-// RefreshToken generates a new token from an existing valid token
-func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	type RefreshRequest struct {
-		Token string `json:"token" binding:"required"`
+// LogoutAll ends every session of the current user, logging them out on all
+// devices including this one
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	revoked, err := h.sessions.LogoutAll(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to log out",
+		})
+		return
 	}
 
-	var req RefreshRequest
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Logged out of all devices successfully",
+		"sessions_revoked": revoked,
+	})
+}
+
+// GetProfile returns the current user's profile information
+func (h *AuthHandler) GetProfile(c *gin.Context) {
+	user, ok := h.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserInfo(user))
+}
+
+// UpdateProfile updates the current user's profile information. A new email
+// address has to be verified again, so a verification email is sent to it.
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	user, ok := h.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	type UpdateProfileRequest struct {
+		Email string `json:"email" binding:"omitempty,email,max=255"`
+	}
+
+	var req UpdateProfileRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid request format",
@@ -200,77 +347,224 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Refresh the token
-	newToken, err := h.jwtService.RefreshToken(req.Token)
+	if req.Email != "" {
+		err := h.accounts.ChangeEmail(c.Request.Context(), user, req.Email)
+		if errors.Is(err, auth.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Email already exists",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update profile",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, newUserInfo(user))
+}
+
+// ChangePassword changes the password of the current user, who has to give
+// the current one. The user's other sessions are logged out.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	user, ok := h.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if req.NewPassword != req.ConfirmPassword {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "New password and confirmation do not match",
+		})
+		return
+	}
+
+	sessionID, _ := c.Get("session_id")
+	err := h.accounts.ChangePassword(c.Request.Context(), user, sessionID.(int64), req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, auth.ErrWrongPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Current password is incorrect",
+		})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to change password",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed successfully",
+	})
+}
+
+// RequestPasswordReset emails a password reset link. The response is the
+// same whether or not the address is registered.
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if err := h.accounts.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to request password reset",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If the email address is registered, a password reset link has been sent to it",
+	})
+}
+
+// ConfirmPasswordReset sets a new password with the token from a password
+// reset email and logs the user out everywhere
+func (h *AuthHandler) ConfirmPasswordReset(c *gin.Context) {
+	var req PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	err := h.accounts.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid or expired token",
 		})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to reset password",
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"access_token": newToken,
+		"message": "Password reset successfully",
 	})
 }
 
-// GetProfile returns the current user's profile information
-func (h *AuthHandler) GetProfile(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "User not authenticated",
+// VerifyEmail verifies an email address with the token from a verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
 		})
 		return
 	}
 
-	user, err := h.userRepo.GetByID(userID.(int))
+	err := h.accounts.VerifyEmail(c.Request.Context(), req.Token)
+	if errors.Is(err, auth.ErrInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid or expired token",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to get user profile",
+			"error": "Failed to verify email",
 		})
 		return
 	}
 
-	if user == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "User not found",
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification sends a new verification email to the current user
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	user, ok := h.loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	err := h.accounts.SendVerification(c.Request.Context(), user)
+	if errors.Is(err, auth.ErrEmailAlreadyVerified) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Email is already verified",
+		})
+		return
+	}
+	if errors.Is(err, auth.ErrEmailSentRecently) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "A verification email was sent recently, please wait before requesting another",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to send verification email",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, UserInfo{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Verification email sent",
 	})
 }
 
-// UpdateProfile updates the current user's profile information
-func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+// loadCurrentUser loads the authenticated user, writing the error response
+// when that fails
+func (h *AuthHandler) loadCurrentUser(c *gin.Context) (*db.User, bool) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error": "User not authenticated",
 		})
-		return
+		return nil, false
 	}
 
-	type UpdateProfileRequest struct {
-		Email string `json:"email" binding:"omitempty,email"`
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to get user profile",
+		})
+		return nil, false
 	}
 
-	var req UpdateProfileRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid request format",
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// startSession starts a session for a user who just logged in or registered
+// and writes its tokens
+func (h *AuthHandler) startSession(c *gin.Context, status int, user *db.User) {
+	tokens, err := h.sessions.Start(c.Request.Context(), user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate token",
 		})
 		return
 	}
 
-	// For now, just return success - we'll implement profile updates later
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Profile updated successfully",
-		"user_id": strconv.Itoa(userID.(int)),
+	c.JSON(status, TokenResponse{
+		Tokens: tokens,
+		User:   newUserInfo(user),
 	})
 }
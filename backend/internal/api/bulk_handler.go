@@ -0,0 +1,374 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"web-crawler/internal/crawler"
+	"web-crawler/internal/db"
+	"web-crawler/internal/events"
+	"web-crawler/internal/export"
+	"web-crawler/internal/middleware"
+	"web-crawler/internal/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkTasks limits how many tasks a single bulk request may act on
+const maxBulkTasks = 100
+
+// BulkActionRequest lists the tasks a bulk action applies to
+type BulkActionRequest struct {
+	TaskIDs []int `json:"taskIds" binding:"required,min=1,max=100,dive,min=1"`
+}
+
+// BulkItemResult is the outcome of a bulk action for a single task
+type BulkItemResult struct {
+	TaskID    int    `json:"task_id"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+	NewTaskID int    `json:"new_task_id,omitempty"`
+}
+
+// BulkActionResponse reports which tasks a bulk action succeeded or failed for
+type BulkActionResponse struct {
+	Success   bool             `json:"success"`
+	Processed int              `json:"processed"`
+	Failed    int              `json:"failed"`
+	Errors    []string         `json:"errors,omitempty"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// add records the outcome for a task
+func (r *BulkActionResponse) add(item BulkItemResult) {
+	if item.Success {
+		r.Processed++
+	} else {
+		r.Failed++
+		r.Errors = append(r.Errors, fmt.Sprintf("Task %d: %s", item.TaskID, item.Error))
+	}
+	r.Success = r.Failed == 0
+	r.Results = append(r.Results, item)
+}
+
+// bindBulkRequest parses a bulk request and loads the tasks it names. Tasks
+// that do not exist or whose workspace does not grant the access level are
+// reported in the returned response; the remaining tasks are returned in
+// request order.
+func (h *CrawlHandler) bindBulkRequest(c *gin.Context, access workspaceAccess) ([]*db.CrawlTask, *BulkActionResponse, bool) {
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return nil, nil, false
+	}
+
+	var req BulkActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request format, taskIds must list 1 to %d task IDs", maxBulkTasks),
+		})
+		return nil, nil, false
+	}
+
+	// Drop duplicate IDs so each task is acted on once
+	seen := make(map[int]bool)
+	var ids []int
+	for _, id := range req.TaskIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	found, err := h.taskRepo.GetByIDs(c.Request.Context(), ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tasks",
+		})
+		return nil, nil, false
+	}
+
+	byID := make(map[int]*db.CrawlTask, len(found))
+	for _, task := range found {
+		byID[task.ID] = task
+	}
+
+	resp := &BulkActionResponse{Success: true, Results: []BulkItemResult{}}
+	var tasks []*db.CrawlTask
+	for _, id := range ids {
+		task := byID[id]
+		if task == nil {
+			resp.add(BulkItemResult{TaskID: id, Error: "Task not found"})
+			continue
+		}
+
+		reason, err := h.access.denied(c, task.WorkspaceID, access)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to check workspace access",
+			})
+			return nil, nil, false
+		}
+		if reason != "" {
+			resp.add(BulkItemResult{TaskID: id, Error: reason})
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, resp, true
+}
+
+// BulkDelete deletes several tasks with their results and links, stopping
+// running tasks first. All permitted tasks are deleted in one statement or
+// transaction. The tasks can be restored unless the permanent query
+// parameter is set.
+func (h *CrawlHandler) BulkDelete(c *gin.Context) {
+	tasks, resp, ok := h.bindBulkRequest(c, accessEdit)
+	if !ok {
+		return
+	}
+
+	err := h.deleteTasks(c.Request.Context(), tasks, c.Query("permanent") == "true")
+	for _, task := range tasks {
+		if err != nil {
+			resp.add(BulkItemResult{TaskID: task.ID, Error: "Failed to delete task"})
+		} else {
+			resp.add(BulkItemResult{TaskID: task.ID, Success: true})
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BulkStop stops several pending or running tasks
+func (h *CrawlHandler) BulkStop(c *gin.Context) {
+	tasks, resp, ok := h.bindBulkRequest(c, accessEdit)
+	if !ok {
+		return
+	}
+
+	for _, task := range tasks {
+		if !isActive(task.Status) {
+			resp.add(BulkItemResult{TaskID: task.ID, Error: "Task cannot be stopped in current status"})
+			continue
+		}
+		stopped, err := h.stopTask(c.Request.Context(), task.ID)
+		if err != nil {
+			resp.add(BulkItemResult{TaskID: task.ID, Error: "Failed to update task status"})
+			continue
+		}
+		if !stopped {
+			resp.add(BulkItemResult{TaskID: task.ID, Error: "Task cannot be stopped in current status"})
+			continue
+		}
+		resp.add(BulkItemResult{TaskID: task.ID, Success: true})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BulkRerun queues a new task with the same settings for each finished task.
+// The IDs of the new tasks are returned in new_task_id.
+func (h *CrawlHandler) BulkRerun(c *gin.Context) {
+	tasks, resp, ok := h.bindBulkRequest(c, accessEdit)
+	if !ok {
+		return
+	}
+
+	for _, task := range tasks {
+		if isActive(task.Status) {
+			resp.add(BulkItemResult{TaskID: task.ID, Error: "Task is still running"})
+			continue
+		}
+
+		rerun, err := h.rerunTask(c, task)
+		if err != nil {
+			msg := "Failed to create crawl task"
+			if errors.Is(err, queue.ErrQuotaExceeded) {
+				msg = "Too many queued crawl tasks"
+			}
+			resp.add(BulkItemResult{TaskID: task.ID, Error: msg})
+			continue
+		}
+		resp.add(BulkItemResult{TaskID: task.ID, Success: true, NewTaskID: rerun.ID})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BulkExport streams a zip archive with one file per task, in the format
+// given by the format query parameter, CSV by default. A manifest.json file
+// describes the exported tasks and lists the tasks that could not be exported.
+func (h *CrawlHandler) BulkExport(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	exporter, ok := export.Get(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Unsupported export format",
+			"formats": export.Formats(),
+		})
+		return
+	}
+
+	tasks, resp, ok := h.bindBulkRequest(c, accessView)
+	if !ok {
+		return
+	}
+
+	if len(tasks) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "No tasks could be exported",
+			"errors": resp.Errors,
+		})
+		return
+	}
+
+	for _, task := range tasks {
+		resp.add(BulkItemResult{TaskID: task.ID, Success: true})
+	}
+
+	filename := fmt.Sprintf("crawl-export-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	// The response is already being sent, so failures can only cut it short
+	archive := zip.NewWriter(c.Writer)
+	if err := h.writeExportArchive(c.Request.Context(), archive, tasks, resp, format, exporter); err != nil {
+		log.Printf("Failed to export tasks: %v", err)
+		return
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("Failed to finish export archive: %v", err)
+	}
+}
+
+// writeExportArchive adds the manifest and the file of every task to archive
+func (h *CrawlHandler) writeExportArchive(ctx context.Context, archive *zip.Writer, tasks []*db.CrawlTask, resp *BulkActionResponse, format string, exporter export.Exporter) error {
+	manifest, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(manifest)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(gin.H{
+		"exported_at": time.Now(),
+		"format":      format,
+		"tasks":       tasks,
+		"errors":      resp.Errors,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		data, err := h.exportData(ctx, task)
+		if err != nil {
+			return err
+		}
+		w, err := archive.Create(fmt.Sprintf("task-%d.%s", task.ID, exporter.Extension()))
+		if err != nil {
+			return err
+		}
+		if err := exporter.Write(w, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteTasks stops and deletes tasks, either permanently or so that they can
+// be restored, and notifies the members of their workspaces
+func (h *CrawlHandler) deleteTasks(ctx context.Context, tasks []*db.CrawlTask, permanent bool) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+
+	var err error
+	if permanent {
+		err = h.taskRepo.DeleteByIDs(ctx, ids)
+	} else {
+		err = h.taskRepo.SoftDeleteByIDs(ctx, ids)
+	}
+	if err != nil {
+		log.Printf("Failed to delete tasks %v: %v", ids, err)
+		return err
+	}
+
+	// Tasks are only stopped once deleted, so a failed delete leaves them running
+	for _, task := range tasks {
+		if isActive(task.Status) {
+			h.taskQueue.StopTask(task.ID)
+		}
+	}
+
+	for _, task := range tasks {
+		message := events.Message{
+			"type":      events.TypeDeleted,
+			"task_id":   task.ID,
+			"permanent": permanent,
+		}
+		if !permanent {
+			message["restore_until"] = time.Now().Add(h.restoreWindow)
+		}
+		h.bus.PublishTask(task.WorkspaceID, task.ID, message)
+	}
+
+	return nil
+}
+
+// stopTask cancels a pending or running task. It reports false when the task
+// finished in the meantime.
+func (h *CrawlHandler) stopTask(ctx context.Context, taskID int) (bool, error) {
+	return h.taskQueue.CancelTask(ctx, taskID)
+}
+
+// rerunTask queues a new task with the same settings as task, linked to it
+// as the next run of its series in the same workspace. The rerun counts
+// towards the quota of the user starting it. Only admins keep the robots.txt
+// override of the original task.
+func (h *CrawlHandler) rerunTask(c *gin.Context, task *db.CrawlTask) (*db.CrawlTask, error) {
+	userID := c.GetInt("user_id")
+	seriesKey := task.SeriesKey
+	if seriesKey == "" {
+		seriesKey = crawler.NormalizeURL(task.URL)
+	}
+	parentID := task.ID
+
+	rerun := &db.CrawlTask{
+		UserID:       userID,
+		WorkspaceID:  task.WorkspaceID,
+		URL:          task.URL,
+		SeriesKey:    seriesKey,
+		ParentTaskID: &parentID,
+		CrawlMode:    task.CrawlMode,
+		MaxDepth:     task.MaxDepth,
+		MaxPages:     task.MaxPages,
+		CrawlScope:   task.CrawlScope,
+		IgnoreRobots: task.IgnoreRobots && middleware.IsAdmin(c),
+		Status:       db.TaskStatusPending,
+		Progress:     0.0,
+	}
+	if err := h.taskQueue.Enqueue(c.Request.Context(), rerun); err != nil {
+		return nil, err
+	}
+	return rerun, nil
+}
+
+// isActive reports whether a task is waiting to run or running
+func isActive(status string) bool {
+	return status == db.TaskStatusPending || status == db.TaskStatusInProgress
+}
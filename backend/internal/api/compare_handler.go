@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"web-crawler/internal/compare"
+	"web-crawler/internal/crawler"
+	"web-crawler/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompareTasks reports what changed between two finished runs, given as the
+// base and target query parameters. Without base, target is compared with
+// the previous run of the same URL.
+func (h *CrawlHandler) CompareTasks(c *gin.Context) {
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Query("target"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid target task ID",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	target, ok := h.comparableTask(c, targetID)
+	if !ok {
+		return
+	}
+
+	var base *db.CrawlTask
+	if baseParam := c.Query("base"); baseParam != "" {
+		baseID, err := strconv.Atoi(baseParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid base task ID",
+			})
+			return
+		}
+		if base, ok = h.comparableTask(c, baseID); !ok {
+			return
+		}
+	} else {
+		// Tasks created before run series existed have no key yet
+		if target.SeriesKey == "" {
+			target.SeriesKey = crawler.NormalizeURL(target.URL)
+		}
+		base, err = h.taskRepo.GetPreviousInSeries(ctx, target)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve task",
+			})
+			return
+		}
+		if base == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No earlier completed run of this URL to compare with",
+			})
+			return
+		}
+	}
+
+	baseRun, err := h.loadRun(ctx, base)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve results",
+		})
+		return
+	}
+	targetRun, err := h.loadRun(ctx, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve results",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, compare.Compare(baseRun, targetRun))
+}
+
+// comparableTask loads a task the user can view that is not running anymore,
+// writing an error response when there is none
+func (h *CrawlHandler) comparableTask(c *gin.Context, taskID int) (*db.CrawlTask, bool) {
+	task, err := h.taskRepo.GetByID(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve task",
+		})
+		return nil, false
+	}
+
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Task not found",
+		})
+		return nil, false
+	}
+
+	if !h.access.authorizeTask(c, task, accessView) {
+		return nil, false
+	}
+
+	if isActive(task.Status) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Task is still running",
+		})
+		return nil, false
+	}
+
+	return task, true
+}
+
+// loadRun reads the stored pages and links of a task
+func (h *CrawlHandler) loadRun(ctx context.Context, task *db.CrawlTask) (*compare.Run, error) {
+	pages, err := h.resultRepo.ListByTaskID(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	links, err := h.linkRepo.GetByTaskID(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &compare.Run{Task: task, Pages: pages, Links: links}, nil
+}
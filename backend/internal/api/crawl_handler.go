@@ -1,13 +1,23 @@
 package api
 
 import (
-	"bytes"
-	"encoding/csv"
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"web-crawler/config"
+	"web-crawler/internal/crawler"
 	"web-crawler/internal/db"
+	"web-crawler/internal/events"
+	"web-crawler/internal/export"
+	"web-crawler/internal/middleware"
 	"web-crawler/internal/queue"
-	"web-crawler/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,23 +28,67 @@ type CrawlHandler struct {
 	resultRepo *db.ResultRepository
 	linkRepo   *db.LinkRepository
 	taskQueue  *queue.TaskQueue
-	wsHub      *websocket.Hub
+	bus        *events.Bus
+	access     *workspaceAuthorizer
+	// restoreWindow is how long deleted tasks can be restored
+	restoreWindow time.Duration
 }
 
 // NewCrawlHandler creates a new crawl handler
-func NewCrawlHandler(taskRepo *db.TaskRepository, resultRepo *db.ResultRepository, linkRepo *db.LinkRepository, taskQueue *queue.TaskQueue, wsHub *websocket.Hub) *CrawlHandler {
+func NewCrawlHandler(taskRepo *db.TaskRepository, resultRepo *db.ResultRepository, linkRepo *db.LinkRepository, workspaceRepo *db.WorkspaceRepository, taskQueue *queue.TaskQueue, bus *events.Bus) *CrawlHandler {
+	cfg := config.Load()
+
 	return &CrawlHandler{
-		taskRepo:   taskRepo,
-		resultRepo: resultRepo,
-		linkRepo:   linkRepo,
-		taskQueue:  taskQueue,
-		wsHub:      wsHub,
+		taskRepo:      taskRepo,
+		resultRepo:    resultRepo,
+		linkRepo:      linkRepo,
+		taskQueue:     taskQueue,
+		bus:           bus,
+		access:        newWorkspaceAuthorizer(workspaceRepo),
+		restoreWindow: cfg.Tasks.RestoreWindow,
 	}
 }
 
-// StartCrawlRequest represents the request to start a crawl task
+// CrawlOptions are the crawl settings shared by crawl and schedule requests.
+// Mode "site" follows internal links up to MaxDepth levels and MaxPages pages
+// within Scope; the default "page" mode analyzes only the given URL.
+// IgnoreRobots bypasses robots.txt and is only accepted from admins.
+type CrawlOptions struct {
+	Mode         string `json:"mode" binding:"omitempty,oneof=page site"`
+	MaxDepth     *int   `json:"max_depth" binding:"omitempty,min=0,max=5"`
+	MaxPages     *int   `json:"max_pages" binding:"omitempty,min=1,max=500"`
+	Scope        string `json:"scope" binding:"omitempty,oneof=host subdomain"`
+	IgnoreRobots bool   `json:"ignore_robots"`
+}
+
+// settings returns the crawl mode, depth, page limit and scope the options
+// ask for, filling in the defaults of the mode
+func (o CrawlOptions) settings() (mode string, maxDepth, maxPages int, scope string) {
+	if o.Mode != db.CrawlModeSite {
+		return db.CrawlModePage, 0, 1, db.CrawlScopeHost
+	}
+
+	maxDepth = crawler.DefaultSiteMaxDepth
+	maxPages = crawler.DefaultSiteMaxPages
+	scope = db.CrawlScopeHost
+	if o.MaxDepth != nil {
+		maxDepth = *o.MaxDepth
+	}
+	if o.MaxPages != nil {
+		maxPages = *o.MaxPages
+	}
+	if o.Scope != "" {
+		scope = o.Scope
+	}
+	return db.CrawlModeSite, maxDepth, maxPages, scope
+}
+
+// StartCrawlRequest represents the request to start a crawl task. Tasks go
+// to the personal workspace of the user unless WorkspaceID names another.
 type StartCrawlRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL         string `json:"url" binding:"required,url"`
+	WorkspaceID int    `json:"workspace_id" binding:"min=0"`
+	CrawlOptions
 }
 
 // TaskStatusResponse represents the task status response
@@ -61,28 +115,54 @@ func (h *CrawlHandler) StartCrawl(c *gin.Context) {
 		return
 	}
 
-	// Create new crawl task
-	task := &db.CrawlTask{
-		UserID:   userID.(int),
-		URL:      req.URL,
-		Status:   db.TaskStatusPending,
-		Progress: 0.0,
+	if req.IgnoreRobots && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only admins can ignore robots.txt",
+		})
+		return
 	}
 
-	if err := h.taskRepo.Create(task); err != nil {
+	workspaceID, ok := h.access.target(c, req.WorkspaceID)
+	if !ok {
+		return
+	}
+
+	// Create new crawl task
+	task := &db.CrawlTask{
+		UserID:       userID.(int),
+		WorkspaceID:  workspaceID,
+		URL:          req.URL,
+		SeriesKey:    crawler.NormalizeURL(req.URL),
+		IgnoreRobots: req.IgnoreRobots,
+		Status:       db.TaskStatusPending,
+		Progress:     0.0,
+	}
+	task.CrawlMode, task.MaxDepth, task.MaxPages, task.CrawlScope = req.settings()
+
+	// Queue the task, refusing new work when the user's queue is full
+	if err := h.taskQueue.Enqueue(c.Request.Context(), task); err != nil {
+		if errors.Is(err, queue.ErrQuotaExceeded) {
+			c.Header("Retry-After", "60")
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many queued crawl tasks, wait for some to finish before starting more",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create crawl task",
 		})
 		return
 	}
 
-	// Add task to queue
-	h.taskQueue.AddTask(task)
-
 	c.JSON(http.StatusCreated, task)
 }
 
-// GetUserTasks retrieves crawl tasks for the authenticated user with pagination
+// GetUserTasks retrieves the crawl tasks of the workspaces of the
+// authenticated user with pagination. The list can be narrowed down to one
+// workspace with workspace_id, filtered by status (a comma separated list),
+// creation date (from and to, as a date or RFC 3339 time), domain and
+// has_broken_links, searched with q over the URL and page title, and sorted
+// with sort and order (asc or desc).
 func (h *CrawlHandler) GetUserTasks(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -105,71 +185,164 @@ func (h *CrawlHandler) GetUserTasks(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	tasks, err := h.taskRepo.GetByUserID(userID.(int), limit, offset)
+	filter, err := parseTaskFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve tasks",
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
 		})
 		return
 	}
-
-	if tasks == nil {
-		tasks = []*db.CrawlTask{}
+	workspaceID, ok := h.access.workspaceParam(c)
+	if !ok {
+		return
 	}
+	filter.WorkspaceID = workspaceID
 
-	c.JSON(http.StatusOK, gin.H{
-		"tasks": tasks,
-		"page":  page,
-		"limit": limit,
-		"total": len(tasks),
-	})
-}
-
-// GetTaskStatus retrieves the status of a specific crawl task
-func (h *CrawlHandler) GetTaskStatus(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "User not authenticated",
+	ctx := c.Request.Context()
+	tasks, err := h.taskRepo.List(ctx, userID.(int), filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tasks",
 		})
 		return
 	}
 
-	taskID, err := strconv.Atoi(c.Param("id"))
+	total, err := h.taskRepo.Count(ctx, userID.(int), filter)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid task ID",
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tasks",
 		})
 		return
 	}
 
-	task, err := h.taskRepo.GetByID(taskID)
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	roots, err := h.resultRepo.GetRootsByTaskIDs(ctx, ids)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve task",
+			"error": "Failed to retrieve results",
 		})
 		return
 	}
 
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Task not found",
-		})
-		return
+	items := make([]TaskStatusResponse, len(tasks))
+	for i, task := range tasks {
+		items[i] = TaskStatusResponse{CrawlTask: task, Results: roots[task.ID]}
 	}
 
-	// Check if user owns this task
-	if task.UserID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Access denied",
-		})
+	c.JSON(http.StatusOK, gin.H{
+		"tasks": items,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+// taskStatuses lists the statuses the task list can be filtered on
+var taskStatuses = map[string]bool{
+	db.TaskStatusPending:    true,
+	db.TaskStatusInProgress: true,
+	db.TaskStatusCompleted:  true,
+	db.TaskStatusFailed:     true,
+	db.TaskStatusCancelled:  true,
+}
+
+// parseTaskFilter reads the filter, search and sort parameters of the task list
+func parseTaskFilter(c *gin.Context) (db.TaskFilter, error) {
+	filter := db.TaskFilter{
+		Domain:     strings.TrimSpace(c.Query("domain")),
+		Query:      strings.TrimSpace(c.Query("q")),
+		Sort:       c.DefaultQuery("sort", "created_at"),
+		Descending: true,
+	}
+
+	for _, param := range c.QueryArray("status") {
+		for _, status := range strings.Split(param, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if !taskStatuses[status] {
+				return filter, fmt.Errorf("Invalid status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseDateParam(from, false)
+		if err != nil {
+			return filter, errors.New("Invalid from date, expected YYYY-MM-DD or RFC 3339")
+		}
+		filter.CreatedFrom = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseDateParam(to, true)
+		if err != nil {
+			return filter, errors.New("Invalid to date, expected YYYY-MM-DD or RFC 3339")
+		}
+		filter.CreatedTo = &t
+	}
+
+	// A full URL is accepted as a domain too
+	if strings.Contains(filter.Domain, "://") {
+		if u, err := url.Parse(filter.Domain); err == nil {
+			filter.Domain = u.Hostname()
+		}
+	}
+
+	if value := c.Query("has_broken_links"); value != "" {
+		hasBroken, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, errors.New("Invalid has_broken_links, expected true or false")
+		}
+		filter.HasBrokenLinks = &hasBroken
+	}
+
+	if !slices.Contains(db.TaskSortFields(), filter.Sort) {
+		return filter, fmt.Errorf("Invalid sort field, expected one of: %s", strings.Join(db.TaskSortFields(), ", "))
+	}
+	switch strings.ToLower(c.DefaultQuery("order", "desc")) {
+	case "asc":
+		filter.Descending = false
+	case "desc":
+	default:
+		return filter, errors.New("Invalid order, expected asc or desc")
+	}
+
+	return filter, nil
+}
+
+// parseDateParam parses a date or an RFC 3339 time. A date stands for the
+// start of that day, or its last second when endOfDay is set.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		return day.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return day, nil
+}
+
+// GetTaskStatus retrieves the status of a specific crawl task
+func (h *CrawlHandler) GetTaskStatus(c *gin.Context) {
+	task, ok := h.loadTask(c, accessView)
+	if !ok {
 		return
 	}
 
 	// Get results if task is completed
 	var results *db.CrawlResult
 	if task.Status == db.TaskStatusCompleted {
-		results, _ = h.resultRepo.GetByTaskID(taskID)
+		results, _ = h.resultRepo.GetByTaskID(c.Request.Context(), task.ID)
 	}
 
 	response := TaskStatusResponse{
@@ -182,71 +355,78 @@ func (h *CrawlHandler) GetTaskStatus(c *gin.Context) {
 
 // StopCrawl stops a running crawl task
 func (h *CrawlHandler) StopCrawl(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "User not authenticated",
-		})
+	task, ok := h.loadTask(c, accessEdit)
+	if !ok {
 		return
 	}
 
-	taskID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
+	// Check if task can be stopped
+	if !isActive(task.Status) {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid task ID",
+			"error": "Task cannot be stopped in current status",
 		})
 		return
 	}
 
-	task, err := h.taskRepo.GetByID(taskID)
+	// Stop the task and update its status
+	stopped, err := h.stopTask(c.Request.Context(), task.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve task",
+			"error": "Failed to update task status",
 		})
 		return
 	}
-
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Task not found",
+	if !stopped {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Task cannot be stopped in current status",
 		})
 		return
 	}
 
-	// Check if user owns this task
-	if task.UserID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Access denied",
-		})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Task stopped successfully",
+	})
+}
+
+// RerunTask queues a new run of a finished task with the same settings. The
+// new task is linked to the original and belongs to the same run series.
+func (h *CrawlHandler) RerunTask(c *gin.Context) {
+	task, ok := h.loadTask(c, accessEdit)
+	if !ok {
 		return
 	}
 
-	// Check if task can be stopped
-	if task.Status != db.TaskStatusPending && task.Status != db.TaskStatusInProgress {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Task cannot be stopped in current status",
+	if isActive(task.Status) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Task is still running",
 		})
 		return
 	}
 
-	// Stop the task
-	h.taskQueue.StopTask(taskID)
-
-	// Update task status
-	if err := h.taskRepo.UpdateStatus(taskID, db.TaskStatusCancelled); err != nil {
+	rerun, err := h.rerunTask(c, task)
+	if err != nil {
+		if errors.Is(err, queue.ErrQuotaExceeded) {
+			c.Header("Retry-After", "60")
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many queued crawl tasks, wait for some to finish before starting more",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to update task status",
+			"error": "Failed to create crawl task",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Task stopped successfully",
-	})
+	c.JSON(http.StatusCreated, rerun)
 }
 
-// GetResults retrieves the results of a completed crawl task
-func (h *CrawlHandler) GetResults(c *gin.Context) {
+// GetHistory lists the runs of a URL over time with the results of their
+// start page, newest first. The URL is given with the url query parameter,
+// in the workspace given by workspace_id or the personal one, or through one
+// of its runs with task_id; without either, all runs in the workspaces of the
+// user are listed.
+func (h *CrawlHandler) GetHistory(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{
@@ -255,39 +435,121 @@ func (h *CrawlHandler) GetResults(c *gin.Context) {
 		return
 	}
 
-	taskID, err := strconv.Atoi(c.Param("id"))
+	// Get pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	offset := (page - 1) * limit
+	ctx := c.Request.Context()
+
+	rawURL := c.Query("url")
+	seriesKey := ""
+	workspaceID := 0
+	if rawURL != "" {
+		seriesKey = crawler.NormalizeURL(rawURL)
+		var ok bool
+		if workspaceID, ok = h.access.workspaceParam(c); !ok {
+			return
+		}
+		if workspaceID == 0 {
+			if workspaceID, ok = h.access.personal(c); !ok {
+				return
+			}
+		}
+	} else if idParam := c.Query("task_id"); idParam != "" {
+		taskID, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid task ID",
+			})
+			return
+		}
+
+		task, err := h.taskRepo.GetByID(ctx, taskID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve task",
+			})
+			return
+		}
+		if task == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Task not found",
+			})
+			return
+		}
+		if !h.access.authorizeTask(c, task, accessView) {
+			return
+		}
+		rawURL, seriesKey, workspaceID = task.URL, task.SeriesKey, task.WorkspaceID
+		if seriesKey == "" {
+			seriesKey = crawler.NormalizeURL(task.URL)
+		}
+	}
+
+	var tasks []*db.CrawlTask
+	var total int
+	var err error
+	if seriesKey != "" {
+		tasks, err = h.taskRepo.GetSeries(ctx, workspaceID, seriesKey, rawURL, limit, offset)
+		if err == nil {
+			total, err = h.taskRepo.CountSeries(ctx, workspaceID, seriesKey, rawURL)
+		}
+	} else {
+		tasks, err = h.taskRepo.GetByMemberID(ctx, userID.(int), limit, offset)
+		if err == nil {
+			total, err = h.taskRepo.CountByMemberID(ctx, userID.(int))
+		}
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid task ID",
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tasks",
 		})
 		return
 	}
 
-	task, err := h.taskRepo.GetByID(taskID)
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	roots, err := h.resultRepo.GetRootsByTaskIDs(ctx, ids)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve task",
+			"error": "Failed to retrieve results",
 		})
 		return
 	}
 
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Task not found",
-		})
-		return
+	runs := make([]TaskStatusResponse, len(tasks))
+	for i, task := range tasks {
+		runs[i] = TaskStatusResponse{CrawlTask: task, Results: roots[task.ID]}
 	}
 
-	// Check if user owns this task
-	if task.UserID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Access denied",
-		})
+	c.JSON(http.StatusOK, gin.H{
+		"series_key": seriesKey,
+		"tasks":      runs,
+		"page":       page,
+		"limit":      limit,
+		"total":      total,
+	})
+}
+
+// GetResults retrieves the results of a completed crawl task
+func (h *CrawlHandler) GetResults(c *gin.Context) {
+	task, ok := h.loadTask(c, accessView)
+	if !ok {
 		return
 	}
 
 	// Get results
-	results, err := h.resultRepo.GetByTaskID(taskID)
+	results, err := h.resultRepo.GetByTaskID(c.Request.Context(), task.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve results",
@@ -305,16 +567,55 @@ func (h *CrawlHandler) GetResults(c *gin.Context) {
 	c.JSON(http.StatusOK, results)
 }
 
-// DeleteTask deletes a crawl task and its associated data
+// GetPages retrieves the results of every page crawled by a task
+func (h *CrawlHandler) GetPages(c *gin.Context) {
+	task, ok := h.loadTask(c, accessView)
+	if !ok {
+		return
+	}
+	pages, err := h.resultRepo.ListByTaskID(c.Request.Context(), task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pages"})
+		return
+	}
+	if pages == nil {
+		pages = []*db.CrawlResult{}
+	}
+	c.JSON(http.StatusOK, pages)
+}
+
+// DeleteTask deletes a crawl task and its associated data, stopping it first
+// if it is running. The task can be restored until the restore window passes,
+// unless the permanent query parameter is set.
 func (h *CrawlHandler) DeleteTask(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "User not authenticated",
+	task, ok := h.loadTask(c, accessEdit)
+	if !ok {
+		return
+	}
+
+	permanent := c.Query("permanent") == "true"
+	if err := h.deleteTasks(c.Request.Context(), []*db.CrawlTask{task}, permanent); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete task",
 		})
 		return
 	}
 
+	if permanent {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Task deleted permanently",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Task deleted",
+		"restore_until": time.Now().Add(h.restoreWindow),
+	})
+}
+
+// RestoreTask brings back a deleted crawl task within the restore window
+func (h *CrawlHandler) RestoreTask(c *gin.Context) {
 	taskID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -323,7 +624,8 @@ func (h *CrawlHandler) DeleteTask(c *gin.Context) {
 		return
 	}
 
-	task, err := h.taskRepo.GetByID(taskID)
+	restorableSince := time.Now().Add(-h.restoreWindow)
+	task, err := h.taskRepo.GetDeletedByID(c.Request.Context(), taskID, restorableSince)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve task",
@@ -333,139 +635,180 @@ func (h *CrawlHandler) DeleteTask(c *gin.Context) {
 
 	if task == nil {
 		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Task not found",
+			"error": "Deleted task not found or can no longer be restored",
 		})
 		return
 	}
 
-	// Check if user owns this task
-	if task.UserID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error": "Access denied",
+	if !h.access.authorizeTask(c, task, accessEdit) {
+		return
+	}
+
+	restored, err := h.taskRepo.Restore(c.Request.Context(), taskID, restorableSince)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to restore task",
 		})
 		return
 	}
 
-	// For now, just return success - we'll implement deletion later
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Task deletion scheduled",
+	// The task was restored, purged or left the window since it was read
+	if !restored {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Deleted task not found or can no longer be restored",
+		})
+		return
+	}
+
+	task.DeletedAt = nil
+	h.bus.PublishTask(task.WorkspaceID, task.ID, events.Message{
+		"type":    events.TypeRestored,
+		"task_id": task.ID,
 	})
+
+	c.JSON(http.StatusOK, task)
 }
 
-// GetLinks retrieves all links for a specific crawl task
+// GetLinks retrieves the links of a specific crawl task. Without query
+// parameters every link is returned. Otherwise a page of links is returned,
+// filtered by type, accessible, check_status, status (classes such as 4xx,
+// codes or none), host and page_url, searched with q over the URL and anchor
+// text, sorted with sort and order, and continued with the next_cursor of
+// the previous page.
 func (h *CrawlHandler) GetLinks(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	task, ok := h.loadTask(c, accessView)
+	if !ok {
 		return
 	}
-	taskID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+	if !hasLinkListParams(c) {
+		// Clients that do not ask for a page still get every link
+		links, err := h.linkRepo.GetByTaskID(c.Request.Context(), task.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve links"})
+			return
+		}
+		c.JSON(http.StatusOK, links)
 		return
 	}
-	task, err := h.taskRepo.GetByID(taskID)
+
+	filter, cursor, limit, err := parseLinkListParams(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+
+	// One extra link tells whether there is a next page
+	links, err := h.linkRepo.List(c.Request.Context(), task.ID, filter, cursor, limit+1)
+	if errors.Is(err, db.ErrInvalidLinkFilter) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link filter"})
 		return
 	}
-	if task.UserID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve links"})
 		return
 	}
-	links, err := h.linkRepo.GetByTaskID(taskID)
+	total, err := h.linkRepo.Count(c.Request.Context(), task.ID, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve links"})
 		return
 	}
-	c.JSON(http.StatusOK, links)
+
+	var nextCursor string
+	hasMore := len(links) > limit
+	if hasMore {
+		links = links[:limit]
+		nextCursor = encodeLinkCursor(filter, filter.CursorFor(links[len(links)-1]))
+	}
+	if links == nil {
+		links = []*db.CrawlLink{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"links":       links,
+		"limit":       limit,
+		"total":       total,
+		"has_more":    hasMore,
+		"next_cursor": nextCursor,
+	})
 }
 
-// ExportResults exports crawl results and links as CSV
+// ExportResults exports the pages and links of a task in the format given by
+// the format query parameter, CSV by default
 func (h *CrawlHandler) ExportResults(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	exporter, ok := export.Get(c.DefaultQuery("format", "csv"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Unsupported export format",
+			"formats": export.Formats(),
+		})
 		return
 	}
-	taskID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+	task, ok := h.loadTask(c, accessView)
+	if !ok {
 		return
 	}
-	task, err := h.taskRepo.GetByID(taskID)
+	data, err := h.exportData(c.Request.Context(), task)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve task"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve results"})
 		return
 	}
-	if task == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
-		return
-	}
-	if task.UserID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-	result, _ := h.resultRepo.GetByTaskID(taskID)
-	links, _ := h.linkRepo.GetByTaskID(taskID)
-
-	var buf bytes.Buffer
-	w := csv.NewWriter(&buf)
-	// Write result summary
-	w.Write([]string{"Field", "Value"})
-	if result != nil {
-		w.Write([]string{"Page Title", derefStr(result.PageTitle)})
-		w.Write([]string{"HTML Version", derefStr(result.HTMLVersion)})
-		w.Write([]string{"H1 Count", itoa(result.H1Count)})
-		w.Write([]string{"H2 Count", itoa(result.H2Count)})
-		w.Write([]string{"H3 Count", itoa(result.H3Count)})
-		w.Write([]string{"Internal Links", itoa(result.InternalLinksCount)})
-		w.Write([]string{"External Links", itoa(result.ExternalLinksCount)})
-		w.Write([]string{"Inaccessible Links", itoa(result.InaccessibleLinksCount)})
-		w.Write([]string{"Total Links", itoa(result.TotalLinksCount)})
-		w.Write([]string{"Response Time (ms)", itoa(result.ResponseTimeMs)})
-		w.Write([]string{"Page Size (bytes)", itoa(result.PageSizeBytes)})
-	}
-	w.Write([]string{})
-	// Write links header
-	w.Write([]string{"URL", "Type", "Status Code", "Accessible", "Anchor Text", "Response Time (ms)"})
-	for _, link := range links {
-		w.Write([]string{
-			link.URL,
-			link.LinkType,
-			itoaPtr(link.StatusCode),
-			boolToStr(link.IsAccessible),
-			derefStr(link.AnchorText),
-			itoa(link.ResponseTimeMs),
-		})
+
+	filename := fmt.Sprintf("crawl-results-%d.%s", task.ID, exporter.Extension())
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", exporter.ContentType())
+	c.Status(http.StatusOK)
+
+	// The response is already being sent, so failures can only cut it short
+	if err := exporter.Write(c.Writer, data); err != nil {
+		log.Printf("Failed to export task %d: %v", task.ID, err)
 	}
-	w.Flush()
-	c.Header("Content-Disposition", "attachment; filename=crawl-results.csv")
-	c.Data(http.StatusOK, "text/csv", buf.Bytes())
 }
 
-func derefStr(s *string) string {
-	if s == nil {
-		return ""
+// loadTask loads the task named by the id parameter and checks that the
+// authenticated user has the access level in its workspace, writing the
+// error response when either fails
+func (h *CrawlHandler) loadTask(c *gin.Context, access workspaceAccess) (*db.CrawlTask, bool) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid task ID",
+		})
+		return nil, false
 	}
-	return *s
-}
-func itoa(i int) string {
-	return strconv.Itoa(i)
-}
-func itoaPtr(i *int) string {
-	if i == nil {
-		return ""
+
+	task, err := h.taskRepo.GetByID(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve task",
+		})
+		return nil, false
 	}
-	return strconv.Itoa(*i)
-}
-func boolToStr(b bool) string {
-	if b {
-		return "true"
+
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Task not found",
+		})
+		return nil, false
+	}
+
+	if !h.access.authorizeTask(c, task, access) {
+		return nil, false
 	}
-	return "false"
+
+	return task, true
+}
+
+// exportData loads the pages of a task for export and streams its links
+func (h *CrawlHandler) exportData(ctx context.Context, task *db.CrawlTask) (*export.Task, error) {
+	pages, err := h.resultRepo.ListByTaskID(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &export.Task{
+		Task:  task,
+		Pages: pages,
+		Links: func(fn func(*db.CrawlLink) error) error {
+			return h.linkRepo.ForEachByTaskID(ctx, task.ID, fn)
+		},
+	}, nil
 }
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"web-crawler/internal/db"
+	"web-crawler/internal/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sseKeepAlive is how often a comment is sent on idle event streams so
+	// that proxies do not close them
+	sseKeepAlive = 30 * time.Second
+	// sseReplayTimeout bounds the wait for missed events of a finished task
+	sseReplayTimeout = 5 * time.Second
+)
+
+// StreamEvents streams the events of a task as Server-Sent Events. It emits
+// the same messages as the WebSocket endpoint, with the event ID and type set
+// on each event. Clients reconnecting with a Last-Event-ID header (or a
+// last_event_id query parameter) first receive the events they missed. The
+// stream ends once the task completes, fails, is stopped or is deleted.
+func (h *CrawlHandler) StreamEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	task, ok := h.loadTask(c, accessView)
+	if !ok {
+		return
+	}
+
+	opts := events.SubscribeOptions{TaskIDs: []int{task.ID}}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if id, err := strconv.ParseInt(lastEventID, 10, 64); err == nil && id >= 0 {
+		opts.Resume = true
+		opts.LastEventID = id
+	}
+
+	sub := h.bus.Subscribe(userID.(int), opts)
+	defer h.bus.Unsubscribe(sub)
+
+	// Read the task again now that its events are followed, since it may have
+	// finished in between and published its last event before the subscription
+	task, err := h.taskRepo.GetByID(c.Request.Context(), task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve task",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// A task that finished, or was deleted, will not publish anything more,
+	// so send the events that were missed, report its state and end the
+	// stream. Otherwise reconnecting clients would keep idle streams open.
+	if task == nil || isFinished(task.Status) {
+		if opts.Resume {
+			writeReplay(c, sub)
+		}
+		if task != nil {
+			writeStatusEvent(c, task)
+		}
+		return
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped by the bus for falling behind or on shutdown
+				return
+			}
+			writeEvent(c, event)
+			switch event.Type {
+			case events.TypeResults, events.TypeFailed, events.TypeStopped, events.TypeDeleted:
+				return
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeReplay writes the missed events replayed to a resuming subscriber, up
+// to the message that ends the replay
+func writeReplay(c *gin.Context, sub *events.Subscriber) {
+	timeout := time.NewTimer(sseReplayTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			writeEvent(c, event)
+			if event.Type == events.TypeResumed || event.Type == events.TypeResyncRequired {
+				return
+			}
+		case <-timeout.C:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes a single Server-Sent Event
+func writeEvent(c *gin.Context, event *events.Event) {
+	if event.ID > 0 {
+		fmt.Fprintf(c.Writer, "id: %d\n", event.ID)
+	}
+	if event.Type != "" {
+		fmt.Fprintf(c.Writer, "event: %s\n", event.Type)
+	}
+	fmt.Fprintf(c.Writer, "data: %s\n\n", event.Data)
+	c.Writer.Flush()
+}
+
+// writeStatusEvent writes the current state of a task as a task_status event
+func writeStatusEvent(c *gin.Context, task *db.CrawlTask) {
+	c.SSEvent("task_status", task)
+	c.Writer.Flush()
+}
+
+// isFinished reports whether a task reached a final status
+func isFinished(status string) bool {
+	return status == db.TaskStatusCompleted || status == db.TaskStatusFailed || status == db.TaskStatusCancelled
+}
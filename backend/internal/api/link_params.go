@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"web-crawler/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of the links of a task
+const (
+	defaultLinkPageSize = 50
+	maxLinkPageSize     = 500
+)
+
+// linkListParams are the query parameters that ask for a filtered page of
+// links instead of every link of a task
+var linkListParams = []string{
+	"type", "accessible", "check_status", "status", "host", "page_url", "q", "sort", "order", "limit", "cursor",
+}
+
+// hasLinkListParams reports whether the request uses any link list parameter
+func hasLinkListParams(c *gin.Context) bool {
+	query := c.Request.URL.Query()
+	for _, param := range linkListParams {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkCursor is the content of the opaque cursor handed out with a page of
+// links. It records the sort it belongs to so it is not used with another.
+type linkCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// encodeLinkCursor returns the opaque cursor that continues after position
+func encodeLinkCursor(filter db.LinkFilter, position db.LinkCursor) string {
+	data, _ := json.Marshal(linkCursor{
+		Sort:  filter.Sort,
+		Desc:  filter.Descending,
+		Value: position.Value,
+		ID:    position.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeLinkCursor parses a cursor and checks it belongs to the filter's sort
+func decodeLinkCursor(value string, filter db.LinkFilter) (*db.LinkCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("Invalid cursor")
+	}
+
+	var cursor linkCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID < 1 {
+		return nil, errors.New("Invalid cursor")
+	}
+	if cursor.Sort != filter.Sort || cursor.Desc != filter.Descending {
+		return nil, errors.New("Cursor does not match the requested sort order")
+	}
+
+	return &db.LinkCursor{Value: cursor.Value, ID: cursor.ID}, nil
+}
+
+// parseLinkListParams reads the filter, sort and pagination parameters of the
+// links of a task
+func parseLinkListParams(c *gin.Context) (db.LinkFilter, *db.LinkCursor, int, error) {
+	filter := db.LinkFilter{
+		LinkType:    c.Query("type"),
+		CheckStatus: c.Query("check_status"),
+		Host:        strings.TrimSpace(c.Query("host")),
+		PageURL:     c.Query("page_url"),
+		Query:       strings.TrimSpace(c.Query("q")),
+		Sort:        c.DefaultQuery("sort", "id"),
+	}
+
+	switch filter.LinkType {
+	case "", db.LinkTypeInternal, db.LinkTypeExternal:
+	default:
+		return filter, nil, 0, errors.New("Invalid type, expected internal or external")
+	}
+
+	switch filter.CheckStatus {
+	case "", db.LinkCheckStatusChecked, db.LinkCheckStatusSkipped, db.LinkCheckStatusDisallowed:
+	default:
+		return filter, nil, 0, errors.New("Invalid check_status, expected checked, skipped or disallowed")
+	}
+
+	if value := c.Query("accessible"); value != "" {
+		accessible, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, nil, 0, errors.New("Invalid accessible, expected true or false")
+		}
+		filter.Accessible = &accessible
+	}
+
+	for _, param := range c.QueryArray("status") {
+		for _, code := range strings.Split(param, ",") {
+			code = strings.ToLower(strings.TrimSpace(code))
+			if code == "" {
+				continue
+			}
+			if !validStatusFilter(code) {
+				return filter, nil, 0, fmt.Errorf("Invalid status %q, expected a class such as 4xx, a code such as 404 or none", code)
+			}
+			filter.StatusCodes = append(filter.StatusCodes, code)
+		}
+	}
+
+	if !slices.Contains(db.LinkSortFields(), filter.Sort) {
+		return filter, nil, 0, fmt.Errorf("Invalid sort field, expected one of: %s", strings.Join(db.LinkSortFields(), ", "))
+	}
+	switch strings.ToLower(c.DefaultQuery("order", "asc")) {
+	case "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, nil, 0, errors.New("Invalid order, expected asc or desc")
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLinkPageSize)))
+	if err != nil || limit < 1 || limit > maxLinkPageSize {
+		return filter, nil, 0, fmt.Errorf("Invalid limit, expected 1 to %d", maxLinkPageSize)
+	}
+
+	var cursor *db.LinkCursor
+	if value := c.Query("cursor"); value != "" {
+		if cursor, err = decodeLinkCursor(value, filter); err != nil {
+			return filter, nil, 0, err
+		}
+	}
+
+	return filter, cursor, limit, nil
+}
+
+// validStatusFilter reports whether code is a status class such as "4xx", a
+// status code or "none"
+func validStatusFilter(code string) bool {
+	if code == "none" {
+		return true
+	}
+	if len(code) == 3 && strings.HasSuffix(code, "xx") {
+		return code[0] >= '1' && code[0] <= '5'
+	}
+	n, err := strconv.Atoi(code)
+	return err == nil && n >= 100 && n <= 599
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"web-crawler/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLinkCursorRoundTrip(t *testing.T) {
+	code := 404
+	tests := []struct {
+		name   string
+		filter db.LinkFilter
+		link   *db.CrawlLink
+		value  string
+	}{
+		{"id", db.LinkFilter{Sort: "id"}, &db.CrawlLink{ID: 7}, "7"},
+		{"url descending", db.LinkFilter{Sort: "url", Descending: true}, &db.CrawlLink{ID: 3, URL: "https://example.com/a?b=c"}, "https://example.com/a?b=c"},
+		{"status code", db.LinkFilter{Sort: "status_code"}, &db.CrawlLink{ID: 5, StatusCode: &code}, "404"},
+		{"missing status code sorts as 0", db.LinkFilter{Sort: "status_code"}, &db.CrawlLink{ID: 9}, "0"},
+		{"response time", db.LinkFilter{Sort: "response_time"}, &db.CrawlLink{ID: 2, ResponseTimeMs: 120}, "120"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeLinkCursor(tt.filter, tt.filter.CursorFor(tt.link))
+			cursor, err := decodeLinkCursor(encoded, tt.filter)
+			if err != nil {
+				t.Fatalf("decodeLinkCursor: %v", err)
+			}
+			if cursor.Value != tt.value || cursor.ID != tt.link.ID {
+				t.Errorf("cursor = %+v, want value %q and ID %d", cursor, tt.value, tt.link.ID)
+			}
+		})
+	}
+}
+
+func TestDecodeLinkCursorErrors(t *testing.T) {
+	byStatus := db.LinkFilter{Sort: "status_code"}
+	valid := encodeLinkCursor(byStatus, db.LinkCursor{Value: "200", ID: 4})
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		value  string
+		filter db.LinkFilter
+		err    string
+	}{
+		{"not base64", "not base64!", byStatus, "Invalid cursor"},
+		{"not JSON", raw("nope"), byStatus, "Invalid cursor"},
+		{"missing ID", raw(`{"s":"status_code","v":"200"}`), byStatus, "Invalid cursor"},
+		{"other sort field", valid, db.LinkFilter{Sort: "url"}, "Cursor does not match the requested sort order"},
+		{"other direction", valid, db.LinkFilter{Sort: "status_code", Descending: true}, "Cursor does not match the requested sort order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeLinkCursor(tt.value, tt.filter)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseLinkListParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cursor := encodeLinkCursor(db.LinkFilter{Sort: "status_code", Descending: true}, db.LinkCursor{Value: "0", ID: 12})
+
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+		check   func(t *testing.T, filter db.LinkFilter, cursor *db.LinkCursor, limit int)
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			check: func(t *testing.T, filter db.LinkFilter, cursor *db.LinkCursor, limit int) {
+				if filter.Sort != "id" || filter.Descending || cursor != nil || limit != defaultLinkPageSize {
+					t.Errorf("got sort %q, descending %v, cursor %v, limit %d", filter.Sort, filter.Descending, cursor, limit)
+				}
+			},
+		},
+		{
+			name:  "status codes from several parameters",
+			query: "status=4xx,%20404&status=NONE",
+			check: func(t *testing.T, filter db.LinkFilter, _ *db.LinkCursor, _ int) {
+				want := []string{"4xx", "404", "none"}
+				if len(filter.StatusCodes) != len(want) {
+					t.Fatalf("status codes = %v, want %v", filter.StatusCodes, want)
+				}
+				for i := range want {
+					if filter.StatusCodes[i] != want[i] {
+						t.Errorf("status codes = %v, want %v", filter.StatusCodes, want)
+					}
+				}
+			},
+		},
+		{
+			name:  "cursor of the same sort",
+			query: "sort=status_code&order=DESC&cursor=" + cursor,
+			check: func(t *testing.T, filter db.LinkFilter, cursor *db.LinkCursor, _ int) {
+				if !filter.Descending || cursor == nil || cursor.Value != "0" || cursor.ID != 12 {
+					t.Errorf("got descending %v, cursor %+v", filter.Descending, cursor)
+				}
+			},
+		},
+		{name: "cursor of another order", query: "sort=status_code&cursor=" + cursor, wantErr: true},
+		{name: "unknown sort field", query: "sort=anchor_text", wantErr: true},
+		{name: "unknown order", query: "order=up", wantErr: true},
+		{name: "status class out of range", query: "status=6xx", wantErr: true},
+		{name: "limit too large", query: "limit=501", wantErr: true},
+		{name: "limit not a number", query: "limit=many", wantErr: true},
+		{name: "invalid accessible", query: "accessible=maybe", wantErr: true},
+		{name: "invalid type", query: "type=broken", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/links?"+tt.query, nil)
+
+			filter, cursor, limit, err := parseLinkListParams(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLinkListParams: %v", err)
+			}
+			tt.check(t, filter, cursor, limit)
+		})
+	}
+}
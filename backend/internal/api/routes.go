@@ -3,59 +3,173 @@ package api
 import (
 	"database/sql"
 	"web-crawler/internal/db"
+	"web-crawler/internal/events"
+	"web-crawler/internal/mail"
 	"web-crawler/internal/middleware"
 	"web-crawler/internal/queue"
-	"web-crawler/internal/websocket"
+	"web-crawler/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 // SetupRoutes configures all API routes
-func SetupRoutes(r *gin.Engine, database *sql.DB, taskQueue *queue.TaskQueue, wsHub *websocket.Hub, linkRepo *db.LinkRepository) {
+func SetupRoutes(r *gin.Engine, database *sql.DB, taskQueue *queue.TaskQueue, bus *events.Bus, linkRepo *db.LinkRepository, hooks *webhook.Dispatcher, mailer mail.Mailer) {
 	// Initialize repositories
 	userRepo := db.NewUserRepository(database)
 	taskRepo := db.NewTaskRepository(database)
 	resultRepo := db.NewResultRepository(database)
+	scheduleRepo := db.NewScheduleRepository(database)
+	statsRepo := db.NewStatsRepository(database)
+	webhookRepo := db.NewWebhookRepository(database)
+	deliveryRepo := db.NewDeliveryRepository(database)
+	tokenRepo := db.NewAPITokenRepository(database)
+	sessionRepo := db.NewSessionRepository(database)
+	userTokenRepo := db.NewUserTokenRepository(database)
+	workspaceRepo := db.NewWorkspaceRepository(database)
 
 	// Initialize handlers
-	authHandler := NewAuthHandler(userRepo)
-	crawlHandler := NewCrawlHandler(taskRepo, resultRepo, linkRepo, taskQueue, wsHub)
+	authHandler := NewAuthHandler(userRepo, sessionRepo, userTokenRepo, mailer)
+	crawlHandler := NewCrawlHandler(taskRepo, resultRepo, linkRepo, workspaceRepo, taskQueue, bus)
+	scheduleHandler := NewScheduleHandler(scheduleRepo, workspaceRepo)
+	statsHandler := NewStatsHandler(statsRepo, taskRepo, workspaceRepo)
+	workspaceHandler := NewWorkspaceHandler(workspaceRepo, userRepo, bus)
+	webhookHandler := NewWebhookHandler(webhookRepo, deliveryRepo, hooks)
+	tokenHandler := NewTokenHandler(tokenRepo)
+	adminHandler := NewAdminHandler(userRepo, taskRepo, sessionRepo, taskQueue)
+
+	// Scopes required from personal access tokens
+	read := middleware.RequireScope(db.ScopeRead)
+	write := middleware.RequireScope(db.ScopeCrawl)
+
+	authRequired := middleware.AuthMiddleware(sessionRepo, tokenRepo)
 
 	// API v1 group
 	v1 := r.Group("/api/v1")
 	{
-		// Authentication routes (no auth required)
+		// Authentication routes (no auth required unless noted)
 		auth := v1.Group("/auth")
 		{
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/refresh", authHandler.RefreshToken)
+			auth.POST("/logout", authHandler.Logout)
+			auth.POST("/reset-password", authHandler.RequestPasswordReset)
+			auth.POST("/reset-password/confirm", authHandler.ConfirmPasswordReset)
+			auth.POST("/verify-email", authHandler.VerifyEmail)
+			auth.POST("/resend-verification", authRequired, middleware.RequireSession(), authHandler.ResendVerification)
 		}
 
 		// Protected routes (auth required)
 		protected := v1.Group("/")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(authRequired)
 		{
 			// User routes
 			user := protected.Group("/user")
 			{
-				user.GET("/profile", authHandler.GetProfile)
-				user.PUT("/profile", authHandler.UpdateProfile)
+				user.GET("/profile", read, authHandler.GetProfile)
+				user.PUT("/profile", middleware.RequireSession(), authHandler.UpdateProfile)
+				user.PUT("/password", middleware.RequireSession(), authHandler.ChangePassword)
+				user.POST("/logout-all", middleware.RequireSession(), authHandler.LogoutAll)
 			}
 
 			// Crawl routes
 			crawl := protected.Group("/crawl")
 			{
-				crawl.POST("", crawlHandler.StartCrawl)
-				crawl.POST("/", crawlHandler.StartCrawl)
-				crawl.GET("", crawlHandler.GetUserTasks)
-				crawl.GET("/", crawlHandler.GetUserTasks)
-				crawl.GET("/:id", crawlHandler.GetTaskStatus)
-				crawl.PUT("/:id/stop", crawlHandler.StopCrawl)
-				crawl.GET("/:id/results", crawlHandler.GetResults)
-				crawl.DELETE("/:id", crawlHandler.DeleteTask)
-				crawl.GET("/:id/links", crawlHandler.GetLinks)
-				crawl.GET("/:id/export", crawlHandler.ExportResults)
+				crawl.POST("", write, crawlHandler.StartCrawl)
+				crawl.POST("/", write, crawlHandler.StartCrawl)
+				crawl.GET("", read, crawlHandler.GetUserTasks)
+				crawl.GET("/", read, crawlHandler.GetUserTasks)
+				crawl.POST("/bulk-delete", write, crawlHandler.BulkDelete)
+				crawl.POST("/bulk-rerun", write, crawlHandler.BulkRerun)
+				crawl.POST("/bulk-stop", write, crawlHandler.BulkStop)
+				crawl.POST("/bulk-export", read, crawlHandler.BulkExport)
+				crawl.GET("/history", read, crawlHandler.GetHistory)
+				crawl.GET("/compare", read, crawlHandler.CompareTasks)
+				crawl.GET("/:id", read, crawlHandler.GetTaskStatus)
+				crawl.PUT("/:id/stop", write, crawlHandler.StopCrawl)
+				crawl.POST("/:id/rerun", write, crawlHandler.RerunTask)
+				crawl.GET("/:id/results", read, crawlHandler.GetResults)
+				crawl.GET("/:id/pages", read, crawlHandler.GetPages)
+				crawl.GET("/:id/events", read, crawlHandler.StreamEvents)
+				crawl.GET("/:id/stats", read, statsHandler.GetTaskStats)
+				crawl.DELETE("/:id", write, crawlHandler.DeleteTask)
+				crawl.POST("/:id/restore", write, crawlHandler.RestoreTask)
+				crawl.GET("/:id/links", read, crawlHandler.GetLinks)
+				crawl.GET("/:id/export", read, crawlHandler.ExportResults)
+			}
+
+			// Workspace routes
+			workspaces := protected.Group("/workspaces")
+			{
+				workspaces.GET("", read, workspaceHandler.ListWorkspaces)
+				workspaces.GET("/", read, workspaceHandler.ListWorkspaces)
+				workspaces.POST("", write, workspaceHandler.CreateWorkspace)
+				workspaces.POST("/", write, workspaceHandler.CreateWorkspace)
+				workspaces.GET("/:id", read, workspaceHandler.GetWorkspace)
+				workspaces.PUT("/:id", write, workspaceHandler.UpdateWorkspace)
+				workspaces.DELETE("/:id", write, workspaceHandler.DeleteWorkspace)
+				workspaces.GET("/:id/members", read, workspaceHandler.ListMembers)
+				workspaces.POST("/:id/members", write, workspaceHandler.AddMember)
+				workspaces.PUT("/:id/members/:user_id", write, workspaceHandler.UpdateMember)
+				workspaces.DELETE("/:id/members/:user_id", write, workspaceHandler.RemoveMember)
+			}
+
+			// Stats routes
+			stats := protected.Group("/stats")
+			{
+				stats.GET("", read, statsHandler.GetStats)
+				stats.GET("/", read, statsHandler.GetStats)
+				stats.GET("/user", read, statsHandler.GetUserStats)
+			}
+
+			// Schedule routes
+			schedules := protected.Group("/schedules")
+			{
+				schedules.GET("", read, scheduleHandler.ListSchedules)
+				schedules.GET("/", read, scheduleHandler.ListSchedules)
+				schedules.POST("", write, scheduleHandler.CreateSchedule)
+				schedules.POST("/", write, scheduleHandler.CreateSchedule)
+				schedules.GET("/:id", read, scheduleHandler.GetSchedule)
+				schedules.PUT("/:id", write, scheduleHandler.UpdateSchedule)
+				schedules.DELETE("/:id", write, scheduleHandler.DeleteSchedule)
+			}
+
+			// Webhook routes
+			webhooks := protected.Group("/webhooks")
+			{
+				webhooks.GET("", read, webhookHandler.ListWebhooks)
+				webhooks.GET("/", read, webhookHandler.ListWebhooks)
+				webhooks.POST("", write, webhookHandler.CreateWebhook)
+				webhooks.POST("/", write, webhookHandler.CreateWebhook)
+				webhooks.GET("/:id", read, webhookHandler.GetWebhook)
+				webhooks.PUT("/:id", write, webhookHandler.UpdateWebhook)
+				webhooks.DELETE("/:id", write, webhookHandler.DeleteWebhook)
+				webhooks.GET("/:id/deliveries", read, webhookHandler.ListDeliveries)
+				webhooks.POST("/:id/test", write, webhookHandler.TestWebhook)
+			}
+
+			// Personal access token routes, only usable when logged in
+			tokens := protected.Group("/tokens")
+			tokens.Use(middleware.RequireSession())
+			{
+				tokens.GET("", tokenHandler.ListTokens)
+				tokens.GET("/", tokenHandler.ListTokens)
+				tokens.POST("", tokenHandler.CreateToken)
+				tokens.POST("/", tokenHandler.CreateToken)
+				tokens.DELETE("/:id", tokenHandler.RevokeToken)
+			}
+
+			// Admin routes
+			admin := protected.Group("/admin")
+			admin.Use(middleware.RequireRole(db.RoleAdmin), middleware.RequireScope(db.ScopeAdmin))
+			{
+				admin.GET("/users", adminHandler.ListUsers)
+				admin.GET("/users/:id", adminHandler.GetUser)
+				admin.PUT("/users/:id/role", adminHandler.UpdateUserRole)
+				admin.POST("/users/:id/disable", adminHandler.DisableUser)
+				admin.POST("/users/:id/enable", adminHandler.EnableUser)
+				admin.GET("/tasks", adminHandler.ListTasks)
+				admin.POST("/tasks/:id/cancel", adminHandler.CancelTask)
 			}
 		}
 	}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"web-crawler/internal/db"
+	"web-crawler/internal/middleware"
+	"web-crawler/internal/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSchedulesPerUser limits how many schedules a user may create
+const maxSchedulesPerUser = 100
+
+// ScheduleHandler handles requests for recurring crawl schedules
+type ScheduleHandler struct {
+	scheduleRepo *db.ScheduleRepository
+	access       *workspaceAuthorizer
+}
+
+// NewScheduleHandler creates a new schedule handler
+func NewScheduleHandler(scheduleRepo *db.ScheduleRepository, workspaceRepo *db.WorkspaceRepository) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleRepo: scheduleRepo,
+		access:       newWorkspaceAuthorizer(workspaceRepo),
+	}
+}
+
+// ScheduleRequest represents the request to create or replace a schedule.
+// Exactly one of Cron, a five-field cron expression, and IntervalSeconds
+// must be set. Both are evaluated in Timezone, an IANA time zone name that
+// defaults to UTC. MissedRunPolicy decides whether runs missed while the
+// server was down are caught up with a single run or skipped. WorkspaceID
+// picks the workspace of a new schedule, the personal one by default, and is
+// ignored when a schedule is replaced.
+type ScheduleRequest struct {
+	Name        string `json:"name" binding:"max=255"`
+	URL         string `json:"url" binding:"required,url,max=2048"`
+	WorkspaceID int    `json:"workspace_id" binding:"min=0"`
+	CrawlOptions
+	Cron            string `json:"cron" binding:"max=255"`
+	IntervalSeconds int    `json:"interval_seconds" binding:"min=0"`
+	Timezone        string `json:"timezone" binding:"max=64"`
+	Enabled         *bool  `json:"enabled"`
+	MissedRunPolicy string `json:"missed_run_policy" binding:"omitempty,oneof=run_once skip"`
+}
+
+// ListSchedules retrieves the schedules of the workspaces of the
+// authenticated user, or of the one given as workspace_id, with pagination
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	workspaceID, ok := h.access.workspaceParam(c)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.scheduleRepo.List(c.Request.Context(), userID.(int), workspaceID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve schedules",
+		})
+		return
+	}
+
+	total, err := h.scheduleRepo.Count(c.Request.Context(), userID.(int), workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve schedules",
+		})
+		return
+	}
+
+	if schedules == nil {
+		schedules = []*db.CrawlSchedule{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+	})
+}
+
+// CreateSchedule creates a new crawl schedule
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	workspaceID, ok := h.access.target(c, req.WorkspaceID)
+	if !ok {
+		return
+	}
+
+	count, err := h.scheduleRepo.CountByUserID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create schedule",
+		})
+		return
+	}
+	if count >= maxSchedulesPerUser {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Schedule limit reached, delete a schedule before creating another",
+		})
+		return
+	}
+
+	schedule := &db.CrawlSchedule{UserID: userID.(int), WorkspaceID: workspaceID, Enabled: true}
+	if !h.applyRequest(c, schedule, &req) {
+		return
+	}
+
+	if err := h.scheduleRepo.Create(c.Request.Context(), schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create schedule",
+		})
+		return
+	}
+
+	created, err := h.scheduleRepo.GetByID(c.Request.Context(), schedule.ID)
+	if err != nil || created == nil {
+		c.JSON(http.StatusCreated, schedule)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetSchedule retrieves a single schedule
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c, accessView)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule replaces the settings of a schedule. Its next run is
+// computed again from now, so runs missed while it was disabled never happen.
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c, accessEdit)
+	if !ok {
+		return
+	}
+
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if !h.applyRequest(c, schedule, &req) {
+		return
+	}
+
+	if err := h.scheduleRepo.Update(c.Request.Context(), schedule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update schedule",
+		})
+		return
+	}
+
+	updated, err := h.scheduleRepo.GetByID(c.Request.Context(), schedule.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusOK, schedule)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteSchedule deletes a schedule. Crawl tasks it already started are kept.
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	schedule, ok := h.loadSchedule(c, accessEdit)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleRepo.Delete(c.Request.Context(), schedule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete schedule",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Schedule deleted successfully",
+	})
+}
+
+// loadSchedule loads the schedule named by the id parameter and checks that
+// the authenticated user has the access level in its workspace, writing the
+// error response otherwise
+func (h *ScheduleHandler) loadSchedule(c *gin.Context, access workspaceAccess) (*db.CrawlSchedule, bool) {
+	scheduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid schedule ID",
+		})
+		return nil, false
+	}
+
+	schedule, err := h.scheduleRepo.GetByID(c.Request.Context(), scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve schedule",
+		})
+		return nil, false
+	}
+
+	if schedule == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Schedule not found",
+		})
+		return nil, false
+	}
+
+	if !h.access.authorizeSchedule(c, schedule, access) {
+		return nil, false
+	}
+
+	return schedule, true
+}
+
+// applyRequest validates a schedule request and copies it into schedule,
+// computing the next run when the schedule is enabled. It writes the error
+// response and returns false when the request is invalid.
+func (h *ScheduleHandler) applyRequest(c *gin.Context, schedule *db.CrawlSchedule, req *ScheduleRequest) bool {
+	if req.IgnoreRobots && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only admins can ignore robots.txt",
+		})
+		return false
+	}
+
+	interval := time.Duration(req.IntervalSeconds) * time.Second
+	spec, err := scheduler.ParseSpec(req.Cron, interval, req.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid schedule: " + err.Error(),
+		})
+		return false
+	}
+
+	enabled := schedule.Enabled
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	var nextRunAt *time.Time
+	if enabled {
+		now := time.Now()
+		next := scheduler.NextRun(spec, now, now)
+		if next.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid schedule: the cron expression never matches",
+			})
+			return false
+		}
+		nextRunAt = &next
+	}
+
+	schedule.Name = req.Name
+	schedule.URL = req.URL
+	schedule.CrawlMode, schedule.MaxDepth, schedule.MaxPages, schedule.CrawlScope = req.settings()
+	schedule.IgnoreRobots = req.IgnoreRobots
+	schedule.CronExpr = nil
+	schedule.IntervalSeconds = nil
+	if req.Cron != "" {
+		schedule.CronExpr = &req.Cron
+	} else {
+		schedule.IntervalSeconds = &req.IntervalSeconds
+	}
+	schedule.Timezone = req.Timezone
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	schedule.Enabled = enabled
+	schedule.MissedRunPolicy = req.MissedRunPolicy
+	if schedule.MissedRunPolicy == "" {
+		schedule.MissedRunPolicy = db.MissedRunRunOnce
+	}
+	schedule.NextRunAt = nextRunAt
+
+	return true
+}
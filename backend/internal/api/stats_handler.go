@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"web-crawler/internal/db"
+	"web-crawler/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of the stats endpoints
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+	statsTopDomains  = 10
+	statsTopHosts    = 20
+)
+
+// StatsHandler handles requests for dashboard statistics
+type StatsHandler struct {
+	statsRepo *db.StatsRepository
+	taskRepo  *db.TaskRepository
+	access    *workspaceAuthorizer
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(statsRepo *db.StatsRepository, taskRepo *db.TaskRepository, workspaceRepo *db.WorkspaceRepository) *StatsHandler {
+	return &StatsHandler{
+		statsRepo: statsRepo,
+		taskRepo:  taskRepo,
+		access:    newWorkspaceAuthorizer(workspaceRepo),
+	}
+}
+
+// GetStats retrieves statistics over the crawl tasks of every user. Since it
+// reveals what other users crawl, it is only available to admins.
+func (h *StatsHandler) GetStats(c *gin.Context) {
+	if !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only admins can view service-wide statistics",
+		})
+		return
+	}
+
+	since, ok := statsSince(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.statsRepo.GlobalStats(c.Request.Context(), since, statsTopDomains)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to compute statistics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetUserStats retrieves statistics over the crawl tasks of the workspaces of
+// the authenticated user. The days parameter sets how many days the broken
+// links series covers.
+func (h *StatsHandler) GetUserStats(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	since, ok := statsSince(c)
+	if !ok {
+		return
+	}
+
+	stats, err := h.statsRepo.UserStats(c.Request.Context(), userID.(int), since, statsTopDomains)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to compute statistics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetTaskStats breaks down the pages and links of a crawl task by status
+// code class and host
+func (h *StatsHandler) GetTaskStats(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid task ID",
+		})
+		return
+	}
+
+	task, err := h.taskRepo.GetByID(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve task",
+		})
+		return
+	}
+
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Task not found",
+		})
+		return
+	}
+
+	if !h.access.authorizeTask(c, task, accessView) {
+		return
+	}
+
+	stats, err := h.statsRepo.TaskStats(c.Request.Context(), taskID, statsTopHosts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to compute statistics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// statsSince returns the start of the first day covered by the days
+// parameter, writing the error response when it is invalid
+func statsSince(c *gin.Context) (time.Time, bool) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultStatsDays)))
+	if err != nil || days < 1 || days > maxStatsDays {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid days, expected 1 to " + strconv.Itoa(maxStatsDays),
+		})
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	return today.AddDate(0, 0, -(days - 1)), true
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+	"web-crawler/internal/auth"
+	"web-crawler/internal/db"
+	"web-crawler/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTokensPerUser limits how many active tokens a user may hold
+const maxTokensPerUser = 50
+
+// tokenScopes lists the scopes a token can be granted
+var tokenScopes = []string{db.ScopeRead, db.ScopeCrawl, db.ScopeAdmin}
+
+// TokenHandler handles requests for personal access tokens
+type TokenHandler struct {
+	tokenRepo *db.APITokenRepository
+}
+
+// NewTokenHandler creates a new token handler
+func NewTokenHandler(tokenRepo *db.APITokenRepository) *TokenHandler {
+	return &TokenHandler{
+		tokenRepo: tokenRepo,
+	}
+}
+
+// CreateTokenRequest represents the request to create a personal access
+// token. A token without ExpiresInDays never expires.
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+}
+
+// CreateTokenResponse is a new token along with its value, which is never
+// shown again
+type CreateTokenResponse struct {
+	*db.APIToken
+	Token string `json:"token"`
+}
+
+// ListTokens retrieves the tokens of the authenticated user that are not
+// revoked, and the scopes the user can grant
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	tokens, err := h.tokenRepo.GetByUserID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve tokens",
+		})
+		return
+	}
+
+	if tokens == nil {
+		tokens = []*db.APIToken{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"scopes": db.RoleScopes(middleware.Role(c)),
+	})
+}
+
+// CreateToken creates a personal access token for the authenticated user.
+// Tokens can only be granted the scopes of the user's role.
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(tokenScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Unknown token scope: " + scope,
+				"scopes": tokenScopes,
+			})
+			return
+		}
+		if !middleware.HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your role cannot grant the token scope: " + scope,
+			})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	count, err := h.tokenRepo.CountActiveByUserID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create token",
+		})
+		return
+	}
+	if count >= maxTokensPerUser {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Token limit reached, revoke a token before creating another",
+		})
+		return
+	}
+
+	value, prefix, hash, err := auth.GenerateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate token",
+		})
+		return
+	}
+
+	token := &db.APIToken{
+		UserID: userID.(int),
+		Name:   req.Name,
+		Prefix: prefix,
+		Hash:   hash,
+		Scopes: scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.tokenRepo.Create(c.Request.Context(), token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create token",
+		})
+		return
+	}
+
+	created, err := h.tokenRepo.GetByID(c.Request.Context(), token.ID)
+	if err != nil || created == nil {
+		created = token
+	}
+	c.JSON(http.StatusCreated, CreateTokenResponse{APIToken: created, Token: value})
+}
+
+// RevokeToken revokes a token of the authenticated user
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	tokenID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid token ID",
+		})
+		return
+	}
+
+	token, err := h.tokenRepo.GetByID(c.Request.Context(), tokenID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve token",
+		})
+		return
+	}
+
+	if token == nil || token.RevokedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Token not found",
+		})
+		return
+	}
+
+	// Check if user owns this token
+	if token.UserID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+		return
+	}
+
+	if err := h.tokenRepo.Revoke(c.Request.Context(), token.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to revoke token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Token revoked successfully",
+	})
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"web-crawler/internal/db"
+	"web-crawler/internal/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhooksPerUser limits how many webhooks a user may own
+const maxWebhooksPerUser = 20
+
+// WebhookHandler handles requests for webhook subscriptions
+type WebhookHandler struct {
+	webhookRepo  *db.WebhookRepository
+	deliveryRepo *db.DeliveryRepository
+	hooks        *webhook.Dispatcher
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookRepo *db.WebhookRepository, deliveryRepo *db.DeliveryRepository, hooks *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		webhookRepo:  webhookRepo,
+		deliveryRepo: deliveryRepo,
+		hooks:        hooks,
+	}
+}
+
+// WebhookRequest represents the request to create or replace a webhook.
+// Secret signs the deliveries; a random one is generated when it is empty on
+// creation or when RotateSecret is set.
+type WebhookRequest struct {
+	URL          string   `json:"url" binding:"required,url,max=2048"`
+	Events       []string `json:"events" binding:"required,min=1"`
+	Description  string   `json:"description" binding:"max=255"`
+	Enabled      *bool    `json:"enabled"`
+	Secret       string   `json:"secret" binding:"omitempty,min=16,max=255"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+// WebhookResponse is a webhook along with its secret, which is only shown
+// when it is set
+type WebhookResponse struct {
+	*db.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// ListWebhooks retrieves the webhooks of the authenticated user and the events
+// they can subscribe to
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	webhooks, err := h.webhookRepo.GetByUserID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve webhooks",
+		})
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = []*db.Webhook{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhooks,
+		"events":   webhook.Events(),
+	})
+}
+
+// CreateWebhook creates a new webhook. The response is the only one that
+// includes a generated secret.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	count, err := h.webhookRepo.CountByUserID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create webhook",
+		})
+		return
+	}
+	if count >= maxWebhooksPerUser {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Webhook limit reached, delete a webhook before creating another",
+		})
+		return
+	}
+
+	hook := &db.Webhook{UserID: userID.(int), Enabled: true}
+	// New webhooks always get a secret
+	if req.Secret == "" {
+		req.RotateSecret = true
+	}
+	secret, ok := h.applyWebhookRequest(c, hook, &req)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookRepo.Create(c.Request.Context(), hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create webhook",
+		})
+		return
+	}
+
+	h.respond(c, http.StatusCreated, hook, secret)
+}
+
+// GetWebhook retrieves a single webhook
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, hook)
+}
+
+// UpdateWebhook replaces the settings of a webhook. The secret is kept
+// unless a new one is given or rotation is requested.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	secret, ok := h.applyWebhookRequest(c, hook, &req)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookRepo.Update(c.Request.Context(), hook); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update webhook",
+		})
+		return
+	}
+
+	h.respond(c, http.StatusOK, hook, secret)
+}
+
+// DeleteWebhook deletes a webhook and its delivery log
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookRepo.Delete(c.Request.Context(), hook.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete webhook",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// ListDeliveries retrieves the delivery log of a webhook with pagination,
+// newest first
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	deliveries, err := h.deliveryRepo.GetByWebhookID(c.Request.Context(), hook.ID, limit, (page-1)*limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve deliveries",
+		})
+		return
+	}
+
+	total, err := h.deliveryRepo.CountByWebhookID(c.Request.Context(), hook.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve deliveries",
+		})
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []*db.WebhookDelivery{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"page":       page,
+		"limit":      limit,
+		"total":      total,
+	})
+}
+
+// TestWebhook sends a ping event to a webhook and returns the delivery with
+// the response received, whether or not the webhook is enabled
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	hook, ok := h.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.hooks.SendTest(c.Request.Context(), hook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to send test event",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// respond writes a saved webhook, reloaded to pick up its timestamps, along
+// with its secret when it was just set
+func (h *WebhookHandler) respond(c *gin.Context, status int, hook *db.Webhook, secret string) {
+	saved, err := h.webhookRepo.GetByID(c.Request.Context(), hook.ID)
+	if err != nil || saved == nil {
+		saved = hook
+	}
+	c.JSON(status, WebhookResponse{Webhook: saved, Secret: secret})
+}
+
+// loadWebhook loads the webhook named by the id parameter and checks that the
+// authenticated user owns it, writing the error response otherwise
+func (h *WebhookHandler) loadWebhook(c *gin.Context) (*db.Webhook, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return nil, false
+	}
+
+	webhookID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid webhook ID",
+		})
+		return nil, false
+	}
+
+	hook, err := h.webhookRepo.GetByID(c.Request.Context(), webhookID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve webhook",
+		})
+		return nil, false
+	}
+
+	if hook == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Webhook not found",
+		})
+		return nil, false
+	}
+
+	// Check if user owns this webhook
+	if hook.UserID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Access denied",
+		})
+		return nil, false
+	}
+
+	return hook, true
+}
+
+// applyWebhookRequest validates a webhook request and copies it into hook. It
+// returns the new secret when the request set one, and writes the error
+// response and returns false when the request is invalid.
+func (h *WebhookHandler) applyWebhookRequest(c *gin.Context, hook *db.Webhook, req *WebhookRequest) (string, bool) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Webhook URL must be an http or https URL",
+		})
+		return "", false
+	}
+	if err := h.hooks.CheckURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Webhook URL must not point to a local or private address",
+		})
+		return "", false
+	}
+
+	var events []string
+	for _, event := range req.Events {
+		if !webhook.IsEvent(event) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Unknown webhook event: " + event,
+				"events": webhook.Events(),
+			})
+			return "", false
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" && req.RotateSecret {
+		secret, err = webhook.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to generate webhook secret",
+			})
+			return "", false
+		}
+	}
+
+	hook.URL = req.URL
+	hook.Events = events
+	hook.Description = req.Description
+	if req.Enabled != nil {
+		hook.Enabled = *req.Enabled
+	}
+	if secret != "" {
+		hook.Secret = secret
+	}
+
+	return secret, true
+}
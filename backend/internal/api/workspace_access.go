@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"web-crawler/internal/db"
+
+	"github.com/gin-gonic/gin"
+)
+
+// workspaceAccess is what a request needs to be allowed to do in a workspace
+type workspaceAccess int
+
+// Workspace access levels, from the least to the most privileged
+const (
+	// accessView reads the tasks and schedules of a workspace
+	accessView workspaceAccess = iota
+	// accessEdit starts, stops, reruns and deletes tasks and manages schedules
+	accessEdit
+	// accessManage renames and deletes the workspace and manages its members
+	accessManage
+)
+
+// allows reports whether a workspace role grants the access level
+func (a workspaceAccess) allows(role string) bool {
+	switch role {
+	case db.WorkspaceRoleOwner:
+		return true
+	case db.WorkspaceRoleEditor:
+		return a <= accessEdit
+	case db.WorkspaceRoleViewer:
+		return a == accessView
+	default:
+		return false
+	}
+}
+
+// Messages of the responses refusing workspace access
+const (
+	errAccessDenied        = "Access denied"
+	errWorkspaceRoleTooLow = "Your workspace role does not allow this action"
+)
+
+// workspaceRolesKey is the context key of the workspace roles of the
+// authenticated user looked up during a request
+const workspaceRolesKey = "workspace_roles"
+
+// workspaceAuthorizer decides what the authenticated user may do with the
+// workspaces, tasks and schedules a request names. It is the single place
+// handlers check access to shared crawl data.
+type workspaceAuthorizer struct {
+	workspaceRepo *db.WorkspaceRepository
+}
+
+// newWorkspaceAuthorizer creates a new workspace authorizer
+func newWorkspaceAuthorizer(workspaceRepo *db.WorkspaceRepository) *workspaceAuthorizer {
+	return &workspaceAuthorizer{workspaceRepo: workspaceRepo}
+}
+
+// role returns the role of the authenticated user in a workspace, or an empty
+// string if they are not a member. Roles are remembered for the rest of the
+// request, so bulk actions look each workspace up once.
+func (a *workspaceAuthorizer) role(c *gin.Context, workspaceID int) (string, error) {
+	roles, _ := c.Get(workspaceRolesKey)
+	cache, ok := roles.(map[int]string)
+	if !ok {
+		cache = make(map[int]string)
+		c.Set(workspaceRolesKey, cache)
+	}
+	if role, ok := cache[workspaceID]; ok {
+		return role, nil
+	}
+
+	role, err := a.workspaceRepo.GetRole(c.Request.Context(), workspaceID, c.GetInt("user_id"))
+	if err != nil {
+		return "", err
+	}
+	cache[workspaceID] = role
+	return role, nil
+}
+
+// denied returns why the authenticated user lacks the access level in a
+// workspace, or an empty string if they have it
+func (a *workspaceAuthorizer) denied(c *gin.Context, workspaceID int, access workspaceAccess) (string, error) {
+	role, err := a.role(c, workspaceID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return errAccessDenied, nil
+	}
+	if !access.allows(role) {
+		return errWorkspaceRoleTooLow, nil
+	}
+	return "", nil
+}
+
+// authorize checks that the authenticated user has the access level in a
+// workspace, writing the error response when they do not
+func (a *workspaceAuthorizer) authorize(c *gin.Context, workspaceID int, access workspaceAccess) bool {
+	reason, err := a.denied(c, workspaceID, access)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to check workspace access",
+		})
+		return false
+	}
+	if reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": reason,
+		})
+		return false
+	}
+	return true
+}
+
+// authorizeTask checks access to the workspace of a task
+func (a *workspaceAuthorizer) authorizeTask(c *gin.Context, task *db.CrawlTask, access workspaceAccess) bool {
+	return a.authorize(c, task.WorkspaceID, access)
+}
+
+// authorizeSchedule checks access to the workspace of a schedule
+func (a *workspaceAuthorizer) authorizeSchedule(c *gin.Context, schedule *db.CrawlSchedule, access workspaceAccess) bool {
+	return a.authorize(c, schedule.WorkspaceID, access)
+}
+
+// target returns the workspace new tasks or schedules go to: the given one,
+// or the personal workspace of the authenticated user when workspaceID is 0.
+// The user needs edit access to it; the error response is written otherwise.
+func (a *workspaceAuthorizer) target(c *gin.Context, workspaceID int) (int, bool) {
+	if workspaceID == 0 {
+		var ok bool
+		if workspaceID, ok = a.personal(c); !ok {
+			return 0, false
+		}
+	}
+
+	if !a.authorize(c, workspaceID, accessEdit) {
+		return 0, false
+	}
+	return workspaceID, true
+}
+
+// personal returns the ID of the personal workspace of the authenticated
+// user, writing the error response when it cannot be loaded
+func (a *workspaceAuthorizer) personal(c *gin.Context) (int, bool) {
+	workspace, err := a.workspaceRepo.GetPersonal(c.Request.Context(), c.GetInt("user_id"))
+	if err != nil || workspace == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve personal workspace",
+		})
+		return 0, false
+	}
+	return workspace.ID, true
+}
+
+// workspaceParam reads the optional workspace_id query parameter, which
+// narrows a list down to one workspace the authenticated user can view. It
+// returns 0 when the parameter is not set.
+func (a *workspaceAuthorizer) workspaceParam(c *gin.Context) (int, bool) {
+	workspaceID, ok := idQuery(c, "workspace_id", "Invalid workspace ID")
+	if !ok || workspaceID == 0 {
+		return 0, ok
+	}
+
+	if !a.authorize(c, workspaceID, accessView) {
+		return 0, false
+	}
+	return workspaceID, true
+}
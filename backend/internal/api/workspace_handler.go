@@ -0,0 +1,544 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"web-crawler/internal/db"
+	"web-crawler/internal/events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWorkspacesPerUser limits how many shared workspaces a user may own
+const maxWorkspacesPerUser = 20
+
+// WorkspaceHandler handles requests for workspaces and their members
+type WorkspaceHandler struct {
+	workspaceRepo *db.WorkspaceRepository
+	userRepo      *db.UserRepository
+	bus           *events.Bus
+	access        *workspaceAuthorizer
+}
+
+// NewWorkspaceHandler creates a new workspace handler
+func NewWorkspaceHandler(workspaceRepo *db.WorkspaceRepository, userRepo *db.UserRepository, bus *events.Bus) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		workspaceRepo: workspaceRepo,
+		userRepo:      userRepo,
+		bus:           bus,
+		access:        newWorkspaceAuthorizer(workspaceRepo),
+	}
+}
+
+// WorkspaceRequest represents the request to create or rename a workspace
+type WorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// AddMemberRequest represents the request to add a user to a workspace
+type AddMemberRequest struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// UpdateMemberRequest represents the request to change the role of a member
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// WorkspaceResponse is a workspace along with its members
+type WorkspaceResponse struct {
+	*db.Workspace
+	Members []*db.WorkspaceMember `json:"members"`
+}
+
+// ListWorkspaces retrieves the workspaces of the authenticated user, their
+// personal workspace first
+func (h *WorkspaceHandler) ListWorkspaces(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	workspaces, err := h.workspaceRepo.GetByUserID(c.Request.Context(), userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve workspaces",
+		})
+		return
+	}
+
+	if workspaces == nil {
+		workspaces = []*db.Workspace{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspaces": workspaces,
+		"roles":      db.WorkspaceRoles,
+	})
+}
+
+// CreateWorkspace creates a shared workspace owned by the authenticated user
+func (h *WorkspaceHandler) CreateWorkspace(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "User not authenticated",
+		})
+		return
+	}
+
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	name, ok := workspaceName(c, req.Name)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	count, err := h.workspaceRepo.CountOwnedByUserID(ctx, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create workspace",
+		})
+		return
+	}
+	if count >= maxWorkspacesPerUser {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Workspace limit reached, delete a workspace before creating another",
+		})
+		return
+	}
+
+	workspace := &db.Workspace{Name: name}
+	if err := h.workspaceRepo.Create(ctx, workspace, userID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create workspace",
+		})
+		return
+	}
+
+	created, err := h.workspaceRepo.GetByID(ctx, workspace.ID)
+	if err != nil || created == nil {
+		created = workspace
+	}
+	created.Role = db.WorkspaceRoleOwner
+	created.MemberCount = 1
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetWorkspace retrieves a workspace and its members
+func (h *WorkspaceHandler) GetWorkspace(c *gin.Context) {
+	workspace, ok := h.loadWorkspace(c, accessView)
+	if !ok {
+		return
+	}
+
+	members, err := h.workspaceRepo.ListMembers(c.Request.Context(), workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve members",
+		})
+		return
+	}
+
+	if members == nil {
+		members = []*db.WorkspaceMember{}
+	}
+	workspace.MemberCount = len(members)
+
+	c.JSON(http.StatusOK, WorkspaceResponse{Workspace: workspace, Members: members})
+}
+
+// UpdateWorkspace renames a workspace
+func (h *WorkspaceHandler) UpdateWorkspace(c *gin.Context) {
+	workspace, ok := h.loadWorkspace(c, accessManage)
+	if !ok {
+		return
+	}
+
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	name, ok := workspaceName(c, req.Name)
+	if !ok {
+		return
+	}
+
+	if err := h.workspaceRepo.Rename(c.Request.Context(), workspace.ID, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update workspace",
+		})
+		return
+	}
+
+	workspace.Name = name
+	c.JSON(http.StatusOK, workspace)
+}
+
+// DeleteWorkspace deletes a shared workspace together with its crawl tasks
+// and schedules. Workspaces with pending or running tasks cannot be deleted,
+// and neither can personal workspaces.
+func (h *WorkspaceHandler) DeleteWorkspace(c *gin.Context) {
+	workspace, ok := h.loadWorkspace(c, accessManage)
+	if !ok {
+		return
+	}
+
+	if workspace.Personal() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Personal workspaces cannot be deleted",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	active, err := h.workspaceRepo.CountActiveTasks(ctx, workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete workspace",
+		})
+		return
+	}
+	if active > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Workspace has running crawl tasks, stop them before deleting it",
+		})
+		return
+	}
+
+	if err := h.workspaceRepo.Delete(ctx, workspace.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete workspace",
+		})
+		return
+	}
+	h.bus.ForgetMembers(workspace.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Workspace deleted successfully",
+	})
+}
+
+// ListMembers retrieves the members of a workspace, owners first
+func (h *WorkspaceHandler) ListMembers(c *gin.Context) {
+	workspace, ok := h.loadWorkspace(c, accessView)
+	if !ok {
+		return
+	}
+
+	members, err := h.workspaceRepo.ListMembers(c.Request.Context(), workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve members",
+		})
+		return
+	}
+
+	if members == nil {
+		members = []*db.WorkspaceMember{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": members,
+	})
+}
+
+// AddMember adds a user, found by username, to a shared workspace. New
+// members are editors unless another role is given.
+func (h *WorkspaceHandler) AddMember(c *gin.Context) {
+	workspace, ok := h.loadWorkspace(c, accessManage)
+	if !ok {
+		return
+	}
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = db.WorkspaceRoleEditor
+	}
+	if !validWorkspaceRole(c, req.Role) {
+		return
+	}
+
+	if workspace.Personal() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Personal workspaces cannot be shared",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.userRepo.GetByUsername(ctx, strings.TrimSpace(req.Username))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve user",
+		})
+		return
+	}
+	if user == nil || user.DisabledAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	added, err := h.workspaceRepo.AddMember(ctx, workspace.ID, user.ID, req.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to add member",
+		})
+		return
+	}
+	if !added {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "User is already a member of this workspace",
+		})
+		return
+	}
+	h.bus.ForgetMembers(workspace.ID)
+
+	h.respondMember(c, http.StatusCreated, workspace.ID, user.ID)
+}
+
+// UpdateMember changes the role of a member of a workspace. The last owner
+// cannot give up ownership.
+func (h *WorkspaceHandler) UpdateMember(c *gin.Context) {
+	workspace, ok := h.loadWorkspace(c, accessManage)
+	if !ok {
+		return
+	}
+
+	memberID, role, ok := h.loadMember(c, workspace)
+	if !ok {
+		return
+	}
+
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request format",
+		})
+		return
+	}
+
+	if !validWorkspaceRole(c, req.Role) {
+		return
+	}
+
+	if role == db.WorkspaceRoleOwner && req.Role != db.WorkspaceRoleOwner && !h.hasOtherOwner(c, workspace) {
+		return
+	}
+
+	if req.Role != role {
+		if err := h.workspaceRepo.UpdateMemberRole(c.Request.Context(), workspace.ID, memberID, req.Role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update member",
+			})
+			return
+		}
+	}
+
+	h.respondMember(c, http.StatusOK, workspace.ID, memberID)
+}
+
+// RemoveMember removes a member from a workspace. Owners can remove anyone,
+// and every member can remove themselves to leave the workspace. The last
+// owner cannot leave. The schedules the member created in the workspace are
+// disabled, and webhooks about its tasks are no longer sent to them.
+func (h *WorkspaceHandler) RemoveMember(c *gin.Context) {
+	access := accessManage
+	if c.Param("user_id") == strconv.Itoa(c.GetInt("user_id")) {
+		access = accessView
+	}
+
+	workspace, ok := h.loadWorkspace(c, access)
+	if !ok {
+		return
+	}
+
+	memberID, role, ok := h.loadMember(c, workspace)
+	if !ok {
+		return
+	}
+
+	if workspace.Personal() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Personal workspaces cannot be left",
+		})
+		return
+	}
+
+	if role == db.WorkspaceRoleOwner && !h.hasOtherOwner(c, workspace) {
+		return
+	}
+
+	if err := h.workspaceRepo.RemoveMember(c.Request.Context(), workspace.ID, memberID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to remove member",
+		})
+		return
+	}
+	h.bus.ForgetMembers(workspace.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member removed successfully",
+	})
+}
+
+// loadWorkspace loads the workspace named by the id parameter, with the role
+// of the authenticated user, after checking they have the access level in it.
+// It writes the error response when that fails.
+func (h *WorkspaceHandler) loadWorkspace(c *gin.Context, access workspaceAccess) (*db.Workspace, bool) {
+	workspaceID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid workspace ID",
+		})
+		return nil, false
+	}
+
+	// Non-members are refused before the lookup, so that they cannot probe
+	// which workspaces exist
+	if !h.access.authorize(c, workspaceID, access) {
+		return nil, false
+	}
+
+	workspace, err := h.workspaceRepo.GetByID(c.Request.Context(), workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve workspace",
+		})
+		return nil, false
+	}
+
+	if workspace == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Workspace not found",
+		})
+		return nil, false
+	}
+
+	workspace.Role, _ = h.access.role(c, workspace.ID)
+	return workspace, true
+}
+
+// loadMember reads the user_id parameter and returns that user's role in
+// workspace, writing the error response when they are not a member
+func (h *WorkspaceHandler) loadMember(c *gin.Context, workspace *db.Workspace) (int, string, bool) {
+	memberID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return 0, "", false
+	}
+
+	role, err := h.workspaceRepo.GetRole(c.Request.Context(), workspace.ID, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve member",
+		})
+		return 0, "", false
+	}
+
+	if role == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Member not found",
+		})
+		return 0, "", false
+	}
+
+	return memberID, role, true
+}
+
+// hasOtherOwner checks that a workspace keeps an owner when one of its
+// owners steps down, writing the error response when it would not
+func (h *WorkspaceHandler) hasOtherOwner(c *gin.Context, workspace *db.Workspace) bool {
+	owners, err := h.workspaceRepo.CountOwners(c.Request.Context(), workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve members",
+		})
+		return false
+	}
+
+	if owners < 2 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A workspace needs an owner, make another member owner first",
+		})
+		return false
+	}
+
+	return true
+}
+
+// respondMember writes a member of a workspace, as stored
+func (h *WorkspaceHandler) respondMember(c *gin.Context, status, workspaceID, userID int) {
+	members, err := h.workspaceRepo.ListMembers(c.Request.Context(), workspaceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve members",
+		})
+		return
+	}
+
+	for _, member := range members {
+		if member.UserID == userID {
+			c.JSON(status, member)
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{
+		"error": "Member not found",
+	})
+}
+
+// workspaceName trims a workspace name and checks it is not blank, writing
+// the error response when it is
+func workspaceName(c *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Workspace name cannot be empty",
+		})
+		return "", false
+	}
+	return name, true
+}
+
+// validWorkspaceRole checks a workspace role is known, writing the error
+// response when it is not
+func validWorkspaceRole(c *gin.Context, role string) bool {
+	if !slices.Contains(db.WorkspaceRoles, role) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown workspace role: " + role,
+			"roles": db.WorkspaceRoles,
+		})
+		return false
+	}
+	return true
+}
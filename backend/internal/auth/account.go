@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+	"web-crawler/config"
+	"web-crawler/internal/db"
+	"web-crawler/internal/mail"
+)
+
+var (
+	// ErrInvalidUserToken means an emailed token is unknown, expired or was
+	// already used
+	ErrInvalidUserToken = errors.New("invalid or expired token")
+	// ErrWrongPassword means the current password given to change it is wrong
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrEmailTaken means another user already has the email address
+	ErrEmailTaken = errors.New("email already in use")
+	// ErrEmailAlreadyVerified means there is nothing to verify
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	// ErrEmailSentRecently means another email was requested too soon after
+	// the previous one
+	ErrEmailSentRecently = errors.New("email sent recently")
+)
+
+// AccountService runs the account flows that involve a password or an email
+// address: changing and resetting the password, and changing and verifying
+// the email address. Reset and verification links carry single-use tokens
+// that expire.
+type AccountService struct {
+	userRepo      *db.UserRepository
+	userTokenRepo *db.UserTokenRepository
+	sessionRepo   *db.SessionRepository
+	mailer        mail.Mailer
+	appURL        string
+	resetTTL      time.Duration
+	verifyTTL     time.Duration
+	resendWait    time.Duration
+	mailTimeout   time.Duration
+}
+
+// NewAccountService creates a new account service
+func NewAccountService(userRepo *db.UserRepository, userTokenRepo *db.UserTokenRepository, sessionRepo *db.SessionRepository, mailer mail.Mailer) *AccountService {
+	cfg := config.Load()
+	return &AccountService{
+		userRepo:      userRepo,
+		userTokenRepo: userTokenRepo,
+		sessionRepo:   sessionRepo,
+		mailer:        mailer,
+		appURL:        cfg.Account.AppURL,
+		resetTTL:      cfg.Account.PasswordResetTTL,
+		verifyTTL:     cfg.Account.VerificationTTL,
+		resendWait:    cfg.Account.EmailResendWait,
+		mailTimeout:   cfg.Mail.Timeout,
+	}
+}
+
+// ChangePassword replaces the password of a user who knows the current one.
+// Every other session of the user is logged out; sessionID is kept.
+func (s *AccountService) ChangePassword(ctx context.Context, user *db.User, sessionID int64, currentPassword, newPassword string) error {
+	if err := VerifyPassword(user.PasswordHash, currentPassword); err != nil {
+		return ErrWrongPassword
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+
+	_, err = s.sessionRepo.RevokeOthersByUserID(ctx, user.ID, sessionID, db.SessionRevokedPassword)
+	return err
+}
+
+// RequestPasswordReset emails a password reset link to the user with the
+// given address. Unknown addresses and disabled accounts are ignored so that
+// callers cannot tell which addresses are registered.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || user == nil || user.DisabledAt != nil {
+		return err
+	}
+
+	if recent, err := s.sentRecently(ctx, user.ID, db.UserTokenPasswordReset); err != nil || recent {
+		return err
+	}
+
+	token, err := s.issue(ctx, user, db.UserTokenPasswordReset, s.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(&mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Web Crawler password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your Web Crawler account. "+
+			"Open this link within %s to choose a new password:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email and your password stays the same.\n",
+			user.Username, formatTTL(s.resetTTL), s.link("/reset-password", token)),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password using a token from a reset email and
+// logs out every session of the user
+func (s *AccountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	userToken, user, err := s.consume(ctx, db.UserTokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+	if _, err := s.sessionRepo.RevokeByUserID(ctx, user.ID, db.SessionRevokedPassword); err != nil {
+		return err
+	}
+
+	// Following the link proved the user receives mail at the address
+	_, err = s.userRepo.MarkEmailVerified(ctx, user.ID, userToken.Email)
+	return err
+}
+
+// ChangeEmail changes the email address of a user and sends a verification
+// link to the new address
+func (s *AccountService) ChangeEmail(ctx context.Context, user *db.User, email string) error {
+	if email == user.Email {
+		return nil
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailTaken
+	}
+
+	if err := s.userRepo.UpdateEmail(ctx, user.ID, email); err != nil {
+		return err
+	}
+	user.Email = email
+	user.EmailVerifiedAt = nil
+
+	return s.sendVerification(ctx, user)
+}
+
+// SendVerification emails a new verification link to a user whose address is
+// not verified yet
+func (s *AccountService) SendVerification(ctx context.Context, user *db.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	recent, err := s.sentRecently(ctx, user.ID, db.UserTokenEmailVerification)
+	if err != nil {
+		return err
+	}
+	if recent {
+		return ErrEmailSentRecently
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail marks the address a verification token was sent to as verified.
+// Tokens sent to an address the user has since changed are invalid.
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	userToken, user, err := s.consume(ctx, db.UserTokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	verified, err := s.userRepo.MarkEmailVerified(ctx, user.ID, userToken.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return ErrInvalidUserToken
+	}
+	return nil
+}
+
+// sendVerification emails a verification link for the current address of a user
+func (s *AccountService) sendVerification(ctx context.Context, user *db.User) error {
+	token, err := s.issue(ctx, user, db.UserTokenEmailVerification, s.verifyTTL)
+	if err != nil {
+		return err
+	}
+
+	s.send(&mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Open this link within %s to confirm that %s is the email address of your Web Crawler account:\n\n%s\n\n"+
+			"If you didn't use this address for Web Crawler, ignore this email.\n",
+			user.Username, formatTTL(s.verifyTTL), user.Email, s.link("/verify-email", token)),
+	})
+	return nil
+}
+
+// sentRecently reports whether a token for purpose was sent to a user too
+// recently to send another
+func (s *AccountService) sentRecently(ctx context.Context, userID int, purpose string) (bool, error) {
+	last, err := s.userTokenRepo.LastCreatedAt(ctx, userID, purpose)
+	if err != nil {
+		return false, err
+	}
+	return last != nil && time.Since(*last) < s.resendWait, nil
+}
+
+// issue creates a token for purpose valid for ttl. Earlier tokens of the user
+// for the same purpose stop working.
+func (s *AccountService) issue(ctx context.Context, user *db.User, purpose string, ttl time.Duration) (string, error) {
+	if err := s.userTokenRepo.DeleteExpiredByUserID(ctx, user.ID, time.Now()); err != nil {
+		return "", err
+	}
+	if err := s.userTokenRepo.InvalidateByUserID(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+
+	token, hash, err := generateOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.userTokenRepo.Create(ctx, &db.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Hash:      hash,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consume uses up a token for purpose and returns it along with its user
+func (s *AccountService) consume(ctx context.Context, purpose, token string) (*db.UserToken, *db.User, error) {
+	userToken, err := s.userTokenRepo.GetByHash(ctx, purpose, HashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	if userToken == nil || userToken.UsedAt != nil || !time.Now().Before(userToken.ExpiresAt) {
+		return nil, nil, ErrInvalidUserToken
+	}
+
+	used, err := s.userTokenRepo.Use(ctx, userToken.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		return nil, nil, ErrInvalidUserToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userToken.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A token sent to an address the user no longer has is stale
+	if user == nil || user.Email != userToken.Email {
+		return nil, nil, ErrInvalidUserToken
+	}
+	return userToken, user, nil
+}
+
+// send sends an email in the background so that slow mail servers do not
+// hold up requests, and response times do not reveal whether an address is
+// registered
+func (s *AccountService) send(msg *mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.mailTimeout)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send email %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// link returns the frontend URL of path carrying token
+func (s *AccountService) link(path, token string) string {
+	return s.appURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+// formatTTL describes how long a token is valid, e.g. "1 hour" or "30 minutes"
+func formatTTL(d time.Duration) string {
+	unit, n := "minute", int(d/time.Minute)
+	if d >= time.Hour && d%time.Hour == 0 {
+		unit, n = "hour", int(d/time.Hour)
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
@@ -1,40 +1,63 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"time"
 	"web-crawler/config"
+	"web-crawler/internal/db"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// ErrSessionEnded means the session of an access token was logged out,
+// revoked or has expired
+var ErrSessionEnded = errors.New("session ended")
+
 // Claims represents the JWT claims
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
+	// Role is the role of the user when the token was issued. Changing the
+	// role revokes the user's sessions, so it is never stale.
+	Role string `json:"role"`
+	// SessionID is the login session the token was issued for
+	SessionID int64 `json:"sid"`
 	jwt.RegisteredClaims
 }
 
 // JWTService handles JWT operations
 type JWTService struct {
-	secretKey []byte
+	secretKey   []byte
+	accessTTL   time.Duration
+	sessionRepo *db.SessionRepository
 }
 
-// NewJWTService creates a new JWT service
-func NewJWTService() *JWTService {
+// NewJWTService creates a new JWT service. Tokens are only valid while the
+// session they were issued for, as stored in sessionRepo, is active.
+func NewJWTService(sessionRepo *db.SessionRepository) *JWTService {
 	cfg := config.Load()
 	return &JWTService{
-		secretKey: []byte(cfg.JWT.Secret),
+		secretKey:   []byte(cfg.JWT.Secret),
+		accessTTL:   cfg.JWT.AccessTokenTTL,
+		sessionRepo: sessionRepo,
 	}
 }
 
-// GenerateToken generates a new JWT token for a user
-func (j *JWTService) GenerateToken(userID int, username string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// AccessTTL returns how long access tokens are valid
+func (j *JWTService) AccessTTL() time.Duration {
+	return j.accessTTL
+}
+
+// GenerateToken generates a short-lived access token for a user's session
+func (j *JWTService) GenerateToken(user *db.User, sessionID int64) (string, error) {
+	expirationTime := time.Now().Add(j.accessTTL)
 
 	claims := &Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -51,8 +74,10 @@ func (j *JWTService) GenerateToken(userID int, username string) (string, error)
 	return tokenString, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+// ValidateToken validates a JWT token and returns the claims. Tokens whose
+// session has ended are rejected with ErrSessionEnded, which is how logging
+// out takes effect before the token expires.
+func (j *JWTService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -71,16 +96,17 @@ func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
-	return claims, nil
-}
-
-// RefreshToken generates a new token with extended expiration
-func (j *JWTService) RefreshToken(tokenString string) (string, error) {
-	claims, err := j.ValidateToken(tokenString)
+	// Tokens issued before sessions existed cannot be revoked, so they are refused
+	if claims.SessionID == 0 {
+		return nil, ErrSessionEnded
+	}
+	session, err := j.sessionRepo.GetByID(ctx, claims.SessionID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if session == nil || session.UserID != claims.UserID || !session.Active(time.Now()) {
+		return nil, ErrSessionEnded
 	}
 
-	// Generate new token with extended expiration
-	return j.GenerateToken(claims.UserID, claims.Username)
+	return claims, nil
 }
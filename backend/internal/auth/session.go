@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+	"web-crawler/config"
+	"web-crawler/internal/db"
+)
+
+// reuseGrace is how long after a refresh token was used presenting it again
+// is taken for a race between two tabs rather than theft
+const reuseGrace = 10 * time.Second
+
+// sessionPurgeDelay is how long ended sessions are kept before being removed
+const sessionPurgeDelay = 7 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken means the refresh token is unknown, expired,
+	// already used or belongs to a session that ended
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means a used refresh token was presented again,
+	// so it may have been stolen and its session was revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Tokens are the credentials issued when a session starts or is refreshed
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// SessionService starts, refreshes and ends login sessions. Every refresh
+// replaces the session's refresh token; presenting a replaced token again
+// revokes the whole session.
+type SessionService struct {
+	sessionRepo *db.SessionRepository
+	userRepo    *db.UserRepository
+	jwtService  *JWTService
+	refreshTTL  time.Duration
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(sessionRepo *db.SessionRepository, userRepo *db.UserRepository) *SessionService {
+	cfg := config.Load()
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		userRepo:    userRepo,
+		jwtService:  NewJWTService(sessionRepo),
+		refreshTTL:  cfg.JWT.RefreshTokenTTL,
+	}
+}
+
+// Start starts a session for a user who just logged in
+func (s *SessionService) Start(ctx context.Context, user *db.User, userAgent, ip string) (*Tokens, error) {
+	// Sessions that ended a while ago are only kept for reference
+	if err := s.sessionRepo.DeleteEndedByUserID(ctx, user.ID, time.Now().Add(-sessionPurgeDelay)); err != nil {
+		return nil, err
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session := &db.AuthSession{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return s.issue(ctx, user, session.ID, session.ExpiresAt)
+}
+
+// Refresh exchanges a refresh token for new tokens of the same session
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	token, err := s.sessionRepo.GetRefreshTokenByHash(ctx, HashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionRepo.GetByID(ctx, token.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if session == nil || !session.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		if now.Sub(*token.UsedAt) < reuseGrace {
+			return nil, ErrInvalidRefreshToken
+		}
+		if err := s.sessionRepo.Revoke(ctx, session.ID, db.SessionRevokedReuse); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Only one of several concurrent refreshes wins
+	used, err := s.sessionRepo.UseRefreshToken(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DisabledAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	expiresAt := now.Add(s.refreshTTL)
+	if err := s.sessionRepo.Extend(ctx, session.ID, expiresAt); err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, user, session.ID, expiresAt)
+}
+
+// Logout ends the session of a refresh token. Unknown tokens are ignored.
+func (s *SessionService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.sessionRepo.GetRefreshTokenByHash(ctx, HashToken(refreshToken))
+	if err != nil || token == nil {
+		return err
+	}
+	return s.sessionRepo.Revoke(ctx, token.SessionID, db.SessionRevokedLogout)
+}
+
+// LogoutSession ends a session by ID
+func (s *SessionService) LogoutSession(ctx context.Context, sessionID int64) error {
+	return s.sessionRepo.Revoke(ctx, sessionID, db.SessionRevokedLogout)
+}
+
+// LogoutAll ends every session of a user, logging them out on all devices,
+// and returns how many sessions were ended
+func (s *SessionService) LogoutAll(ctx context.Context, userID int) (int64, error) {
+	return s.sessionRepo.RevokeByUserID(ctx, userID, db.SessionRevokedLogoutAll)
+}
+
+// JWTService returns the service that signs and validates access tokens
+func (s *SessionService) JWTService() *JWTService {
+	return s.jwtService
+}
+
+// issue creates an access token and a refresh token valid until expiresAt
+// for a session
+func (s *SessionService) issue(ctx context.Context, user *db.User, sessionID int64, expiresAt time.Time) (*Tokens, error) {
+	refreshToken, hash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.sessionRepo.CreateRefreshToken(ctx, &db.RefreshToken{
+		SessionID: sessionID,
+		Hash:      hash,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := s.jwtService.GenerateToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.jwtService.AccessTTL().Seconds()),
+	}, nil
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// APITokenPrefix starts every personal access token, which tells them apart
+// from JWTs and makes leaked tokens easy to search for
+const APITokenPrefix = "wcp_"
+
+// refreshTokenPrefix starts every refresh token
+const refreshTokenPrefix = "wcr_"
+
+// apiTokenDisplayLength is how much of a token is kept to identify it
+const apiTokenDisplayLength = len(APITokenPrefix) + 8
+
+// GenerateAPIToken creates a random personal access token. It returns the
+// token, which is shown to its user once, its display prefix and the hash
+// to store.
+func GenerateAPIToken() (token, prefix, hash string, err error) {
+	token, err = randomToken(APITokenPrefix)
+	if err != nil {
+		return "", "", "", err
+	}
+	return token, token[:apiTokenDisplayLength], HashToken(token), nil
+}
+
+// generateRefreshToken creates a random refresh token and the hash to store
+func generateRefreshToken() (token, hash string, err error) {
+	token, err = randomToken(refreshTokenPrefix)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// generateOneTimeToken creates a random token to send by email and the hash
+// to store
+func generateOneTimeToken() (token, hash string, err error) {
+	token, err = randomToken("")
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// randomToken returns prefix followed by 256 random bits
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash an opaque token is stored
+// as. Tokens are random, so a fast unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIToken reports whether a bearer credential is a personal access token
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
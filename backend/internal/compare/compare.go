@@ -0,0 +1,412 @@
+package compare
+
+import (
+	"sort"
+	"time"
+	"web-crawler/internal/crawler"
+	"web-crawler/internal/db"
+)
+
+// Run is a crawl task together with the pages and links it stored
+type Run struct {
+	Task  *db.CrawlTask
+	Pages []*db.CrawlResult
+	Links []*db.CrawlLink
+}
+
+// Report describes the differences between a base run and a later target run
+type Report struct {
+	Base       RunSummary  `json:"base"`
+	Target     RunSummary  `json:"target"`
+	SameSeries bool        `json:"same_series"`
+	Summary    Summary     `json:"summary"`
+	Pages      PageChanges `json:"pages"`
+	Links      LinkChanges `json:"links"`
+}
+
+// RunSummary identifies a compared run and its totals
+type RunSummary struct {
+	TaskID            int       `json:"task_id"`
+	URL               string    `json:"url"`
+	Status            string    `json:"status"`
+	CreatedAt         time.Time `json:"created_at"`
+	Pages             int       `json:"pages"`
+	Links             int       `json:"links"`
+	InaccessibleLinks int       `json:"inaccessible_links"`
+	AvgResponseTimeMs int       `json:"avg_response_time_ms"`
+	TotalPageBytes    int       `json:"total_page_bytes"`
+}
+
+// Summary counts the changes found
+type Summary struct {
+	PagesAdded        int `json:"pages_added"`
+	PagesRemoved      int `json:"pages_removed"`
+	PagesChanged      int `json:"pages_changed"`
+	LinksAdded        int `json:"links_added"`
+	LinksRemoved      int `json:"links_removed"`
+	LinksChanged      int `json:"links_changed"`
+	NewlyBrokenLinks  int `json:"newly_broken_links"`
+	FixedLinks        int `json:"fixed_links"`
+	ResponseTimeDelta int `json:"avg_response_time_delta_ms"`
+	PageBytesDelta    int `json:"total_page_bytes_delta"`
+}
+
+// PageChanges lists pages only found in one run and the differences of
+// pages found in both
+type PageChanges struct {
+	Added   []string   `json:"added"`
+	Removed []string   `json:"removed"`
+	Matched []PageDiff `json:"matched"`
+}
+
+// PageDiff compares one page in both runs. Content fields are only set when
+// they changed; the response time and size deltas are always reported.
+type PageDiff struct {
+	URL               string              `json:"url"`
+	Changed           bool                `json:"changed"`
+	Title             *StringChange       `json:"title,omitempty"`
+	HTMLVersion       *StringChange       `json:"html_version,omitempty"`
+	Headings          map[string]IntDelta `json:"headings,omitempty"`
+	HasLoginForm      *BoolChange         `json:"has_login_form,omitempty"`
+	InternalLinks     *IntDelta           `json:"internal_links,omitempty"`
+	ExternalLinks     *IntDelta           `json:"external_links,omitempty"`
+	InaccessibleLinks *IntDelta           `json:"inaccessible_links,omitempty"`
+	ResponseTimeMs    IntDelta            `json:"response_time_ms"`
+	PageSizeBytes     IntDelta            `json:"page_size_bytes"`
+}
+
+// LinkChanges lists links only found in one run and links whose check
+// result changed
+type LinkChanges struct {
+	Added   []LinkRef  `json:"added"`
+	Removed []LinkRef  `json:"removed"`
+	Changed []LinkDiff `json:"changed"`
+}
+
+// LinkRef describes a link found in only one of the runs
+type LinkRef struct {
+	URL          string  `json:"url"`
+	PageURL      *string `json:"page_url,omitempty"`
+	LinkType     string  `json:"link_type"`
+	StatusCode   *int    `json:"status_code,omitempty"`
+	IsAccessible bool    `json:"is_accessible"`
+	AnchorText   *string `json:"anchor_text,omitempty"`
+}
+
+// LinkDiff describes a link whose check result differs between the runs
+type LinkDiff struct {
+	URL          string        `json:"url"`
+	StatusCode   *IntPtrChange `json:"status_code,omitempty"`
+	IsAccessible *BoolChange   `json:"is_accessible,omitempty"`
+	CheckStatus  *StringChange `json:"check_status,omitempty"`
+}
+
+// StringChange is a text value that changed
+type StringChange struct {
+	Base   string `json:"base"`
+	Target string `json:"target"`
+}
+
+// BoolChange is a flag that changed
+type BoolChange struct {
+	Base   bool `json:"base"`
+	Target bool `json:"target"`
+}
+
+// IntPtrChange is an optional number that changed
+type IntPtrChange struct {
+	Base   *int `json:"base"`
+	Target *int `json:"target"`
+}
+
+// IntDelta compares a number in both runs
+type IntDelta struct {
+	Base   int `json:"base"`
+	Target int `json:"target"`
+	Delta  int `json:"delta"`
+}
+
+func newIntDelta(base, target int) IntDelta {
+	return IntDelta{Base: base, Target: target, Delta: target - base}
+}
+
+// changedDelta returns a delta only when the value changed
+func changedDelta(base, target int) *IntDelta {
+	if base == target {
+		return nil
+	}
+	d := newIntDelta(base, target)
+	return &d
+}
+
+// Compare reports what changed from base to target
+func Compare(base, target *Run) *Report {
+	report := &Report{
+		Base:       summarize(base),
+		Target:     summarize(target),
+		SameSeries: seriesOf(base.Task) == seriesOf(target.Task),
+		Pages:      comparePages(base, target),
+		Links:      compareLinks(base.Links, target.Links),
+	}
+
+	report.Summary = Summary{
+		PagesAdded:        len(report.Pages.Added),
+		PagesRemoved:      len(report.Pages.Removed),
+		LinksAdded:        len(report.Links.Added),
+		LinksRemoved:      len(report.Links.Removed),
+		LinksChanged:      len(report.Links.Changed),
+		ResponseTimeDelta: report.Target.AvgResponseTimeMs - report.Base.AvgResponseTimeMs,
+		PageBytesDelta:    report.Target.TotalPageBytes - report.Base.TotalPageBytes,
+	}
+	for _, page := range report.Pages.Matched {
+		if page.Changed {
+			report.Summary.PagesChanged++
+		}
+	}
+	for _, link := range report.Links.Changed {
+		if link.IsAccessible == nil {
+			continue
+		}
+		if link.IsAccessible.Target {
+			report.Summary.FixedLinks++
+		} else {
+			report.Summary.NewlyBrokenLinks++
+		}
+	}
+
+	return report
+}
+
+// summarize computes the totals of a run
+func summarize(run *Run) RunSummary {
+	summary := RunSummary{
+		TaskID:    run.Task.ID,
+		URL:       run.Task.URL,
+		Status:    run.Task.Status,
+		CreatedAt: run.Task.CreatedAt,
+		Pages:     len(run.Pages),
+		Links:     len(run.Links),
+	}
+
+	totalTime := 0
+	for _, page := range run.Pages {
+		totalTime += page.ResponseTimeMs
+		summary.TotalPageBytes += page.PageSizeBytes
+	}
+	if len(run.Pages) > 0 {
+		summary.AvgResponseTimeMs = totalTime / len(run.Pages)
+	}
+	for _, link := range run.Links {
+		if !link.IsAccessible {
+			summary.InaccessibleLinks++
+		}
+	}
+
+	return summary
+}
+
+// seriesOf returns the series key of a task, computing it for older tasks
+func seriesOf(task *db.CrawlTask) string {
+	if task.SeriesKey != "" {
+		return task.SeriesKey
+	}
+	return crawler.NormalizeURL(task.URL)
+}
+
+// pageKey identifies a page across runs. Start pages always match each other
+// so that comparing runs still works after the start URL redirected.
+func pageKey(task *db.CrawlTask, page *db.CrawlResult) string {
+	if page.Depth == 0 {
+		return ""
+	}
+	if page.PageURL == nil {
+		return crawler.NormalizeURL(task.URL)
+	}
+	return crawler.NormalizeURL(*page.PageURL)
+}
+
+// pageURL returns the URL a page was fetched from
+func pageURL(task *db.CrawlTask, page *db.CrawlResult) string {
+	if page.PageURL != nil {
+		return *page.PageURL
+	}
+	return task.URL
+}
+
+// comparePages matches the pages of both runs by URL
+func comparePages(base, target *Run) PageChanges {
+	changes := PageChanges{Added: []string{}, Removed: []string{}, Matched: []PageDiff{}}
+
+	basePages := make(map[string]*db.CrawlResult)
+	for _, page := range base.Pages {
+		key := pageKey(base.Task, page)
+		if _, ok := basePages[key]; !ok {
+			basePages[key] = page
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, page := range target.Pages {
+		key := pageKey(target.Task, page)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		basePage, ok := basePages[key]
+		if !ok {
+			changes.Added = append(changes.Added, pageURL(target.Task, page))
+			continue
+		}
+		changes.Matched = append(changes.Matched, comparePage(pageURL(target.Task, page), basePage, page))
+	}
+
+	for key, page := range basePages {
+		if !seen[key] {
+			changes.Removed = append(changes.Removed, pageURL(base.Task, page))
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Slice(changes.Matched, func(i, j int) bool { return changes.Matched[i].URL < changes.Matched[j].URL })
+	return changes
+}
+
+// comparePage reports the differences of a page found in both runs
+func comparePage(url string, base, target *db.CrawlResult) PageDiff {
+	diff := PageDiff{
+		URL:               url,
+		Title:             changedString(base.PageTitle, target.PageTitle),
+		HTMLVersion:       changedString(base.HTMLVersion, target.HTMLVersion),
+		InternalLinks:     changedDelta(base.InternalLinksCount, target.InternalLinksCount),
+		ExternalLinks:     changedDelta(base.ExternalLinksCount, target.ExternalLinksCount),
+		InaccessibleLinks: changedDelta(base.InaccessibleLinksCount, target.InaccessibleLinksCount),
+		ResponseTimeMs:    newIntDelta(base.ResponseTimeMs, target.ResponseTimeMs),
+		PageSizeBytes:     newIntDelta(base.PageSizeBytes, target.PageSizeBytes),
+	}
+
+	if base.HasLoginForm != target.HasLoginForm {
+		diff.HasLoginForm = &BoolChange{Base: base.HasLoginForm, Target: target.HasLoginForm}
+	}
+
+	headings := []struct {
+		name         string
+		base, target int
+	}{
+		{"h1", base.H1Count, target.H1Count},
+		{"h2", base.H2Count, target.H2Count},
+		{"h3", base.H3Count, target.H3Count},
+		{"h4", base.H4Count, target.H4Count},
+		{"h5", base.H5Count, target.H5Count},
+		{"h6", base.H6Count, target.H6Count},
+	}
+	for _, h := range headings {
+		if h.base != h.target {
+			if diff.Headings == nil {
+				diff.Headings = make(map[string]IntDelta)
+			}
+			diff.Headings[h.name] = newIntDelta(h.base, h.target)
+		}
+	}
+
+	diff.Changed = diff.Title != nil || diff.HTMLVersion != nil || diff.Headings != nil || diff.HasLoginForm != nil ||
+		diff.InternalLinks != nil || diff.ExternalLinks != nil || diff.InaccessibleLinks != nil
+	return diff
+}
+
+// changedString returns a change only when the optional texts differ
+func changedString(base, target *string) *StringChange {
+	b, t := deref(base), deref(target)
+	if b == t {
+		return nil
+	}
+	return &StringChange{Base: b, Target: t}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// compareLinks matches the links of both runs by URL. A URL linked from
+// several pages is compared once, using its first occurrence.
+func compareLinks(base, target []*db.CrawlLink) LinkChanges {
+	changes := LinkChanges{Added: []LinkRef{}, Removed: []LinkRef{}, Changed: []LinkDiff{}}
+
+	baseLinks := firstByURL(base)
+	targetLinks := firstByURL(target)
+
+	for url, link := range targetLinks {
+		baseLink, ok := baseLinks[url]
+		if !ok {
+			changes.Added = append(changes.Added, linkRef(link))
+			continue
+		}
+		if diff, changed := compareLink(baseLink, link); changed {
+			changes.Changed = append(changes.Changed, diff)
+		}
+	}
+	for url, link := range baseLinks {
+		if _, ok := targetLinks[url]; !ok {
+			changes.Removed = append(changes.Removed, linkRef(link))
+		}
+	}
+
+	sort.Slice(changes.Added, func(i, j int) bool { return changes.Added[i].URL < changes.Added[j].URL })
+	sort.Slice(changes.Removed, func(i, j int) bool { return changes.Removed[i].URL < changes.Removed[j].URL })
+	sort.Slice(changes.Changed, func(i, j int) bool { return changes.Changed[i].URL < changes.Changed[j].URL })
+	return changes
+}
+
+// firstByURL indexes links by URL, keeping the first occurrence of each
+func firstByURL(links []*db.CrawlLink) map[string]*db.CrawlLink {
+	byURL := make(map[string]*db.CrawlLink, len(links))
+	for _, link := range links {
+		if _, ok := byURL[link.URL]; !ok {
+			byURL[link.URL] = link
+		}
+	}
+	return byURL
+}
+
+// compareLink reports whether the check result of a link changed
+func compareLink(base, target *db.CrawlLink) (LinkDiff, bool) {
+	diff := LinkDiff{URL: target.URL}
+	changed := false
+
+	if !sameStatus(base.StatusCode, target.StatusCode) {
+		diff.StatusCode = &IntPtrChange{Base: base.StatusCode, Target: target.StatusCode}
+		changed = true
+	}
+	if base.IsAccessible != target.IsAccessible {
+		diff.IsAccessible = &BoolChange{Base: base.IsAccessible, Target: target.IsAccessible}
+		changed = true
+	}
+	if base.CheckStatus != target.CheckStatus {
+		diff.CheckStatus = &StringChange{Base: base.CheckStatus, Target: target.CheckStatus}
+		changed = true
+	}
+
+	return diff, changed
+}
+
+func sameStatus(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func linkRef(link *db.CrawlLink) LinkRef {
+	return LinkRef{
+		URL:          link.URL,
+		PageURL:      link.PageURL,
+		LinkType:     link.LinkType,
+		StatusCode:   link.StatusCode,
+		IsAccessible: link.IsAccessible,
+		AnchorText:   link.AnchorText,
+	}
+}
@@ -0,0 +1,201 @@
+package compare
+
+import (
+	"reflect"
+	"testing"
+	"web-crawler/internal/db"
+)
+
+func page(depth int, pageURL string, title string, h2 int) *db.CrawlResult {
+	result := &db.CrawlResult{Depth: depth, PageTitle: &title, H2Count: h2}
+	if pageURL != "" {
+		result.PageURL = &pageURL
+	}
+	return result
+}
+
+func link(url string, status int, accessible bool) *db.CrawlLink {
+	return &db.CrawlLink{URL: url, StatusCode: &status, IsAccessible: accessible, CheckStatus: db.LinkCheckStatusChecked}
+}
+
+func linkURLs(refs []LinkRef) []string {
+	urls := []string{}
+	for _, ref := range refs {
+		urls = append(urls, ref.URL)
+	}
+	return urls
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         *Run
+		target       *Run
+		summary      Summary
+		pagesAdded   []string
+		pagesRemoved []string
+		pagesMatched []string
+		linksAdded   []string
+		linksRemoved []string
+		linksChanged []string
+	}{
+		{
+			name: "identical runs",
+			base: &Run{
+				Task:  &db.CrawlTask{ID: 1, URL: "https://example.com"},
+				Pages: []*db.CrawlResult{page(0, "", "Home", 0)},
+				Links: []*db.CrawlLink{link("https://example.com/a", 200, true)},
+			},
+			target: &Run{
+				Task:  &db.CrawlTask{ID: 2, URL: "https://example.com"},
+				Pages: []*db.CrawlResult{page(0, "", "Home", 0)},
+				Links: []*db.CrawlLink{link("https://example.com/a", 200, true)},
+			},
+			summary:      Summary{},
+			pagesAdded:   []string{},
+			pagesRemoved: []string{},
+			pagesMatched: []string{"https://example.com"},
+			linksAdded:   []string{},
+			linksRemoved: []string{},
+			linksChanged: []string{},
+		},
+		{
+			name: "pages added, removed and changed",
+			base: &Run{
+				Task: &db.CrawlTask{ID: 1, URL: "https://example.com"},
+				Pages: []*db.CrawlResult{
+					page(0, "", "Home", 0),
+					page(1, "https://example.com/about", "About", 1),
+					page(1, "https://example.com/old", "Old", 0),
+				},
+			},
+			target: &Run{
+				Task: &db.CrawlTask{ID: 2, URL: "https://example.com"},
+				Pages: []*db.CrawlResult{
+					page(0, "", "Home", 0),
+					page(1, "https://example.com/about", "About", 2),
+					page(1, "https://example.com/new", "New", 0),
+				},
+			},
+			summary:      Summary{PagesAdded: 1, PagesRemoved: 1, PagesChanged: 1},
+			pagesAdded:   []string{"https://example.com/new"},
+			pagesRemoved: []string{"https://example.com/old"},
+			pagesMatched: []string{"https://example.com", "https://example.com/about"},
+			linksAdded:   []string{},
+			linksRemoved: []string{},
+			linksChanged: []string{},
+		},
+		{
+			name: "start pages match after a redirect",
+			base: &Run{
+				Task:  &db.CrawlTask{ID: 1, URL: "https://example.com"},
+				Pages: []*db.CrawlResult{page(0, "", "Home", 0)},
+			},
+			target: &Run{
+				Task:  &db.CrawlTask{ID: 2, URL: "https://example.com"},
+				Pages: []*db.CrawlResult{page(0, "https://www.example.com/", "Welcome", 0)},
+			},
+			summary:      Summary{PagesChanged: 1},
+			pagesAdded:   []string{},
+			pagesRemoved: []string{},
+			pagesMatched: []string{"https://www.example.com/"},
+			linksAdded:   []string{},
+			linksRemoved: []string{},
+			linksChanged: []string{},
+		},
+		{
+			name: "links",
+			base: &Run{
+				Task: &db.CrawlTask{ID: 1, URL: "https://example.com"},
+				Links: []*db.CrawlLink{
+					link("https://example.com/same", 200, true),
+					link("https://example.com/same", 404, false),
+					link("https://example.com/fixed", 404, false),
+					link("https://example.com/broken", 200, true),
+					link("https://example.com/still-broken", 500, false),
+					link("https://example.com/gone", 200, true),
+				},
+			},
+			target: &Run{
+				Task: &db.CrawlTask{ID: 2, URL: "https://example.com"},
+				Links: []*db.CrawlLink{
+					link("https://example.com/same", 200, true),
+					link("https://example.com/same", 500, false),
+					link("https://example.com/fixed", 200, true),
+					link("https://example.com/broken", 503, false),
+					link("https://example.com/still-broken", 503, false),
+					link("https://example.com/new", 404, false),
+				},
+			},
+			summary:      Summary{LinksAdded: 1, LinksRemoved: 1, LinksChanged: 3, FixedLinks: 1, NewlyBrokenLinks: 1},
+			pagesAdded:   []string{},
+			pagesRemoved: []string{},
+			pagesMatched: []string{},
+			linksAdded:   []string{"https://example.com/new"},
+			linksRemoved: []string{"https://example.com/gone"},
+			linksChanged: []string{"https://example.com/broken", "https://example.com/fixed", "https://example.com/still-broken"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Compare(tt.base, tt.target)
+
+			if report.Summary != tt.summary {
+				t.Errorf("summary = %+v, want %+v", report.Summary, tt.summary)
+			}
+			if !reflect.DeepEqual(report.Pages.Added, tt.pagesAdded) {
+				t.Errorf("pages added = %v, want %v", report.Pages.Added, tt.pagesAdded)
+			}
+			if !reflect.DeepEqual(report.Pages.Removed, tt.pagesRemoved) {
+				t.Errorf("pages removed = %v, want %v", report.Pages.Removed, tt.pagesRemoved)
+			}
+			matched := []string{}
+			for _, diff := range report.Pages.Matched {
+				matched = append(matched, diff.URL)
+			}
+			if !reflect.DeepEqual(matched, tt.pagesMatched) {
+				t.Errorf("pages matched = %v, want %v", matched, tt.pagesMatched)
+			}
+			if got := linkURLs(report.Links.Added); !reflect.DeepEqual(got, tt.linksAdded) {
+				t.Errorf("links added = %v, want %v", got, tt.linksAdded)
+			}
+			if got := linkURLs(report.Links.Removed); !reflect.DeepEqual(got, tt.linksRemoved) {
+				t.Errorf("links removed = %v, want %v", got, tt.linksRemoved)
+			}
+			changed := []string{}
+			for _, diff := range report.Links.Changed {
+				changed = append(changed, diff.URL)
+			}
+			if !reflect.DeepEqual(changed, tt.linksChanged) {
+				t.Errorf("links changed = %v, want %v", changed, tt.linksChanged)
+			}
+		})
+	}
+}
+
+func TestComparePageDiff(t *testing.T) {
+	base := &Run{
+		Task:  &db.CrawlTask{ID: 1, URL: "https://example.com"},
+		Pages: []*db.CrawlResult{page(1, "https://example.com/about", "About", 1)},
+	}
+	target := &Run{
+		Task:  &db.CrawlTask{ID: 2, URL: "https://example.com"},
+		Pages: []*db.CrawlResult{page(1, "https://example.com/about", "About us", 3)},
+	}
+
+	report := Compare(base, target)
+	if len(report.Pages.Matched) != 1 {
+		t.Fatalf("matched %d pages, want 1", len(report.Pages.Matched))
+	}
+	diff := report.Pages.Matched[0]
+	if diff.Title == nil || diff.Title.Base != "About" || diff.Title.Target != "About us" {
+		t.Errorf("title = %+v, want About -> About us", diff.Title)
+	}
+	if want := (map[string]IntDelta{"h2": {Base: 1, Target: 3, Delta: 2}}); !reflect.DeepEqual(diff.Headings, want) {
+		t.Errorf("headings = %v, want %v", diff.Headings, want)
+	}
+	if diff.HasLoginForm != nil || diff.InternalLinks != nil {
+		t.Errorf("unchanged fields are reported: %+v", diff)
+	}
+}
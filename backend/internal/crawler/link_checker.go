@@ -0,0 +1,264 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"web-crawler/internal/db"
+)
+
+// LinkProgressFunc reports how many of the links found on a page have been checked
+type LinkProgressFunc func(checked, total int)
+
+// LinkChecker verifies link accessibility concurrently using a bounded pool of
+// workers, while limiting the number of simultaneous requests to any single host
+// and honoring each host's robots.txt
+type LinkChecker struct {
+	client  *http.Client
+	robots  *RobotsCache
+	workers int
+	perHost int
+}
+
+// NewLinkChecker creates a new link checker
+func NewLinkChecker(workers, perHost int, robots *RobotsCache) *LinkChecker {
+	if workers < 1 {
+		workers = 1
+	}
+	if perHost < 1 {
+		perHost = 1
+	}
+
+	return &LinkChecker{
+		client: &http.Client{
+			// Shorter timeout for link checking to avoid hanging
+			Timeout: 10 * time.Second,
+		},
+		robots:  robots,
+		workers: workers,
+		perHost: perHost,
+	}
+}
+
+// linkCheck is the outcome of checking a single unique URL
+type linkCheck struct {
+	disallowed   bool
+	isAccessible bool
+	statusCode   int
+	responseTime int
+}
+
+// CheckLinks checks every link that still needs verification and fills in its
+// accessibility, status code and response time. Identical URLs are only
+// requested once and links disallowed by robots.txt are not requested at all
+// unless ignoreRobots is set. onProgress, if set, is called after each unique
+// URL is checked, from a single goroutine so calls never overlap, and without
+// holding up the workers. Checking stops as soon as ctx is done and its error is returned.
+func (lc *LinkChecker) CheckLinks(ctx context.Context, links []LinkInfo, ignoreRobots bool, onProgress LinkProgressFunc) error {
+	// Group links by URL so duplicates share a single request
+	indexes := make(map[string][]int)
+	var urls []string
+	for i := range links {
+		checkURL := links[i].checkURL
+		if checkURL == "" {
+			continue
+		}
+		if _, seen := indexes[checkURL]; !seen {
+			urls = append(urls, checkURL)
+		}
+		indexes[checkURL] = append(indexes[checkURL], i)
+	}
+
+	total := len(urls)
+	if total == 0 {
+		return nil
+	}
+
+	// One semaphore per host caps the concurrent requests a host receives
+	hostSlots := make(map[string]chan struct{})
+	for _, u := range urls {
+		host := hostOf(u)
+		if _, ok := hostSlots[host]; !ok {
+			hostSlots[host] = make(chan struct{}, lc.perHost)
+		}
+	}
+
+	jobs := make(chan string)
+	results := make(map[string]linkCheck, total)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	checked := 0
+
+	// Buffered for every URL, so reporting progress never blocks a worker
+	progress := make(chan int, total)
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		for n := range progress {
+			if onProgress != nil {
+				onProgress(n, total)
+			}
+		}
+	}()
+
+	workers := lc.workers
+	if workers > total {
+		workers = total
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				slot := hostSlots[hostOf(u)]
+				select {
+				case slot <- struct{}{}:
+				case <-ctx.Done():
+					continue
+				}
+				result, err := lc.check(ctx, u, ignoreRobots)
+				<-slot
+				if err != nil {
+					continue
+				}
+
+				mu.Lock()
+				results[u] = result
+				checked++
+				n := checked
+				mu.Unlock()
+				progress <- n
+			}
+		}()
+	}
+
+	// Interleave hosts so workers are not all blocked on the same host's slots
+feed:
+	for _, u := range interleaveByHost(urls) {
+		select {
+		case jobs <- u:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(progress)
+	<-reported
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for u, idx := range indexes {
+		result := results[u]
+		for _, i := range idx {
+			if result.disallowed {
+				// Disallowed links are not broken, we are just not allowed to look
+				links[i].IsAccessible = true
+				links[i].CheckStatus = db.LinkCheckStatusDisallowed
+				continue
+			}
+			links[i].CheckStatus = db.LinkCheckStatusChecked
+			links[i].IsAccessible = result.isAccessible
+			links[i].StatusCode = result.statusCode
+			links[i].ResponseTime = result.responseTime
+		}
+	}
+
+	return nil
+}
+
+// check checks if a single link is accessible. An error is only returned when
+// ctx is done, so that cancelled checks are not reported as broken links.
+func (lc *LinkChecker) check(ctx context.Context, linkURL string, ignoreRobots bool) (linkCheck, error) {
+	// wait honors the Crawl-delay of the host before each request
+	wait := func() error { return ctx.Err() }
+	if !ignoreRobots {
+		if parsed, err := url.Parse(linkURL); err == nil {
+			if !lc.robots.Allowed(ctx, parsed) {
+				return linkCheck{disallowed: true}, ctx.Err()
+			}
+			wait = func() error { return lc.robots.Wait(ctx, parsed) }
+		}
+	}
+	if err := wait(); err != nil {
+		return linkCheck{}, err
+	}
+
+	startTime := time.Now()
+
+	// Use HEAD request to check accessibility without downloading content
+	resp, err := lc.request(ctx, http.MethodHead, linkURL)
+	responseTime := int(time.Since(startTime).Milliseconds())
+
+	// Retry with GET when HEAD fails or the server does not support it
+	if err != nil || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := wait(); err != nil {
+			return linkCheck{}, err
+		}
+		// The reported response time is the one of the request whose status is reported
+		startTime = time.Now()
+		resp, err = lc.request(ctx, http.MethodGet, linkURL)
+		responseTime = int(time.Since(startTime).Milliseconds())
+		if err != nil {
+			return linkCheck{responseTime: responseTime}, ctx.Err()
+		}
+	}
+	defer resp.Body.Close()
+
+	return linkCheck{
+		isAccessible: resp.StatusCode >= 200 && resp.StatusCode < 400,
+		statusCode:   resp.StatusCode,
+		responseTime: responseTime,
+	}, nil
+}
+
+// request sends a request identifying the crawler with its User-Agent
+func (lc *LinkChecker) request(ctx context.Context, method, linkURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, linkURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", lc.robots.UserAgent())
+	return lc.client.Do(req)
+}
+
+// interleaveByHost orders URLs round-robin across their hosts
+func interleaveByHost(urls []string) []string {
+	var hosts []string
+	byHost := make(map[string][]string)
+	for _, u := range urls {
+		host := hostOf(u)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], u)
+	}
+
+	ordered := make([]string, 0, len(urls))
+	for len(ordered) < len(urls) {
+		for _, host := range hosts {
+			if queued := byHost[host]; len(queued) > 0 {
+				ordered = append(ordered, queued[0])
+				byHost[host] = queued[1:]
+			}
+		}
+	}
+	return ordered
+}
+
+// hostOf returns the host of a URL, or an empty string if it cannot be parsed
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -1,12 +1,14 @@
 package crawler
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 	"web-crawler/internal/db"
-	"web-crawler/internal/websocket"
+	"web-crawler/internal/events"
+	"web-crawler/internal/webhook"
 )
 
 // Processor handles the processing of crawl tasks with database integration
@@ -15,112 +17,253 @@ type Processor struct {
 	taskRepo   *db.TaskRepository
 	resultRepo *db.ResultRepository
 	linkRepo   *db.LinkRepository
-	wsHub      *websocket.Hub
+	bus        *events.Bus
+	hooks      *webhook.Dispatcher
 }
 
 // NewProcessor creates a new crawler processor
-func NewProcessor(taskRepo *db.TaskRepository, resultRepo *db.ResultRepository, linkRepo *db.LinkRepository, wsHub *websocket.Hub) *Processor {
+func NewProcessor(taskRepo *db.TaskRepository, resultRepo *db.ResultRepository, linkRepo *db.LinkRepository, bus *events.Bus, hooks *webhook.Dispatcher) *Processor {
 	return &Processor{
 		crawler:    NewService(),
 		taskRepo:   taskRepo,
 		resultRepo: resultRepo,
 		linkRepo:   linkRepo,
-		wsHub:      wsHub,
+		bus:        bus,
+		hooks:      hooks,
 	}
 }
 
-// ProcessTask processes a crawl task with progress updates
-func (p *Processor) ProcessTask(task *db.CrawlTask, stopCh <-chan bool) error {
+// Cancellation causes recognized by ProcessTask, set with context.WithCancelCause
+var (
+	// ErrTaskStopped means the user asked for the task to stop
+	ErrTaskStopped = errors.New("task stopped")
+	// ErrShuttingDown means the server is shutting down
+	ErrShuttingDown = errors.New("server shutting down")
+	// ErrLeaseLost means this worker no longer owns the task
+	ErrLeaseLost = errors.New("task lease lost")
+)
+
+// ProcessTask processes a crawl task claimed under owner's lease, with
+// progress updates. Cancelling ctx aborts in-flight requests and database
+// writes; the cancellation cause (ErrTaskStopped, ErrShuttingDown,
+// ErrLeaseLost or a deadline) decides the final status. The final status is
+// only written while owner still holds the lease, and events and webhooks are
+// only sent when it was.
+func (p *Processor) ProcessTask(ctx context.Context, task *db.CrawlTask, owner string) error {
 	log.Printf("Starting to process task %d for URL: %s", task.ID, task.URL)
 
-	// Update task status to in_progress
-	if err := p.taskRepo.UpdateStatus(task.ID, db.TaskStatusInProgress); err != nil {
-		return fmt.Errorf("failed to update task status: %v", err)
+	// A task resumed after an interrupted attempt starts over from scratch
+	if task.Attempts > 1 {
+		if err := p.resultRepo.DeleteByTaskID(ctx, task.ID); err != nil {
+			log.Printf("Failed to clear previous results of task %d: %v", task.ID, err)
+		}
+		if err := p.linkRepo.DeleteByTaskID(ctx, task.ID); err != nil {
+			log.Printf("Failed to clear previous links of task %d: %v", task.ID, err)
+		}
 	}
 
 	// Send initial progress update
-	p.sendProgressUpdate(task.UserID, task.ID, 0.0, "Starting crawl...")
+	p.sendProgressUpdate(task.WorkspaceID, task.ID, 0.0, "Starting crawl...")
+	p.hooks.Notify(ctx, task, webhook.EventTaskStarted, webhook.NewTaskEvent(task, db.TaskStatusInProgress))
 
-	// Check for stop signal
-	select {
-	case <-stopCh:
-		log.Printf("Task %d was stopped before crawling", task.ID)
-		return p.taskRepo.UpdateStatus(task.ID, db.TaskStatusCancelled)
-	default:
+	// Crawl the page, or the site when the task asks for it
+	startTime := time.Now()
+	opts := siteOptions(task)
+	tracker := &progressTracker{pagesTotal: opts.MaxPages}
+	var rootResult *db.CrawlResult
+	brokenLinks := 0
+
+	onLinks := func(checked, total int) {
+		// Report every 5% of the links to bound database writes and messages
+		step := total / 20
+		if step < 1 {
+			step = 1
+		}
+		if checked%step != 0 && checked != total {
+			return
+		}
+
+		progress := tracker.update(float64(checked) / float64(total))
+		p.taskRepo.UpdateProgress(ctx, task.ID, progress)
+		p.sendProgressUpdate(task.WorkspaceID, task.ID, progress,
+			fmt.Sprintf("Page %d of %d: checked %d of %d links", tracker.pagesDone+1, tracker.pagesTotal, checked, total))
 	}
 
-	// Update progress to 10% - starting to fetch page
-	p.taskRepo.UpdateProgress(task.ID, 10.0)
-	p.sendProgressUpdate(task.UserID, task.ID, 10.0, "Fetching webpage...")
+	onPage := func(page *PageResult, crawled, total int) error {
+		dbResult := p.convertToDBResult(task.ID, page)
+		if err := p.resultRepo.Create(ctx, dbResult); err != nil {
+			return fmt.Errorf("failed to save results: %v", err)
+		}
+		if rootResult == nil {
+			rootResult = dbResult
+		}
+		brokenLinks += dbResult.InaccessibleLinksCount
+
+		// Save detailed link information
+		if err := p.saveLinks(ctx, task.ID, page.URL, page.Links); err != nil {
+			log.Printf("Failed to save link details: %v", err)
+			// This is not critical, so we don't fail the task
+		}
+
+		tracker.pagesDone = crawled
+		tracker.pagesTotal = total
+		progress := tracker.update(0)
+		p.taskRepo.UpdateProgress(ctx, task.ID, progress)
+		p.sendProgressUpdate(task.WorkspaceID, task.ID, progress,
+			fmt.Sprintf("Crawled page %d of %d: %s", crawled, total, page.URL))
+		return ctx.Err()
+	}
+
+	pages, err := p.crawler.CrawlSite(ctx, task.URL, opts, onPage, onLinks)
+
+	if ctx.Err() != nil {
+		return p.handleCancellation(ctx, task, owner, pages)
+	}
 
-	// Crawl the page
-	startTime := time.Now()
-	result, err := p.crawler.CrawlPage(task.URL)
 	if err != nil {
 		log.Printf("Failed to crawl URL %s: %v", task.URL, err)
 		errorMsg := err.Error()
-		if updateErr := p.taskRepo.UpdateStatusWithError(task.ID, db.TaskStatusFailed, &errorMsg); updateErr != nil {
+		finished, updateErr := p.taskRepo.FinishRun(ctx, task.ID, owner, db.TaskStatusFailed, &errorMsg)
+		if updateErr != nil {
 			log.Printf("Failed to update task status: %v", updateErr)
 		}
-		p.sendProgressUpdate(task.UserID, task.ID, 0.0, fmt.Sprintf("Failed: %s", err.Error()))
+		if !finished {
+			return err
+		}
+		p.sendProgressUpdate(task.WorkspaceID, task.ID, 0.0, fmt.Sprintf("Failed: %s", err.Error()))
+		p.sendFailedUpdate(task.WorkspaceID, task.ID, errorMsg)
+		p.notifyFailed(ctx, task, errorMsg)
 		return err
 	}
 
-	// Check for stop signal after crawling
-	select {
-	case <-stopCh:
-		log.Printf("Task %d was stopped after crawling", task.ID)
-		return p.taskRepo.UpdateStatus(task.ID, db.TaskStatusCancelled)
-	default:
+	finished, err := p.taskRepo.FinishRun(ctx, task.ID, owner, db.TaskStatusCompleted, nil)
+	if err != nil {
+		log.Printf("Failed to update task status to completed: %v", err)
+	}
+	if !finished {
+		log.Printf("Task %d finished after it was stopped or reclaimed, discarding its status", task.ID)
+		return nil
 	}
 
-	// Update progress to 60% - analyzing results
-	p.taskRepo.UpdateProgress(task.ID, 60.0)
-	p.sendProgressUpdate(task.UserID, task.ID, 60.0, "Analyzing page content...")
+	// Update progress to 100% - completed
+	p.taskRepo.UpdateProgress(ctx, task.ID, 100.0)
+	completedAt := time.Now()
+	if err := p.taskRepo.UpdateCompletedAt(ctx, task.ID, &completedAt); err != nil {
+		log.Printf("Failed to update completion time: %v", err)
+	}
 
-	// Save results to database
-	dbResult := p.convertToDBResult(task.ID, result)
-	if err := p.resultRepo.Create(dbResult); err != nil {
-		log.Printf("Failed to save crawl results: %v", err)
-		errorMsg := "Failed to save results"
-		if updateErr := p.taskRepo.UpdateStatusWithError(task.ID, db.TaskStatusFailed, &errorMsg); updateErr != nil {
-			log.Printf("Failed to update task status: %v", updateErr)
+	p.sendProgressUpdate(task.WorkspaceID, task.ID, 100.0, "Crawling completed successfully!")
+
+	// Send final results of the start page via WebSocket
+	p.sendResultsUpdate(task.WorkspaceID, task.ID, rootResult)
+	p.notifyCompleted(ctx, task, pages, brokenLinks, rootResult)
+
+	log.Printf("Task %d completed successfully in %v (%d pages)", task.ID, time.Since(startTime), pages)
+	return nil
+}
+
+// handleCancellation records the final status of a task whose context was
+// cancelled. The status writes use a context detached from the cancelled one
+// and are skipped, along with the events, once owner lost the lease.
+func (p *Processor) handleCancellation(ctx context.Context, task *db.CrawlTask, owner string, pages int) error {
+	cause := context.Cause(ctx)
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	switch {
+	case errors.Is(cause, ErrTaskStopped):
+		// Tasks cancelled through the queue were already reported as stopped
+		log.Printf("Task %d was stopped after %d pages", task.ID, pages)
+		finished, err := p.taskRepo.FinishRun(writeCtx, task.ID, owner, db.TaskStatusCancelled, nil)
+		if err != nil || !finished {
+			return err
 		}
-		return err
-	}
+		p.NotifyStopped(writeCtx, task)
+		return nil
+
+	case errors.Is(cause, context.DeadlineExceeded):
+		log.Printf("Task %d timed out after %d pages", task.ID, pages)
+		errorMsg := "Crawl timed out"
+		finished, err := p.taskRepo.FinishRun(writeCtx, task.ID, owner, db.TaskStatusFailed, &errorMsg)
+		if err != nil {
+			return err
+		}
+		if !finished {
+			return cause
+		}
+		p.sendProgressUpdate(task.WorkspaceID, task.ID, 0.0, "Failed: "+errorMsg)
+		p.sendFailedUpdate(task.WorkspaceID, task.ID, errorMsg)
+		p.notifyFailed(writeCtx, task, errorMsg)
+		return cause
 
-	// Update progress to 80% - saving link details
-	p.taskRepo.UpdateProgress(task.ID, 80.0)
-	p.sendProgressUpdate(task.UserID, task.ID, 80.0, "Saving link details...")
+	case errors.Is(cause, ErrLeaseLost):
+		// The task was stopped or reclaimed elsewhere, which already set its status
+		log.Printf("Task %d lost its lease after %d pages", task.ID, pages)
+		return nil
 
-	// Save detailed link information
-	if err := p.saveLinks(task.ID, result.Links); err != nil {
-		log.Printf("Failed to save link details: %v", err)
-		// This is not critical, so we don't fail the task
+	default:
+		// Put the task back in the queue so it resumes after the restart
+		log.Printf("Task %d was interrupted after %d pages: %v", task.ID, pages, cause)
+		finished, err := p.taskRepo.FinishRun(writeCtx, task.ID, owner, db.TaskStatusPending, nil)
+		if err != nil {
+			return err
+		}
+		if !finished {
+			return cause
+		}
+		p.taskRepo.UpdateProgress(writeCtx, task.ID, 0.0)
+		p.sendProgressUpdate(task.WorkspaceID, task.ID, 0.0, "Crawl interrupted by a server restart, it will resume shortly")
+		return cause
 	}
+}
 
-	// Update progress to 100% - completed
-	p.taskRepo.UpdateProgress(task.ID, 100.0)
-	if err := p.taskRepo.UpdateStatus(task.ID, db.TaskStatusCompleted); err != nil {
-		log.Printf("Failed to update task status to completed: %v", err)
-	}
+// progressTracker converts page and link counts into a task progress percentage
+type progressTracker struct {
+	pagesDone  int
+	pagesTotal int
+	last       float64
+}
 
-	completedAt := time.Now()
-	if err := p.taskRepo.UpdateCompletedAt(task.ID, &completedAt); err != nil {
-		log.Printf("Failed to update completion time: %v", err)
+// update returns the progress given how much of the current page is done.
+// The page total grows as links are discovered, so progress never moves
+// backwards and the last percent is kept for completion.
+func (t *progressTracker) update(pageShare float64) float64 {
+	total := t.pagesTotal
+	if total < t.pagesDone+1 {
+		total = t.pagesDone + 1
 	}
 
-	p.sendProgressUpdate(task.UserID, task.ID, 100.0, "Crawling completed successfully!")
+	progress := (float64(t.pagesDone) + pageShare) / float64(total) * 100
+	if progress > 99 {
+		progress = 99
+	}
+	if progress < t.last {
+		progress = t.last
+	}
+	t.last = progress
+	return progress
+}
 
-	// Send final results via WebSocket
-	p.sendResultsUpdate(task.UserID, task.ID, dbResult)
+// siteOptions builds the site crawl options of a task. Single page tasks are
+// crawled as a site of exactly one page.
+func siteOptions(task *db.CrawlTask) SiteOptions {
+	if task.CrawlMode != db.CrawlModeSite {
+		return SiteOptions{MaxDepth: 0, MaxPages: 1, Scope: db.CrawlScopeHost, IgnoreRobots: task.IgnoreRobots}
+	}
 
-	log.Printf("Task %d completed successfully in %v", task.ID, time.Since(startTime))
-	return nil
+	return SiteOptions{
+		MaxDepth:     task.MaxDepth,
+		MaxPages:     task.MaxPages,
+		Scope:        task.CrawlScope,
+		IgnoreRobots: task.IgnoreRobots,
+	}
 }
 
-// convertToDBResult converts crawler result to database result format
-func (p *Processor) convertToDBResult(taskID int, result *CrawlResult) *db.CrawlResult {
+// convertToDBResult converts a crawled page to database result format
+func (p *Processor) convertToDBResult(taskID int, page *PageResult) *db.CrawlResult {
+	result := page.CrawlResult
+	pageURL := page.URL
+
 	// Handle nil page title
 	var pageTitle *string
 	if result.PageTitle != "" {
@@ -135,6 +278,8 @@ func (p *Processor) convertToDBResult(taskID int, result *CrawlResult) *db.Crawl
 
 	return &db.CrawlResult{
 		TaskID:                 taskID,
+		PageURL:                &pageURL,
+		Depth:                  page.Depth,
 		HTMLVersion:            htmlVersion,
 		PageTitle:              pageTitle,
 		H1Count:                result.HeadingCounts["h1"],
@@ -153,14 +298,16 @@ func (p *Processor) convertToDBResult(taskID int, result *CrawlResult) *db.Crawl
 	}
 }
 
-// saveLinks saves detailed link information to the database
-func (p *Processor) saveLinks(taskID int, links []LinkInfo) error {
+// saveLinks saves detailed link information found on a page to the database
+func (p *Processor) saveLinks(ctx context.Context, taskID int, pageURL string, links []LinkInfo) error {
 	for _, link := range links {
 		dbLink := &db.CrawlLink{
 			TaskID:         taskID,
+			PageURL:        &pageURL,
 			URL:            link.URL,
 			LinkType:       link.LinkType,
 			IsAccessible:   link.IsAccessible,
+			CheckStatus:    link.CheckStatus,
 			ResponseTimeMs: link.ResponseTime,
 		}
 
@@ -172,12 +319,15 @@ func (p *Processor) saveLinks(taskID int, links []LinkInfo) error {
 			dbLink.AnchorText = &link.AnchorText
 		}
 
-		if link.IsAccessible {
+		if link.IsAccessible && link.CheckStatus == db.LinkCheckStatusChecked {
 			now := time.Now()
 			dbLink.CheckedAt = &now
 		}
 
-		if err := p.linkRepo.Create(dbLink); err != nil {
+		if err := p.linkRepo.Create(ctx, dbLink); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			log.Printf("Failed to save link %s: %v", link.URL, err)
 			// Continue with other links instead of failing completely
 		}
@@ -186,33 +336,67 @@ func (p *Processor) saveLinks(taskID int, links []LinkInfo) error {
 	return nil
 }
 
-// sendProgressUpdate sends progress updates via WebSocket
-func (p *Processor) sendProgressUpdate(userID, taskID int, progress float64, message string) {
-	update := map[string]interface{}{
-		"type":     "progress_update",
+// sendProgressUpdate publishes a progress update of a task
+func (p *Processor) sendProgressUpdate(workspaceID, taskID int, progress float64, message string) {
+	p.bus.PublishTask(workspaceID, taskID, events.Message{
+		"type":     events.TypeProgress,
 		"task_id":  taskID,
 		"progress": progress,
 		"message":  message,
-	}
-
-	if data, err := json.Marshal(update); err == nil {
-		p.wsHub.BroadcastToUser(userID, data)
-	} else {
-		log.Printf("Failed to marshal progress update: %v", err)
-	}
+	})
 }
 
-// sendResultsUpdate sends final results via WebSocket
-func (p *Processor) sendResultsUpdate(userID, taskID int, result *db.CrawlResult) {
-	update := map[string]interface{}{
-		"type":    "results_update",
+// sendResultsUpdate publishes the final results of a task
+func (p *Processor) sendResultsUpdate(workspaceID, taskID int, result *db.CrawlResult) {
+	p.bus.PublishTask(workspaceID, taskID, events.Message{
+		"type":    events.TypeResults,
 		"task_id": taskID,
 		"results": result,
-	}
+	})
+}
 
-	if data, err := json.Marshal(update); err == nil {
-		p.wsHub.BroadcastToUser(userID, data)
-	} else {
-		log.Printf("Failed to marshal results update: %v", err)
+// sendFailedUpdate publishes the error that made a task fail
+func (p *Processor) sendFailedUpdate(workspaceID, taskID int, errorMsg string) {
+	p.bus.PublishTask(workspaceID, taskID, events.Message{
+		"type":    events.TypeFailed,
+		"task_id": taskID,
+		"error":   errorMsg,
+	})
+}
+
+// sendStoppedUpdate publishes that a task was stopped
+func (p *Processor) sendStoppedUpdate(workspaceID, taskID int) {
+	p.bus.PublishTask(workspaceID, taskID, events.Message{
+		"type":    events.TypeStopped,
+		"task_id": taskID,
+	})
+}
+
+// NotifyStopped publishes that a task was stopped and sends the task.stopped
+// webhook event
+func (p *Processor) NotifyStopped(ctx context.Context, task *db.CrawlTask) {
+	p.sendProgressUpdate(task.WorkspaceID, task.ID, 0.0, "Crawl stopped")
+	p.sendStoppedUpdate(task.WorkspaceID, task.ID)
+	p.hooks.Notify(ctx, task, webhook.EventTaskStopped, webhook.NewTaskEvent(task, db.TaskStatusCancelled))
+}
+
+// notifyCompleted sends the task.completed webhook event, and
+// task.broken_links when the crawl found inaccessible links
+func (p *Processor) notifyCompleted(ctx context.Context, task *db.CrawlTask, pages, brokenLinks int, result *db.CrawlResult) {
+	data := webhook.NewTaskEvent(task, db.TaskStatusCompleted)
+	data.Pages = &pages
+	data.BrokenLinks = &brokenLinks
+	data.Results = result
+
+	p.hooks.Notify(ctx, task, webhook.EventTaskCompleted, data)
+	if brokenLinks > 0 {
+		p.hooks.Notify(ctx, task, webhook.EventBrokenLinks, data)
 	}
 }
+
+// notifyFailed sends the task.failed webhook event
+func (p *Processor) notifyFailed(ctx context.Context, task *db.CrawlTask, errorMsg string) {
+	data := webhook.NewTaskEvent(task, db.TaskStatusFailed)
+	data.Error = errorMsg
+	p.hooks.Notify(ctx, task, webhook.EventTaskFailed, data)
+}
@@ -0,0 +1,333 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowedByRobots is returned when robots.txt forbids fetching a page
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+const (
+	// robotsCacheTTL is how long a fetched robots.txt is reused for a host
+	robotsCacheTTL = time.Hour
+	// robotsMaxSize limits how much of a robots.txt file is read
+	robotsMaxSize = 512 * 1024
+	// robotsFetchTimeout bounds a robots.txt fetch, which outlives the
+	// request of the task that started it
+	robotsFetchTimeout = 10 * time.Second
+)
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	pattern string
+	re      *regexp.Regexp
+	allow   bool
+}
+
+// RobotsRules are the robots.txt rules that apply to our user-agent on one host
+type RobotsRules struct {
+	rules       []robotsRule
+	disallowAll bool
+	CrawlDelay  time.Duration
+}
+
+// Allowed reports whether the given path (including query) may be fetched.
+// The longest matching rule wins and Allow wins ties, as described in RFC 9309.
+func (r *RobotsRules) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	matched := -1
+	allowed := true
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		length := len(rule.pattern)
+		if length > matched || (length == matched && rule.allow) {
+			matched = length
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// newRobotsRule compiles a robots.txt path pattern, supporting "*" wildcards
+// and a trailing "$" end anchor
+func newRobotsRule(pattern string, allow bool) robotsRule {
+	anchored := strings.HasSuffix(pattern, "$")
+	expr := regexp.QuoteMeta(strings.TrimSuffix(pattern, "$"))
+	expr = "^" + strings.ReplaceAll(expr, `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+
+	return robotsRule{
+		pattern: pattern,
+		re:      regexp.MustCompile(expr),
+		allow:   allow,
+	}
+}
+
+// parseRobots extracts the rules for userAgent from a robots.txt file. The most
+// specific matching user-agent group is used, falling back to "*".
+func parseRobots(body io.Reader, userAgent string) *RobotsRules {
+	type group struct {
+		agents []string
+		rules  []robotsRule
+		delay  time.Duration
+	}
+
+	var groups []*group
+	var current *group
+	lastWasAgent := false
+	token := strings.ToLower(userAgent)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || !lastWasAgent {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			// An empty Disallow allows everything, so it adds no rule
+			if current != nil && value != "" {
+				current.rules = append(current.rules, newRobotsRule(value, key == "allow"))
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.delay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+
+	// Pick the group whose user-agent is the longest match for our token
+	var best *group
+	bestLen := -1
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			length := -1
+			if agent == "*" {
+				length = 0
+			} else if agent != "" && strings.Contains(token, agent) {
+				length = len(agent)
+			}
+			if length > bestLen {
+				best, bestLen = g, length
+			}
+		}
+	}
+
+	if best == nil {
+		return &RobotsRules{}
+	}
+	return &RobotsRules{rules: best.rules, CrawlDelay: best.delay}
+}
+
+// robotsEntry is a cached robots.txt, fetched once per host
+type robotsEntry struct {
+	ready     chan struct{}
+	rules     *RobotsRules
+	fetchedAt time.Time
+}
+
+// RobotsCache fetches and caches robots.txt per host and spaces out requests
+// to hosts that ask for a Crawl-delay
+type RobotsCache struct {
+	client    *http.Client
+	userAgent string
+	maxDelay  time.Duration
+
+	mu          sync.Mutex
+	entries     map[string]*robotsEntry
+	nextRequest map[string]time.Time
+	lastPrune   time.Time
+}
+
+// NewRobotsCache creates a new robots.txt cache for the given user-agent token
+func NewRobotsCache(userAgent string, maxDelay time.Duration) *RobotsCache {
+	return &RobotsCache{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		userAgent:   userAgent,
+		maxDelay:    maxDelay,
+		entries:     make(map[string]*robotsEntry),
+		nextRequest: make(map[string]time.Time),
+	}
+}
+
+// UserAgent returns the User-Agent header sent with crawler requests
+func (c *RobotsCache) UserAgent() string {
+	return c.userAgent + "/1.0"
+}
+
+// Rules returns the robots.txt rules for the host of u, fetching them if needed
+func (c *RobotsCache) Rules(ctx context.Context, u *url.URL) *RobotsRules {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	c.pruneLocked()
+	entry, ok := c.entries[key]
+	if ok {
+		// Refetch expired entries; entries still being fetched are waited on below
+		select {
+		case <-entry.ready:
+			ok = time.Since(entry.fetchedAt) <= robotsCacheTTL
+		default:
+		}
+	}
+	if !ok {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		c.entries[key] = entry
+		c.mu.Unlock()
+
+		// Other tasks wait for this fetch, so it must not be cut short when
+		// the task that started it is cancelled
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), robotsFetchTimeout)
+		entry.rules = c.fetch(fetchCtx, key+"/robots.txt")
+		cancel()
+		entry.fetchedAt = time.Now()
+		close(entry.ready)
+		return entry.rules
+	}
+	c.mu.Unlock()
+
+	<-entry.ready
+	return entry.rules
+}
+
+// pruneLocked forgets expired robots.txt files and request slots that already
+// passed, at most once per cache period, so that hosts seen once do not stay
+// in memory. c.mu must be held.
+func (c *RobotsCache) pruneLocked() {
+	now := time.Now()
+	if now.Sub(c.lastPrune) < robotsCacheTTL {
+		return
+	}
+	c.lastPrune = now
+
+	for key, entry := range c.entries {
+		select {
+		case <-entry.ready:
+			if now.Sub(entry.fetchedAt) > robotsCacheTTL {
+				delete(c.entries, key)
+			}
+		default:
+			// Still being fetched
+		}
+	}
+	for host, next := range c.nextRequest {
+		if next.Before(now) {
+			delete(c.nextRequest, host)
+		}
+	}
+}
+
+// Allowed reports whether robots.txt allows fetching u
+func (c *RobotsCache) Allowed(ctx context.Context, u *url.URL) bool {
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return c.Rules(ctx, u).Allowed(path)
+}
+
+// Wait blocks until the Crawl-delay of u's host has passed since the previous
+// request to it, or until ctx is done. Delays longer than the configured
+// maximum are capped.
+func (c *RobotsCache) Wait(ctx context.Context, u *url.URL) error {
+	delay := c.Rules(ctx, u).CrawlDelay
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	if c.maxDelay > 0 && delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+
+	// Reserve the next slot for this host, then sleep until it arrives
+	c.mu.Lock()
+	now := time.Now()
+	next := c.nextRequest[u.Host]
+	if next.Before(now) {
+		next = now
+	}
+	c.nextRequest[u.Host] = next.Add(delay)
+	c.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetch downloads and parses a robots.txt file. A missing file allows
+// everything and a server error disallows everything, as described in
+// RFC 9309. Unreachable hosts are allowed so their links are reported as
+// broken rather than disallowed.
+func (c *RobotsCache) fetch(ctx context.Context, robotsURL string) *RobotsRules {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return &RobotsRules{}
+	}
+	req.Header.Set("User-Agent", c.UserAgent())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Printf("Failed to fetch %s: %v", robotsURL, err)
+		return &RobotsRules{}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), c.userAgent)
+	case resp.StatusCode >= 500:
+		return &RobotsRules{disallowAll: true}
+	default:
+		return &RobotsRules{}
+	}
+}
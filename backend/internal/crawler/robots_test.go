@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobotsGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		robots  string
+		path    string
+		allowed bool
+	}{
+		{
+			name:    "no groups",
+			robots:  "# nothing here\n",
+			path:    "/private",
+			allowed: true,
+		},
+		{
+			name:    "wildcard group",
+			robots:  "User-agent: *\nDisallow: /private\n",
+			path:    "/private/page",
+			allowed: false,
+		},
+		{
+			name:    "group of another agent is ignored",
+			robots:  "User-agent: OtherBot\nDisallow: /\n",
+			path:    "/page",
+			allowed: true,
+		},
+		{
+			name:    "own group wins over wildcard group",
+			robots:  "User-agent: *\nDisallow: /\n\nUser-agent: WebCrawler\nDisallow: /private\n",
+			path:    "/page",
+			allowed: true,
+		},
+		{
+			name:    "own group applies its own rules",
+			robots:  "User-agent: *\nDisallow: /\n\nUser-agent: WebCrawler\nDisallow: /private\n",
+			path:    "/private",
+			allowed: false,
+		},
+		{
+			name:    "agent names are case insensitive",
+			robots:  "User-agent: *\nDisallow: /\n\nuser-agent: webcrawler\nallow: /\n",
+			path:    "/page",
+			allowed: true,
+		},
+		{
+			name:    "longest matching agent wins",
+			robots:  "User-agent: Web\nDisallow: /\n\nUser-agent: WebCrawler\nDisallow:\n",
+			path:    "/page",
+			allowed: true,
+		},
+		{
+			name:    "consecutive agent lines share a group",
+			robots:  "User-agent: OtherBot\nUser-agent: WebCrawler\nDisallow: /shared\n",
+			path:    "/shared",
+			allowed: false,
+		},
+		{
+			name:    "agent line after rules starts a new group",
+			robots:  "User-agent: WebCrawler\nDisallow: /mine\nUser-agent: OtherBot\nDisallow: /theirs\n",
+			path:    "/theirs",
+			allowed: true,
+		},
+		{
+			name:    "comments are ignored",
+			robots:  "User-agent: * # everyone\nDisallow: /private # keep out\n",
+			path:    "/private",
+			allowed: false,
+		},
+		{
+			name:    "empty disallow allows everything",
+			robots:  "User-agent: *\nDisallow:\n",
+			path:    "/anything",
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots), "WebCrawler")
+			if got := rules.Allowed(tt.path); got != tt.allowed {
+				t.Errorf("Allowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsRulesAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		path    string
+		allowed bool
+	}{
+		{"no matching rule", "Disallow: /private", "/public", true},
+		{"prefix match", "Disallow: /private", "/private-notes", false},
+		{"empty path is the root", "Disallow: /$", "", false},
+		{"robots.txt is always allowed", "Disallow: /", "/robots.txt", true},
+		{"longer allow wins", "Disallow: /docs\nAllow: /docs/public", "/docs/public/a", true},
+		{"longer disallow wins", "Allow: /docs\nDisallow: /docs/private", "/docs/private/a", false},
+		{"allow wins ties", "Disallow: /page\nAllow: /page", "/page", true},
+		{"allow wins ties in either order", "Allow: /page\nDisallow: /page", "/page", true},
+		{"wildcard", "Disallow: /*.pdf", "/files/report.pdf", false},
+		{"wildcard needs the rest to match", "Disallow: /*.pdf", "/files/report.html", true},
+		{"end anchor matches the end", "Disallow: /*.php$", "/index.php", false},
+		{"end anchor rejects a longer path", "Disallow: /*.php$", "/index.php?id=1", true},
+		{"query is part of the path", "Disallow: /search?q=", "/search?q=go", false},
+		{"special characters are literal", "Disallow: /a+b", "/aab", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader("User-agent: *\n"+tt.rules+"\n"), "WebCrawler")
+			if got := rules.Allowed(tt.path); got != tt.allowed {
+				t.Errorf("Allowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsRulesNil(t *testing.T) {
+	var rules *RobotsRules
+	if !rules.Allowed("/private") {
+		t.Error("nil rules must allow everything")
+	}
+}
+
+func TestParseRobotsCrawlDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		delay  time.Duration
+	}{
+		{"seconds", "User-agent: *\nCrawl-delay: 2\n", 2 * time.Second},
+		{"fraction", "User-agent: *\nCrawl-delay: 0.5\n", 500 * time.Millisecond},
+		{"invalid", "User-agent: *\nCrawl-delay: soon\n", 0},
+		{"negative", "User-agent: *\nCrawl-delay: -1\n", 0},
+		{"other group", "User-agent: OtherBot\nCrawl-delay: 10\n", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots), "WebCrawler")
+			if rules.CrawlDelay != tt.delay {
+				t.Errorf("CrawlDelay = %v, want %v", rules.CrawlDelay, tt.delay)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -8,18 +9,26 @@ import (
 	"net/url"
 	"strings"
 	"time"
+	"web-crawler/config"
+	"web-crawler/internal/db"
 
 	"golang.org/x/net/html"
 )
 
 // Service handles web crawling operations
 type Service struct {
-	client *http.Client
+	client      *http.Client
+	robots      *RobotsCache
+	linkChecker *LinkChecker
 }
 
 // NewService creates a new crawler service
 func NewService() *Service {
+	cfg := config.Load()
+	robots := NewRobotsCache(cfg.Crawler.UserAgent, cfg.Crawler.MaxCrawlDelay)
 	return &Service{
+		robots:      robots,
+		linkChecker: NewLinkChecker(cfg.Crawler.LinkCheckWorkers, cfg.Crawler.LinkCheckPerHost, robots),
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -55,17 +64,51 @@ type LinkInfo struct {
 	AnchorText   string
 	StatusCode   int
 	IsAccessible bool
+	CheckStatus  string // "checked", "skipped" or "disallowed"
 	ResponseTime int
+
+	// checkURL is the absolute URL whose accessibility still has to be checked
+	checkURL string
+}
+
+// PageOptions controls how a single page is crawled
+type PageOptions struct {
+	// IgnoreRobots skips robots.txt rules and Crawl-delay
+	IgnoreRobots bool
+	// OnLinkProgress, if set, is called while the links found on the page are checked
+	OnLinkProgress LinkProgressFunc
 }
 
-// CrawlPage crawls and analyzes a single webpage
-func (s *Service) CrawlPage(targetURL string) (*CrawlResult, error) {
+// CrawlPage crawls and analyzes a single webpage. All requests are aborted
+// as soon as ctx is done.
+func (s *Service) CrawlPage(ctx context.Context, targetURL string, opts PageOptions) (*CrawlResult, error) {
 	log.Printf("Starting to crawl URL: %s", targetURL)
 
+	baseURL, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+
+	// Respect robots.txt unless the task overrides it
+	if !opts.IgnoreRobots {
+		if !s.robots.Allowed(ctx, baseURL) {
+			return nil, ErrDisallowedByRobots
+		}
+		if err := s.robots.Wait(ctx, baseURL); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("User-Agent", s.robots.UserAgent())
+
 	startTime := time.Now()
 
 	// Fetch the webpage
-	resp, err := s.client.Get(targetURL)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch page: %v", err)
 	}
@@ -109,9 +152,17 @@ func (s *Service) CrawlPage(targetURL string) (*CrawlResult, error) {
 	// Count heading tags
 	s.countHeadings(doc, result.HeadingCounts)
 
-	// Analyze links
-	baseURL, _ := url.Parse(targetURL)
+	// Analyze links, then check their accessibility concurrently
 	s.analyzeLinks(doc, baseURL, result)
+	if err := s.linkChecker.CheckLinks(ctx, result.Links, opts.IgnoreRobots, opts.OnLinkProgress); err != nil {
+		return nil, err
+	}
+
+	for _, link := range result.Links {
+		if !link.IsAccessible {
+			result.InaccessibleLinksCount++
+		}
+	}
 
 	// Check for login form
 	result.HasLoginForm = s.hasLoginForm(doc)
@@ -198,7 +249,7 @@ func (s *Service) countHeadings(node *html.Node, counts map[string]int) {
 	}
 }
 
-// analyzeLinks finds and analyzes all links on the page
+// analyzeLinks finds and classifies all links on the page
 func (s *Service) analyzeLinks(node *html.Node, baseURL *url.URL, result *CrawlResult) {
 	if node.Type == html.ElementNode && node.Data == "a" {
 		var href, anchorText string
@@ -224,10 +275,6 @@ func (s *Service) analyzeLinks(node *html.Node, baseURL *url.URL, result *CrawlR
 				result.ExternalLinksCount++
 			}
 
-			if !linkInfo.IsAccessible {
-				result.InaccessibleLinksCount++
-			}
-
 			result.TotalLinksCount++
 		}
 	}
@@ -237,7 +284,8 @@ func (s *Service) analyzeLinks(node *html.Node, baseURL *url.URL, result *CrawlR
 	}
 }
 
-// processLink processes a single link and determines its type and accessibility
+// processLink processes a single link and determines its type. Links that
+// need an accessibility check are marked for the link checker.
 func (s *Service) processLink(href, anchorText string, baseURL *url.URL) LinkInfo {
 	linkInfo := LinkInfo{
 		URL:        href,
@@ -251,6 +299,7 @@ func (s *Service) processLink(href, anchorText string, baseURL *url.URL) LinkInf
 		strings.HasPrefix(href, "#") {
 		linkInfo.LinkType = "internal"
 		linkInfo.IsAccessible = true
+		linkInfo.CheckStatus = db.LinkCheckStatusSkipped
 		return linkInfo
 	}
 
@@ -259,6 +308,7 @@ func (s *Service) processLink(href, anchorText string, baseURL *url.URL) LinkInf
 	if err != nil {
 		linkInfo.LinkType = "external"
 		linkInfo.IsAccessible = false
+		linkInfo.CheckStatus = db.LinkCheckStatusChecked
 		return linkInfo
 	}
 
@@ -275,40 +325,12 @@ func (s *Service) processLink(href, anchorText string, baseURL *url.URL) LinkInf
 		linkInfo.LinkType = "external"
 	}
 
-	// Check link accessibility (with timeout to avoid hanging)
-	linkInfo.IsAccessible, linkInfo.StatusCode, linkInfo.ResponseTime = s.checkLinkAccessibility(linkURL.String())
+	// Accessibility is checked later by the link checker
+	linkInfo.checkURL = linkURL.String()
 
 	return linkInfo
 }
 
-// checkLinkAccessibility checks if a link is accessible
-func (s *Service) checkLinkAccessibility(linkURL string) (bool, int, int) {
-	startTime := time.Now()
-
-	// Create a client with shorter timeout for link checking
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	// Use HEAD request to check accessibility without downloading content
-	resp, err := client.Head(linkURL)
-	responseTime := int(time.Since(startTime).Milliseconds())
-
-	if err != nil {
-		// If HEAD fails, try GET request
-		resp, err = client.Get(linkURL)
-		if err != nil {
-			return false, 0, responseTime
-		}
-	}
-	defer resp.Body.Close()
-
-	statusCode := resp.StatusCode
-	isAccessible := statusCode >= 200 && statusCode < 400
-
-	return isAccessible, statusCode, responseTime
-}
-
 // hasLoginForm checks if the page contains a login form
 func (s *Service) hasLoginForm(node *html.Node) bool {
 	if node.Type == html.ElementNode {
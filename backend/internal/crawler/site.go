@@ -0,0 +1,204 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"web-crawler/internal/db"
+)
+
+// Site crawl defaults used when a request does not set its own limits
+const (
+	DefaultSiteMaxDepth = 2
+	DefaultSiteMaxPages = 50
+)
+
+// skippedExtensions lists file extensions that are never followed during a site crawl
+var skippedExtensions = map[string]bool{
+	".pdf": true, ".zip": true, ".gz": true, ".tar": true, ".rar": true, ".7z": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true, ".webp": true, ".ico": true,
+	".mp3": true, ".mp4": true, ".avi": true, ".mov": true, ".webm": true,
+	".css": true, ".js": true, ".json": true, ".xml": true, ".txt": true,
+	".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+	".exe": true, ".dmg": true, ".woff": true, ".woff2": true, ".ttf": true,
+}
+
+// SiteOptions controls how far a site crawl follows internal links
+type SiteOptions struct {
+	MaxDepth int
+	MaxPages int
+	Scope    string // db.CrawlScopeHost or db.CrawlScopeSubdomain
+	// IgnoreRobots skips robots.txt rules and Crawl-delay
+	IgnoreRobots bool
+}
+
+// PageResult contains the analysis of a single page visited during a site crawl
+type PageResult struct {
+	URL   string
+	Depth int
+	*CrawlResult
+}
+
+// PageHandler is called after every page of a site crawl. crawled is the number of
+// pages analyzed so far and total the number of pages the crawl expects to visit.
+// Returning an error aborts the crawl.
+type PageHandler func(page *PageResult, crawled, total int) error
+
+// siteTarget is a page waiting to be crawled
+type siteTarget struct {
+	url   string
+	depth int
+}
+
+// CrawlSite crawls startURL and follows internal links breadth-first within the
+// configured scope until MaxDepth or MaxPages is reached. A failure on the start
+// page aborts the crawl; failures on discovered pages are logged and skipped.
+// onLinkProgress is passed to CrawlPage for every page. The crawl stops as
+// soon as ctx is done. It returns the number of pages crawled.
+func (s *Service) CrawlSite(ctx context.Context, startURL string, opts SiteOptions, onPage PageHandler, onLinkProgress LinkProgressFunc) (int, error) {
+	if opts.MaxPages < 1 {
+		opts.MaxPages = 1
+	}
+	if opts.MaxDepth < 0 {
+		opts.MaxDepth = 0
+	}
+
+	root, err := url.Parse(startURL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid start URL: %v", err)
+	}
+
+	visited := map[string]bool{normalizeURL(root): true}
+	queue := []siteTarget{{url: startURL, depth: 0}}
+	crawled := 0
+
+	for len(queue) > 0 && crawled < opts.MaxPages {
+		target := queue[0]
+		queue = queue[1:]
+
+		result, err := s.CrawlPage(ctx, target.url, PageOptions{
+			IgnoreRobots:   opts.IgnoreRobots,
+			OnLinkProgress: onLinkProgress,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return crawled, ctx.Err()
+			}
+			if target.depth == 0 {
+				return crawled, err
+			}
+			log.Printf("Skipping page %s: %v", target.url, err)
+			continue
+		}
+		crawled++
+
+		if target.depth < opts.MaxDepth {
+			for _, link := range result.Links {
+				// Links that failed their accessibility check or that robots.txt
+				// disallows are not worth fetching again
+				if !link.IsAccessible || link.CheckStatus == db.LinkCheckStatusDisallowed {
+					continue
+				}
+				linkURL, ok := s.followable(link.URL, root, opts.Scope)
+				if !ok {
+					continue
+				}
+				key := normalizeURL(linkURL)
+				if visited[key] {
+					continue
+				}
+				visited[key] = true
+				queue = append(queue, siteTarget{url: linkURL.String(), depth: target.depth + 1})
+			}
+		}
+
+		total := crawled + len(queue)
+		if total > opts.MaxPages {
+			total = opts.MaxPages
+		}
+
+		page := &PageResult{URL: target.url, Depth: target.depth, CrawlResult: result}
+		if err := onPage(page, crawled, total); err != nil {
+			return crawled, err
+		}
+	}
+
+	if crawled == 0 {
+		return 0, errors.New("no pages could be crawled")
+	}
+
+	return crawled, nil
+}
+
+// followable reports whether a discovered link should be crawled as part of the site
+func (s *Service) followable(rawURL string, root *url.URL, scope string) (*url.URL, bool) {
+	linkURL, err := url.Parse(rawURL)
+	if err != nil || !linkURL.IsAbs() {
+		return nil, false
+	}
+	if linkURL.Scheme != "http" && linkURL.Scheme != "https" {
+		return nil, false
+	}
+	if skippedExtensions[strings.ToLower(path.Ext(linkURL.Path))] {
+		return nil, false
+	}
+	if !inScope(linkURL.Hostname(), root.Hostname(), scope) {
+		return nil, false
+	}
+
+	linkURL.Fragment = ""
+	return linkURL, true
+}
+
+// inScope checks whether host belongs to the crawl scope of rootHost
+func inScope(host, rootHost, scope string) bool {
+	host = strings.ToLower(host)
+	rootHost = strings.ToLower(rootHost)
+
+	if host == rootHost {
+		return true
+	}
+	if scope != db.CrawlScopeSubdomain {
+		return false
+	}
+
+	domain := strings.TrimPrefix(rootHost, "www.")
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// NormalizeURL returns the canonical form of a URL, which identifies the runs
+// of the same URL. URLs that cannot be parsed are returned unchanged.
+func NormalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	return normalizeURL(u)
+}
+
+// normalizeURL returns a canonical form of a URL used to detect already visited pages
+func normalizeURL(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+
+	normalized := scheme + "://" + host + p
+	if u.RawQuery != "" {
+		normalized += "?" + u.RawQuery
+	}
+	return normalized
+}
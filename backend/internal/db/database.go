@@ -1,12 +1,18 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
+	"net/url"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 	"web-crawler/config"
 
@@ -140,46 +146,31 @@ func NewUserRepository(database *sql.DB) *UserRepository {
 }
 
 // GetByUsername retrieves a user by username
-func (r *UserRepository) GetByUsername(username string) (*User, error) {
-	var user User
-	err := r.db.QueryRow(
-		"SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE username = ?",
-		username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
-	}
-
-	return &user, nil
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return r.getBy(ctx, "username", username)
 }
 
 // GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(id int) (*User, error) {
-	var user User
-	err := r.db.QueryRow(
-		"SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE id = ?",
-		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*User, error) {
+	return r.getBy(ctx, "id", id)
+}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+// Create creates a new user together with their personal workspace. Users
+// without a role become members.
+func (r *UserRepository) Create(ctx context.Context, user *User) error {
+	if user.Role == "" {
+		user.Role = RoleMember
 	}
 
-	return &user, nil
-}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-// Create creates a new user
-func (r *UserRepository) Create(user *User) error {
-	result, err := r.db.Exec(
-		"INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)",
-		user.Username, user.Email, user.PasswordHash,
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO users (username, email, role, password_hash) VALUES (?, ?, ?, ?)",
+		user.Username, user.Email, user.Role, user.PasswordHash,
 	)
 	if err != nil {
 		return err
@@ -190,18 +181,59 @@ func (r *UserRepository) Create(user *User) error {
 		return err
 	}
 
-	user.ID = int(id)
+	userID := int(id)
+	workspace := &Workspace{Name: PersonalWorkspaceName(user.Username), PersonalUserID: &userID}
+	if err := createWorkspace(ctx, tx, workspace, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	user.ID = userID
 	return nil
 }
 
 // GetByEmail retrieves a user by email
-func (r *UserRepository) GetByEmail(email string) (*User, error) {
-	var user User
-	err := r.db.QueryRow(
-		"SELECT id, username, email, password_hash, created_at, updated_at FROM users WHERE email = ?",
-		email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return r.getBy(ctx, "email", email)
+}
+
+// UpdatePassword replaces the password hash of a user
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int, passwordHash string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, id)
+	return err
+}
+
+// UpdateEmail changes the email address of a user, which then needs to be
+// verified again
+func (r *UserRepository) UpdateEmail(ctx context.Context, id int, email string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET email = ?, email_verified_at = NULL WHERE id = ?", email, id)
+	return err
+}
+
+// MarkEmailVerified records that a user verified their email address. It
+// reports false when the user's address is no longer email.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id int, email string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = ? AND email = ?",
+		id, email,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
 
+// getBy retrieves the user whose column equals value
+func (r *UserRepository) getBy(ctx context.Context, column string, value interface{}) (*User, error) {
+	user, err := scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+column+" = ?", value))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -209,9 +241,148 @@ func (r *UserRepository) GetByEmail(email string) (*User, error) {
 		return nil, err
 	}
 
+	return user, nil
+}
+
+// UserFilter narrows down the user list of the admin API
+type UserFilter struct {
+	// Query is searched for in the username and the email address
+	Query string
+	// Role keeps users with the role
+	Role string
+}
+
+// where builds the WHERE clause of the users matching the filter
+func (f *UserFilter) where() (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if f.Query != "" {
+		pattern := "%" + escapeLike(f.Query) + "%"
+		conditions = append(conditions, "(username LIKE ? OR email LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+	if f.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, f.Role)
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// List retrieves the users matching the filter, oldest first, with pagination
+func (r *UserRepository) List(ctx context.Context, filter UserFilter, limit, offset int) ([]*User, error) {
+	where, args := filter.where()
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users "+where+" ORDER BY id LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Count counts the users matching the filter
+func (r *UserRepository) Count(ctx context.Context, filter UserFilter) (int, error) {
+	where, args := filter.where()
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where, args...).Scan(&count)
+	return count, err
+}
+
+// UpdateRole changes the role of a user
+func (r *UserRepository) UpdateRole(ctx context.Context, id int, role string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", role, id)
+	return err
+}
+
+// PromoteToAdmin gives the admin role to the users with the given usernames
+func (r *UserRepository) PromoteToAdmin(ctx context.Context, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(usernames))
+	args := []interface{}{RoleAdmin}
+	for i, username := range usernames {
+		placeholders[i] = "?"
+		args = append(args, username)
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE users SET role = ? WHERE username IN ("+strings.Join(placeholders, ", ")+")",
+		args...,
+	)
+	return err
+}
+
+// SetDisabled disables or re-enables the account of a user
+func (r *UserRepository) SetDisabled(ctx context.Context, id int, disabled bool) error {
+	if disabled {
+		_, err := r.db.ExecContext(ctx, "UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = ?", id)
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, "UPDATE users SET disabled_at = NULL WHERE id = ?", id)
+	return err
+}
+
+// userColumns lists the users columns read by scanUser
+const userColumns = "id, username, email, email_verified_at, role, disabled_at, password_hash, created_at, updated_at"
+
+// scanUser scans a row selected with userColumns into a User
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &user.Role, &user.DisabledAt,
+		&user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
+// taskColumns lists the crawl_tasks columns read by scanTask
+const taskColumns = `id, user_id, workspace_id, url, host, series_key, parent_task_id, schedule_id, crawl_mode, max_depth, max_pages, crawl_scope, ignore_robots, status, progress, error_message,
+	attempts, created_at, updated_at, started_at, completed_at, deleted_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask scans a row selected with taskColumns into a CrawlTask
+func scanTask(row rowScanner) (*CrawlTask, error) {
+	var task CrawlTask
+	err := row.Scan(&task.ID, &task.UserID, &task.WorkspaceID, &task.URL, &task.Host, &task.SeriesKey, &task.ParentTaskID, &task.ScheduleID, &task.CrawlMode, &task.MaxDepth, &task.MaxPages, &task.CrawlScope,
+		&task.IgnoreRobots, &task.Status, &task.Progress, &task.ErrorMessage, &task.Attempts, &task.CreatedAt, &task.UpdatedAt, &task.StartedAt, &task.CompletedAt, &task.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// inClause returns the placeholders and arguments of an IN (...) list
+func inClause(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
 // TaskRepository provides database operations for crawl tasks
 type TaskRepository struct {
 	db *sql.DB
@@ -223,33 +394,93 @@ func NewTaskRepository(database *sql.DB) *TaskRepository {
 }
 
 // Create creates a new crawl task
-func (r *TaskRepository) Create(task *CrawlTask) error {
-	result, err := r.db.Exec(
-		"INSERT INTO crawl_tasks (user_id, url, status, progress) VALUES (?, ?, ?, ?)",
-		task.UserID, task.URL, task.Status, task.Progress,
+func (r *TaskRepository) Create(ctx context.Context, task *CrawlTask) error {
+	_, err := r.CreateWithinQuota(ctx, task, 0)
+	return err
+}
+
+// CreateWithinQuota creates a new crawl task unless its user already has
+// maxQueued tasks waiting to run (0 means no limit), which it reports with
+// false. The user row is locked while counting, so concurrent requests of a
+// user cannot exceed the limit together.
+func (r *TaskRepository) CreateWithinQuota(ctx context.Context, task *CrawlTask, maxQueued int) (bool, error) {
+	if task.CrawlMode == "" {
+		task.CrawlMode = CrawlModePage
+	}
+	if task.CrawlScope == "" {
+		task.CrawlScope = CrawlScopeHost
+	}
+	if task.MaxPages < 1 {
+		task.MaxPages = 1
+	}
+	if task.SeriesKey == "" {
+		task.SeriesKey = task.URL
+	}
+	if task.Host == "" {
+		task.Host = hostOf(task.URL)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if maxQueued > 0 {
+		var queued int
+		if err := lockUser(ctx, tx, task.UserID); err != nil {
+			return false, err
+		}
+		err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM crawl_tasks WHERE user_id = ? AND status = ? AND deleted_at IS NULL",
+			task.UserID, TaskStatusPending,
+		).Scan(&queued)
+		if err != nil {
+			return false, err
+		}
+		if queued >= maxQueued {
+			return false, nil
+		}
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO crawl_tasks (user_id, workspace_id, url, host, series_key, parent_task_id, schedule_id, crawl_mode, max_depth, max_pages, crawl_scope, ignore_robots, status, progress) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		task.UserID, task.WorkspaceID, task.URL, task.Host, task.SeriesKey, task.ParentTaskID, task.ScheduleID, task.CrawlMode, task.MaxDepth, task.MaxPages, task.CrawlScope, task.IgnoreRobots, task.Status, task.Progress,
 	)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return err
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
 	}
 
 	task.ID = int(id)
-	return nil
+	return true, nil
 }
 
-// GetByID retrieves a crawl task by ID
-func (r *TaskRepository) GetByID(id int) (*CrawlTask, error) {
-	var task CrawlTask
-	err := r.db.QueryRow(
-		`SELECT id, user_id, url, status, progress, error_message, created_at, updated_at, started_at, completed_at 
-		 FROM crawl_tasks WHERE id = ?`,
+// lockUser locks the row of a user until the end of tx, serializing the
+// transactions that enforce the per-user task limits
+func lockUser(ctx context.Context, tx *sql.Tx, userID int) error {
+	var id int
+	err := tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user %d not found", userID)
+	}
+	return err
+}
+
+// GetByID retrieves a crawl task by ID. Deleted tasks are not returned.
+func (r *TaskRepository) GetByID(ctx context.Context, id int) (*CrawlTask, error) {
+	task, err := scanTask(r.db.QueryRowContext(ctx,
+		"SELECT "+taskColumns+" FROM crawl_tasks WHERE id = ? AND deleted_at IS NULL",
 		id,
-	).Scan(&task.ID, &task.UserID, &task.URL, &task.Status, &task.Progress, &task.ErrorMessage,
-		&task.CreatedAt, &task.UpdatedAt, &task.StartedAt, &task.CompletedAt)
+	))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -258,14 +489,14 @@ func (r *TaskRepository) GetByID(id int) (*CrawlTask, error) {
 		return nil, err
 	}
 
-	return &task, nil
+	return task, nil
 }
 
-// GetByUserID retrieves crawl tasks for a specific user with pagination
-func (r *TaskRepository) GetByUserID(userID int, limit, offset int) ([]*CrawlTask, error) {
-	rows, err := r.db.Query(
-		`SELECT id, user_id, url, status, progress, error_message, created_at, updated_at, started_at, completed_at 
-		 FROM crawl_tasks WHERE user_id = ? ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+// GetByMemberID retrieves the crawl tasks of every workspace a user is a
+// member of, with pagination
+func (r *TaskRepository) GetByMemberID(ctx context.Context, userID int, limit, offset int) ([]*CrawlTask, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+taskColumns+" FROM crawl_tasks WHERE workspace_id IN ("+memberWorkspaces+") AND deleted_at IS NULL ORDER BY created_at DESC LIMIT ? OFFSET ?",
 		userID, limit, offset,
 	)
 	if err != nil {
@@ -275,159 +506,2560 @@ func (r *TaskRepository) GetByUserID(userID int, limit, offset int) ([]*CrawlTas
 
 	var tasks []*CrawlTask
 	for rows.Next() {
-		var task CrawlTask
-		err := rows.Scan(&task.ID, &task.UserID, &task.URL, &task.Status, &task.Progress,
-			&task.ErrorMessage, &task.CreatedAt, &task.UpdatedAt, &task.StartedAt, &task.CompletedAt)
+		task, err := scanTask(rows)
 		if err != nil {
 			return nil, err
 		}
-		tasks = append(tasks, &task)
+		tasks = append(tasks, task)
 	}
 
-	return tasks, nil
+	return tasks, rows.Err()
 }
 
-// UpdateStatus updates the status of a crawl task
-func (r *TaskRepository) UpdateStatus(id int, status string) error {
-	_, err := r.db.Exec(
-		"UPDATE crawl_tasks SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		status, id,
+// GetActiveIDsByUserID retrieves the IDs of the pending and running tasks of a user
+func (r *TaskRepository) GetActiveIDsByUserID(ctx context.Context, userID int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id FROM crawl_tasks WHERE user_id = ? AND status IN (?, ?) AND deleted_at IS NULL",
+		userID, TaskStatusPending, TaskStatusInProgress,
 	)
-	return err
-}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-// UpdateProgress updates the progress of a crawl task
-func (r *TaskRepository) UpdateProgress(id int, progress float64) error {
-	_, err := r.db.Exec(
-		"UPDATE crawl_tasks SET progress = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		progress, id,
-	)
-	return err
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
 }
 
-// UpdateStatusWithError updates the status and error message of a crawl task
-func (r *TaskRepository) UpdateStatusWithError(id int, status string, errorMessage *string) error {
-	_, err := r.db.Exec(
-		"UPDATE crawl_tasks SET status = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		status, errorMessage, id,
-	)
-	return err
+// CountByMemberID counts the crawl tasks of every workspace a user is a
+// member of
+func (r *TaskRepository) CountByMemberID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM crawl_tasks WHERE workspace_id IN ("+memberWorkspaces+") AND deleted_at IS NULL",
+		userID,
+	).Scan(&count)
+	return count, err
 }
 
-// UpdateCompletedAt updates the completion time of a crawl task
-func (r *TaskRepository) UpdateCompletedAt(id int, completedAt *time.Time) error {
-	_, err := r.db.Exec(
-		"UPDATE crawl_tasks SET completed_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		completedAt, id,
-	)
-	return err
+// memberWorkspaces selects the IDs of the workspaces the user bound to its
+// placeholder is a member of
+const memberWorkspaces = "SELECT workspace_id FROM workspace_members WHERE user_id = ?"
+
+// TaskFilter narrows down and orders the task list. Zero values do not filter.
+type TaskFilter struct {
+	// WorkspaceID keeps the tasks of one workspace
+	WorkspaceID int
+	// UserID keeps the tasks created by one user
+	UserID int
+	// Statuses keeps tasks in any of the given statuses
+	Statuses []string
+	// CreatedFrom and CreatedTo bound the creation time, both inclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// Domain keeps tasks whose host is the domain or one of its subdomains
+	Domain string
+	// HasBrokenLinks keeps tasks with, or without, inaccessible links
+	HasBrokenLinks *bool
+	// Query is searched for in the URL and the title of the start page
+	Query string
+	// Sort is one of TaskSortFields and defaults to "created_at"
+	Sort       string
+	Descending bool
 }
 
-// ResultRepository provides database operations for crawl results
-type ResultRepository struct {
-	db *sql.DB
+// brokenLinksExpr counts the inaccessible links found on every page of task t
+const brokenLinksExpr = "(SELECT COALESCE(SUM(inaccessible_links_count), 0) FROM crawl_results WHERE task_id = t.id)"
+
+// taskListFrom joins each task with the result of its start page, if any
+const taskListFrom = `FROM crawl_tasks t
+	LEFT JOIN crawl_results r ON r.id = (SELECT MIN(id) FROM crawl_results WHERE task_id = t.id AND depth = 0)`
+
+// taskSortColumns maps the sort fields of the task list to their expressions
+var taskSortColumns = map[string]string{
+	"created_at":     "t.created_at",
+	"updated_at":     "t.updated_at",
+	"completed_at":   "t.completed_at",
+	"url":            "t.url",
+	"host":           "t.host",
+	"status":         "t.status",
+	"progress":       "t.progress",
+	"title":          "r.page_title",
+	"html_version":   "r.html_version",
+	"response_time":  "r.response_time_ms",
+	"page_size":      "r.page_size_bytes",
+	"h1_count":       "r.h1_count",
+	"h2_count":       "r.h2_count",
+	"h3_count":       "r.h3_count",
+	"h4_count":       "r.h4_count",
+	"h5_count":       "r.h5_count",
+	"h6_count":       "r.h6_count",
+	"internal_links": "r.internal_links_count",
+	"external_links": "r.external_links_count",
+	"total_links":    "r.total_links_count",
+	"has_login_form": "r.has_login_form",
+	"broken_links":   brokenLinksExpr,
 }
 
-// NewResultRepository creates a new result repository
-func NewResultRepository(database *sql.DB) *ResultRepository {
-	return &ResultRepository{db: database}
+// TaskSortFields returns the fields the task list can be sorted on
+func TaskSortFields() []string {
+	fields := make([]string, 0, len(taskSortColumns))
+	for field := range taskSortColumns {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
 }
 
-// Create creates a new crawl result
-func (r *ResultRepository) Create(result *CrawlResult) error {
-	res, err := r.db.Exec(
-		`INSERT INTO crawl_results (task_id, html_version, page_title, h1_count, h2_count, h3_count, h4_count, h5_count, h6_count, 
-		 internal_links_count, external_links_count, inaccessible_links_count, has_login_form, total_links_count, response_time_ms, page_size_bytes) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		result.TaskID, result.HTMLVersion, result.PageTitle, result.H1Count, result.H2Count, result.H3Count, result.H4Count, result.H5Count, result.H6Count,
-		result.InternalLinksCount, result.ExternalLinksCount, result.InaccessibleLinksCount, result.HasLoginForm, result.TotalLinksCount, result.ResponseTimeMs, result.PageSizeBytes,
-	)
-	if err != nil {
-		return err
+// where builds the WHERE clause of the tasks visible to memberID matching
+// the filter. A memberID of 0 matches the tasks of every workspace.
+func (f *TaskFilter) where(memberID int) (string, []interface{}) {
+	conditions := []string{"t.deleted_at IS NULL"}
+	var args []interface{}
+	if memberID != 0 {
+		conditions = append(conditions, "t.workspace_id IN ("+memberWorkspaces+")")
+		args = append(args, memberID)
+	}
+	if f.WorkspaceID != 0 {
+		conditions = append(conditions, "t.workspace_id = ?")
+		args = append(args, f.WorkspaceID)
+	}
+	if f.UserID != 0 {
+		conditions = append(conditions, "t.user_id = ?")
+		args = append(args, f.UserID)
 	}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
+	if len(f.Statuses) > 0 {
+		placeholders := make([]string, len(f.Statuses))
+		for i, status := range f.Statuses {
+			placeholders[i] = "?"
+			args = append(args, status)
+		}
+		conditions = append(conditions, "t.status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if f.CreatedFrom != nil {
+		conditions = append(conditions, "t.created_at >= ?")
+		args = append(args, *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		conditions = append(conditions, "t.created_at <= ?")
+		args = append(args, *f.CreatedTo)
+	}
+	if f.Domain != "" {
+		domain := strings.ToLower(f.Domain)
+		conditions = append(conditions, "(t.host = ? OR t.host LIKE ?)")
+		args = append(args, domain, "%."+escapeLike(domain))
+	}
+	if f.HasBrokenLinks != nil {
+		if *f.HasBrokenLinks {
+			conditions = append(conditions, brokenLinksExpr+" > 0")
+		} else {
+			conditions = append(conditions, brokenLinksExpr+" = 0")
+		}
+	}
+	if f.Query != "" {
+		pattern := "%" + escapeLike(f.Query) + "%"
+		conditions = append(conditions, "(t.url LIKE ? OR r.page_title LIKE ?)")
+		args = append(args, pattern, pattern)
 	}
 
-	result.ID = int(id)
-	return nil
+	return "WHERE " + strings.Join(conditions, " AND "), args
 }
 
-// GetByTaskID retrieves crawl results for a specific task
-func (r *ResultRepository) GetByTaskID(taskID int) (*CrawlResult, error) {
-	var result CrawlResult
-	err := r.db.QueryRow(
-		`SELECT id, task_id, html_version, page_title, h1_count, h2_count, h3_count, h4_count, h5_count, h6_count, 
-		 internal_links_count, external_links_count, inaccessible_links_count, has_login_form, total_links_count, response_time_ms, page_size_bytes, created_at 
-		 FROM crawl_results WHERE task_id = ?`,
-		taskID,
-	).Scan(&result.ID, &result.TaskID, &result.HTMLVersion, &result.PageTitle, &result.H1Count, &result.H2Count, &result.H3Count, &result.H4Count, &result.H5Count, &result.H6Count,
-		&result.InternalLinksCount, &result.ExternalLinksCount, &result.InaccessibleLinksCount, &result.HasLoginForm, &result.TotalLinksCount, &result.ResponseTimeMs, &result.PageSizeBytes, &result.CreatedAt)
+// orderBy builds the ORDER BY clause of the filter, breaking ties by ID
+func (f *TaskFilter) orderBy() string {
+	column, ok := taskSortColumns[f.Sort]
+	if !ok {
+		column = taskSortColumns["created_at"]
+	}
+	direction := "ASC"
+	if f.Descending {
+		direction = "DESC"
+	}
+	return "ORDER BY " + column + " " + direction + ", t.id " + direction
+}
 
+// List retrieves the crawl tasks of the workspaces of a member matching the
+// filter, with pagination. A memberID of 0 lists the tasks of every workspace.
+func (r *TaskRepository) List(ctx context.Context, memberID int, filter TaskFilter, limit, offset int) ([]*CrawlTask, error) {
+	where, args := filter.where(memberID)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+qualify(taskColumns, "t")+" "+taskListFrom+" "+where+" "+filter.orderBy()+" LIMIT ? OFFSET ?",
+		args...,
+	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &result, nil
+	var tasks []*CrawlTask
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
 }
 
-// LinkRepository provides database operations for crawl links
-type LinkRepository struct {
-	db *sql.DB
+// Count counts the crawl tasks of the workspaces of a member, or of every
+// workspace when memberID is 0, matching the filter
+func (r *TaskRepository) Count(ctx context.Context, memberID int, filter TaskFilter) (int, error) {
+	where, args := filter.where(memberID)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) "+taskListFrom+" "+where, args...).Scan(&count)
+	return count, err
 }
 
-// NewLinkRepository creates a new link repository
-func NewLinkRepository(database *sql.DB) *LinkRepository {
-	return &LinkRepository{db: database}
+// qualify prefixes every column of a column list with a table alias
+func qualify(columns, alias string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
 }
 
-// Create creates a new crawl link
-func (r *LinkRepository) Create(link *CrawlLink) error {
-	result, err := r.db.Exec(
-		`INSERT INTO crawl_links (task_id, url, link_type, status_code, is_accessible, anchor_text, response_time_ms, checked_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		link.TaskID, link.URL, link.LinkType, link.StatusCode, link.IsAccessible, link.AnchorText, link.ResponseTimeMs, link.CheckedAt,
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// hostOf returns the lowercase host of a URL without its port, or an empty
+// string if it cannot be parsed
+func hostOf(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// seriesFilter matches the tasks of a series. Tasks created before series
+// were introduced have no key and are matched by their exact URL instead.
+const seriesFilter = "workspace_id = ? AND deleted_at IS NULL AND (series_key = ? OR (series_key = '' AND url = ?))"
+
+// GetSeries retrieves the runs of a URL in a workspace, newest first, with pagination
+func (r *TaskRepository) GetSeries(ctx context.Context, workspaceID int, seriesKey, rawURL string, limit, offset int) ([]*CrawlTask, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+taskColumns+" FROM crawl_tasks WHERE "+seriesFilter+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		workspaceID, seriesKey, rawURL, limit, offset,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
+
+	var tasks []*CrawlTask
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// GetPreviousInSeries retrieves the completed run of the same URL created
+// just before task, or nil if there is none
+func (r *TaskRepository) GetPreviousInSeries(ctx context.Context, task *CrawlTask) (*CrawlTask, error) {
+	previous, err := scanTask(r.db.QueryRowContext(ctx,
+		"SELECT "+taskColumns+" FROM crawl_tasks WHERE "+seriesFilter+" AND id < ? AND status = ? ORDER BY id DESC LIMIT 1",
+		task.WorkspaceID, task.SeriesKey, task.URL, task.ID, TaskStatusCompleted,
+	))
 
-	id, err := result.LastInsertId()
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	link.ID = int(id)
-	return nil
+	return previous, nil
 }
 
-// GetByTaskID retrieves crawl links for a specific task
-func (r *LinkRepository) GetByTaskID(taskID int) ([]*CrawlLink, error) {
-	rows, err := r.db.Query(
-		`SELECT id, task_id, url, link_type, status_code, is_accessible, anchor_text, response_time_ms, checked_at, created_at 
-		 FROM crawl_links WHERE task_id = ? ORDER BY created_at`,
-		taskID,
+// CountSeries counts the runs of a URL in a workspace
+func (r *TaskRepository) CountSeries(ctx context.Context, workspaceID int, seriesKey, rawURL string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM crawl_tasks WHERE "+seriesFilter,
+		workspaceID, seriesKey, rawURL,
+	).Scan(&count)
+	return count, err
+}
+
+// GetByIDs retrieves the crawl tasks with the given IDs. IDs that do not
+// exist or were deleted are left out of the result.
+func (r *TaskRepository) GetByIDs(ctx context.Context, ids []int) ([]*CrawlTask, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders, args := inClause(ids)
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+taskColumns+" FROM crawl_tasks WHERE id IN ("+placeholders+") AND deleted_at IS NULL ORDER BY id",
+		args...,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var links []*CrawlLink
+	var tasks []*CrawlTask
 	for rows.Next() {
-		var link CrawlLink
-		err := rows.Scan(&link.ID, &link.TaskID, &link.URL, &link.LinkType, &link.StatusCode,
-			&link.IsAccessible, &link.AnchorText, &link.ResponseTimeMs, &link.CheckedAt, &link.CreatedAt)
+		task, err := scanTask(rows)
 		if err != nil {
 			return nil, err
 		}
-		links = append(links, &link)
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+// DeleteByIDs removes crawl tasks together with their results and links in a
+// single transaction, so either all of them are deleted or none are
+func (r *TaskRepository) DeleteByIDs(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders, args := inClause(ids)
+	for _, table := range []string{"crawl_links", "crawl_results"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE task_id IN ("+placeholders+")", args...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM crawl_tasks WHERE id IN ("+placeholders+")", args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetDeletedByID retrieves a deleted crawl task that can still be restored,
+// i.e. one deleted after restorableSince
+func (r *TaskRepository) GetDeletedByID(ctx context.Context, id int, restorableSince time.Time) (*CrawlTask, error) {
+	task, err := scanTask(r.db.QueryRowContext(ctx,
+		"SELECT "+taskColumns+" FROM crawl_tasks WHERE id = ? AND deleted_at IS NOT NULL AND deleted_at >= ?",
+		id, restorableSince,
+	))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return task, nil
+}
+
+// SoftDeleteByIDs marks crawl tasks as deleted so they are hidden but can be
+// restored. Pending and running tasks are cancelled at the same time.
+func (r *TaskRepository) SoftDeleteByIDs(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders, args := inClause(ids)
+	args = append([]interface{}{TaskStatusPending, TaskStatusInProgress, TaskStatusCancelled}, args...)
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE crawl_tasks SET deleted_at = CURRENT_TIMESTAMP,
+		 status = CASE WHEN status IN (?, ?) THEN ? ELSE status END,
+		 updated_at = CURRENT_TIMESTAMP
+		 WHERE id IN (`+placeholders+`) AND deleted_at IS NULL`,
+		args...,
+	)
+	return err
+}
+
+// Restore brings back a deleted crawl task. It reports false when the task is
+// not deleted or was deleted before restorableSince.
+func (r *TaskRepository) Restore(ctx context.Context, id int, restorableSince time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE crawl_tasks SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND deleted_at IS NOT NULL AND deleted_at >= ?`,
+		id, restorableSince,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// PurgeDeleted permanently removes up to limit tasks deleted before cutoff,
+// with their results and links, and returns how many were removed
+func (r *TaskRepository) PurgeDeleted(ctx context.Context, cutoff time.Time, limit int) (int, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id FROM crawl_tasks WHERE deleted_at IS NOT NULL AND deleted_at < ? ORDER BY deleted_at LIMIT ?",
+		cutoff, limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := r.DeleteByIDs(ctx, ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// UpdateStatus updates the status of a crawl task
+func (r *TaskRepository) UpdateStatus(ctx context.Context, id int, status string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE crawl_tasks SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		status, id,
+	)
+	return err
+}
+
+// UpdateProgress updates the progress of a crawl task
+func (r *TaskRepository) UpdateProgress(ctx context.Context, id int, progress float64) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE crawl_tasks SET progress = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		progress, id,
+	)
+	return err
+}
+
+// UpdateStatusWithError updates the status and error message of a crawl task
+func (r *TaskRepository) UpdateStatusWithError(ctx context.Context, id int, status string, errorMessage *string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE crawl_tasks SET status = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		status, errorMessage, id,
+	)
+	return err
+}
+
+// UpdateCompletedAt updates the completion time of a crawl task
+func (r *TaskRepository) UpdateCompletedAt(ctx context.Context, id int, completedAt *time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE crawl_tasks SET completed_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		completedAt, id,
+	)
+	return err
+}
+
+// ClaimNext leases a runnable task to owner for the given duration. A task
+// is runnable when it is pending, or in progress with an expired lease
+// because its worker died. To share workers fairly, tasks of users with the
+// fewest running tasks go first, oldest first, and users already running
+// maxPerUser tasks are skipped (0 means no limit). Rows locked by other
+// workers are skipped, so concurrent claimers never receive the same task.
+// The limit is checked again under a lock of the user row, since concurrent
+// claimers cannot see each other's claims; a claimer losing that race gets
+// nothing and tries again on its next poll. It returns nil when there is
+// nothing to run.
+func (r *TaskRepository) ClaimNext(ctx context.Context, owner string, lease time.Duration, maxPerUser int) (*CrawlTask, error) {
+	if maxPerUser <= 0 {
+		maxPerUser = math.MaxInt32
+	}
+
+	// Each read sees the claims committed before it, including the ones
+	// committed while waiting for the user lock
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT t.id, t.user_id FROM crawl_tasks t
+		 LEFT JOIN (
+			SELECT user_id, COUNT(*) AS running FROM crawl_tasks
+			WHERE status = ? AND lease_expires_at >= NOW()
+			GROUP BY user_id
+		 ) r ON r.user_id = t.user_id
+		 WHERE t.deleted_at IS NULL AND (t.status = ? OR (t.status = ? AND (t.lease_expires_at IS NULL OR t.lease_expires_at < NOW())))
+		   AND COALESCE(r.running, 0) < ?
+		 ORDER BY COALESCE(r.running, 0), t.created_at, t.id
+		 LIMIT 1 FOR UPDATE OF t SKIP LOCKED`,
+		TaskStatusInProgress, TaskStatusPending, TaskStatusInProgress, maxPerUser,
+	).Scan(&id, &userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if maxPerUser < math.MaxInt32 {
+		var running int
+		if err := lockUser(ctx, tx, userID); err != nil {
+			return nil, err
+		}
+		err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM crawl_tasks WHERE user_id = ? AND status = ? AND lease_expires_at >= NOW()",
+			userID, TaskStatusInProgress,
+		).Scan(&running)
+		if err != nil {
+			return nil, err
+		}
+		if running >= maxPerUser {
+			return nil, nil
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE crawl_tasks SET status = ?, lease_owner = ?, lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND),
+		 attempts = attempts + 1, started_at = COALESCE(started_at, NOW()), updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		TaskStatusInProgress, owner, int(lease.Seconds()), id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := scanTask(tx.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM crawl_tasks WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return task, tx.Commit()
+}
+
+// RenewLease extends the lease owner holds on a running task. It reports
+// false when the lease was lost, either because the task is no longer in
+// progress (e.g. it was stopped) or because another worker reclaimed it.
+func (r *TaskRepository) RenewLease(ctx context.Context, id int, owner string, lease time.Duration) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE crawl_tasks SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND) 
+		 WHERE id = ? AND lease_owner = ? AND status = ?`,
+		int(lease.Seconds()), id, owner, TaskStatusInProgress,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// Cancel cancels a pending or running task. It reports false when the task
+// had already finished, so that its status was left unchanged.
+func (r *TaskRepository) Cancel(ctx context.Context, id int) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE crawl_tasks SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status IN (?, ?)",
+		TaskStatusCancelled, id, TaskStatusPending, TaskStatusInProgress,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// FinishRun records the outcome of a run: the status and error message of a
+// task owner holds the lease of. It reports false, without changing anything,
+// when the task is no longer in progress under that lease, because it was
+// cancelled or reclaimed by another worker meanwhile.
+func (r *TaskRepository) FinishRun(ctx context.Context, id int, owner, status string, errorMessage *string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE crawl_tasks SET status = ?, error_message = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE id = ? AND lease_owner = ? AND status = ?`,
+		status, errorMessage, id, owner, TaskStatusInProgress,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// ReleaseLease clears the lease owner holds on a task
+func (r *TaskRepository) ReleaseLease(ctx context.Context, id int, owner string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE crawl_tasks SET lease_owner = NULL, lease_expires_at = NULL WHERE id = ? AND lease_owner = ?",
+		id, owner,
+	)
+	return err
+}
+
+// resultColumns lists the crawl_results columns read by scanResult
+const resultColumns = `id, task_id, page_url, depth, html_version, page_title, h1_count, h2_count, h3_count, h4_count, h5_count, h6_count,
+	internal_links_count, external_links_count, inaccessible_links_count, has_login_form, total_links_count, response_time_ms, page_size_bytes, created_at`
+
+// scanResult scans a row selected with resultColumns into a CrawlResult
+func scanResult(row rowScanner) (*CrawlResult, error) {
+	var result CrawlResult
+	err := row.Scan(&result.ID, &result.TaskID, &result.PageURL, &result.Depth, &result.HTMLVersion, &result.PageTitle,
+		&result.H1Count, &result.H2Count, &result.H3Count, &result.H4Count, &result.H5Count, &result.H6Count,
+		&result.InternalLinksCount, &result.ExternalLinksCount, &result.InaccessibleLinksCount, &result.HasLoginForm,
+		&result.TotalLinksCount, &result.ResponseTimeMs, &result.PageSizeBytes, &result.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResultRepository provides database operations for crawl results
+type ResultRepository struct {
+	db *sql.DB
+}
+
+// NewResultRepository creates a new result repository
+func NewResultRepository(database *sql.DB) *ResultRepository {
+	return &ResultRepository{db: database}
+}
+
+// Create creates a new crawl result
+func (r *ResultRepository) Create(ctx context.Context, result *CrawlResult) error {
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO crawl_results (task_id, page_url, depth, html_version, page_title, h1_count, h2_count, h3_count, h4_count, h5_count, h6_count, 
+		 internal_links_count, external_links_count, inaccessible_links_count, has_login_form, total_links_count, response_time_ms, page_size_bytes) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		result.TaskID, result.PageURL, result.Depth, result.HTMLVersion, result.PageTitle, result.H1Count, result.H2Count, result.H3Count, result.H4Count, result.H5Count, result.H6Count,
+		result.InternalLinksCount, result.ExternalLinksCount, result.InaccessibleLinksCount, result.HasLoginForm, result.TotalLinksCount, result.ResponseTimeMs, result.PageSizeBytes,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	result.ID = int(id)
+	return nil
+}
+
+// GetByTaskID retrieves the crawl result of the start page of a task
+func (r *ResultRepository) GetByTaskID(ctx context.Context, taskID int) (*CrawlResult, error) {
+	result, err := scanResult(r.db.QueryRowContext(ctx,
+		"SELECT "+resultColumns+" FROM crawl_results WHERE task_id = ? ORDER BY depth, id LIMIT 1",
+		taskID,
+	))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListByTaskID retrieves the crawl results of every page crawled by a task
+func (r *ResultRepository) ListByTaskID(ctx context.Context, taskID int) ([]*CrawlResult, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+resultColumns+" FROM crawl_results WHERE task_id = ? ORDER BY depth, id",
+		taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*CrawlResult
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// GetRootsByTaskIDs retrieves the result of the start page of each task,
+// keyed by task ID. Tasks without results are left out.
+func (r *ResultRepository) GetRootsByTaskIDs(ctx context.Context, taskIDs []int) (map[int]*CrawlResult, error) {
+	roots := make(map[int]*CrawlResult)
+	if len(taskIDs) == 0 {
+		return roots, nil
+	}
+
+	placeholders, args := inClause(taskIDs)
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+resultColumns+" FROM crawl_results WHERE task_id IN ("+placeholders+") AND depth = 0 ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := roots[result.TaskID]; !ok {
+			roots[result.TaskID] = result
+		}
+	}
+
+	return roots, rows.Err()
+}
+
+// DeleteByTaskID removes all crawl results of a task
+func (r *ResultRepository) DeleteByTaskID(ctx context.Context, taskID int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM crawl_results WHERE task_id = ?", taskID)
+	return err
+}
+
+// linkColumns lists the crawl_links columns read by scanLink
+const linkColumns = `id, task_id, page_url, url, host, link_type, status_code, is_accessible, check_status, anchor_text, response_time_ms, checked_at, created_at`
+
+// scanLink scans a row selected with linkColumns into a CrawlLink
+func scanLink(row rowScanner) (*CrawlLink, error) {
+	var link CrawlLink
+	err := row.Scan(&link.ID, &link.TaskID, &link.PageURL, &link.URL, &link.Host, &link.LinkType, &link.StatusCode,
+		&link.IsAccessible, &link.CheckStatus, &link.AnchorText, &link.ResponseTimeMs, &link.CheckedAt, &link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// LinkRepository provides database operations for crawl links
+type LinkRepository struct {
+	db *sql.DB
+}
+
+// NewLinkRepository creates a new link repository
+func NewLinkRepository(database *sql.DB) *LinkRepository {
+	return &LinkRepository{db: database}
+}
+
+// Create creates a new crawl link
+func (r *LinkRepository) Create(ctx context.Context, link *CrawlLink) error {
+	if link.CheckStatus == "" {
+		link.CheckStatus = LinkCheckStatusChecked
+	}
+	if link.Host == "" {
+		link.Host = hostOf(link.URL)
+	}
+
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO crawl_links (task_id, page_url, url, host, link_type, status_code, is_accessible, check_status, anchor_text, response_time_ms, checked_at) 
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.TaskID, link.PageURL, link.URL, link.Host, link.LinkType, link.StatusCode, link.IsAccessible, link.CheckStatus, link.AnchorText, link.ResponseTimeMs, link.CheckedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	link.ID = int(id)
+	return nil
+}
+
+// GetByTaskID retrieves crawl links for a specific task
+func (r *LinkRepository) GetByTaskID(ctx context.Context, taskID int) ([]*CrawlLink, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+linkColumns+" FROM crawl_links WHERE task_id = ? ORDER BY created_at",
+		taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []*CrawlLink
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// DeleteByTaskID removes all crawl links of a task
+func (r *LinkRepository) DeleteByTaskID(ctx context.Context, taskID int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM crawl_links WHERE task_id = ?", taskID)
+	return err
+}
+
+// ErrInvalidLinkFilter is returned when a link filter or cursor cannot be used
+var ErrInvalidLinkFilter = errors.New("invalid link filter")
+
+// LinkFilter narrows down and orders the links of a task. Zero values do
+// not filter.
+type LinkFilter struct {
+	// LinkType is LinkTypeInternal or LinkTypeExternal
+	LinkType string
+	// Accessible keeps accessible, or inaccessible, links
+	Accessible *bool
+	// CheckStatus is one of the LinkCheckStatus constants
+	CheckStatus string
+	// StatusCodes keeps links matching any of a status code class such as
+	// "4xx", an exact code such as "404", or "none" for links without one
+	StatusCodes []string
+	// Host keeps links to the host
+	Host string
+	// PageURL keeps links found on the page
+	PageURL string
+	// Query is searched for in the URL and the anchor text
+	Query string
+	// Sort is one of LinkSortFields and defaults to "id", the order in which
+	// links were found
+	Sort       string
+	Descending bool
+}
+
+// LinkCursor marks the last link of a page of links: its value of the sort
+// field and its ID
+type LinkCursor struct {
+	Value string
+	ID    int
+}
+
+// linkSort is a sort field of the links of a task
+type linkSort struct {
+	expr    string
+	numeric bool
+	value   func(*CrawlLink) string
+}
+
+// linkSorts maps the sort fields of the links of a task to their expressions
+var linkSorts = map[string]linkSort{
+	"id":   {expr: "id", numeric: true, value: func(l *CrawlLink) string { return strconv.Itoa(l.ID) }},
+	"url":  {expr: "url", value: func(l *CrawlLink) string { return l.URL }},
+	"host": {expr: "host", value: func(l *CrawlLink) string { return l.Host }},
+	"status_code": {expr: "COALESCE(status_code, 0)", numeric: true, value: func(l *CrawlLink) string {
+		if l.StatusCode == nil {
+			return "0"
+		}
+		return strconv.Itoa(*l.StatusCode)
+	}},
+	"response_time": {expr: "response_time_ms", numeric: true, value: func(l *CrawlLink) string { return strconv.Itoa(l.ResponseTimeMs) }},
+}
+
+// LinkSortFields returns the fields the links of a task can be sorted on
+func LinkSortFields() []string {
+	fields := make([]string, 0, len(linkSorts))
+	for field := range linkSorts {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// sortField returns the sort field of the filter, defaulting to "id"
+func (f *LinkFilter) sortField() linkSort {
+	if s, ok := linkSorts[f.Sort]; ok {
+		return s
+	}
+	return linkSorts["id"]
+}
+
+// CursorFor returns the cursor that continues a listing after link
+func (f *LinkFilter) CursorFor(link *CrawlLink) LinkCursor {
+	return LinkCursor{Value: f.sortField().value(link), ID: link.ID}
+}
+
+// where builds the WHERE clause of the links of taskID matching the filter
+func (f *LinkFilter) where(taskID int) (string, []interface{}, error) {
+	conditions := []string{"task_id = ?"}
+	args := []interface{}{taskID}
+
+	if f.LinkType != "" {
+		conditions = append(conditions, "link_type = ?")
+		args = append(args, f.LinkType)
+	}
+	if f.Accessible != nil {
+		conditions = append(conditions, "is_accessible = ?")
+		args = append(args, *f.Accessible)
+	}
+	if f.CheckStatus != "" {
+		conditions = append(conditions, "check_status = ?")
+		args = append(args, f.CheckStatus)
+	}
+	if len(f.StatusCodes) > 0 {
+		var alternatives []string
+		for _, code := range f.StatusCodes {
+			switch {
+			case code == "none":
+				alternatives = append(alternatives, "status_code IS NULL")
+			case len(code) == 3 && strings.HasSuffix(code, "xx") && code[0] >= '1' && code[0] <= '5':
+				low := int(code[0]-'0') * 100
+				alternatives = append(alternatives, "status_code BETWEEN ? AND ?")
+				args = append(args, low, low+99)
+			default:
+				n, err := strconv.Atoi(code)
+				if err != nil || n < 100 || n > 599 {
+					return "", nil, fmt.Errorf("%w: status code %q", ErrInvalidLinkFilter, code)
+				}
+				alternatives = append(alternatives, "status_code = ?")
+				args = append(args, n)
+			}
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if f.Host != "" {
+		conditions = append(conditions, "host = ?")
+		args = append(args, strings.ToLower(f.Host))
+	}
+	if f.PageURL != "" {
+		conditions = append(conditions, "page_url = ?")
+		args = append(args, f.PageURL)
+	}
+	if f.Query != "" {
+		pattern := "%" + escapeLike(f.Query) + "%"
+		conditions = append(conditions, "(url LIKE ? OR anchor_text LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// seek builds the condition keeping the links that come after cursor in the
+// order of the filter. Ties on the sort field are broken by ID.
+func (f *LinkFilter) seek(cursor *LinkCursor) (string, []interface{}, error) {
+	sortField := f.sortField()
+	comparison := ">"
+	if f.Descending {
+		comparison = "<"
+	}
+
+	var value interface{} = cursor.Value
+	if sortField.numeric {
+		n, err := strconv.Atoi(cursor.Value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: cursor value %q", ErrInvalidLinkFilter, cursor.Value)
+		}
+		value = n
+	}
+
+	condition := "(" + sortField.expr + " " + comparison + " ? OR (" + sortField.expr + " = ? AND id " + comparison + " ?))"
+	return condition, []interface{}{value, value, cursor.ID}, nil
+}
+
+// List retrieves up to limit links of a task matching the filter, starting
+// after cursor when it is set
+func (r *LinkRepository) List(ctx context.Context, taskID int, filter LinkFilter, cursor *LinkCursor, limit int) ([]*CrawlLink, error) {
+	where, args, err := filter.where(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	sortField := filter.sortField()
+	direction := "ASC"
+	if filter.Descending {
+		direction = "DESC"
+	}
+
+	if cursor != nil {
+		condition, seekArgs, err := filter.seek(cursor)
+		if err != nil {
+			return nil, err
+		}
+		where += " AND " + condition
+		args = append(args, seekArgs...)
+	}
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+linkColumns+" FROM crawl_links "+where+" ORDER BY "+sortField.expr+" "+direction+", id "+direction+" LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []*CrawlLink
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// Count counts the links of a task matching the filter
+func (r *LinkRepository) Count(ctx context.Context, taskID int, filter LinkFilter) (int, error) {
+	where, args, err := filter.where(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM crawl_links "+where, args...).Scan(&count)
+	return count, err
+}
+
+// ForEachByTaskID calls fn for every crawl link of a task without loading all
+// of them into memory. Iteration stops at the first error returned by fn.
+func (r *LinkRepository) ForEachByTaskID(ctx context.Context, taskID int, fn func(*CrawlLink) error) error {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+linkColumns+" FROM crawl_links WHERE task_id = ? ORDER BY created_at",
+		taskID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// EventRepository provides database operations for user events
+type EventRepository struct {
+	db *sql.DB
+}
+
+// NewEventRepository creates a new event repository
+func NewEventRepository(database *sql.DB) *EventRepository {
+	return &EventRepository{db: database}
+}
+
+// Create stores a user event
+func (r *EventRepository) Create(ctx context.Context, event *UserEvent) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO user_events (user_id, event_id, task_id, payload) VALUES (?, ?, ?, ?)",
+		event.UserID, event.EventID, event.TaskID, event.Payload,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	event.ID = id
+	return nil
+}
+
+// ListAfter retrieves up to limit events of a user with an event ID greater
+// than afterID, oldest first
+func (r *EventRepository) ListAfter(ctx context.Context, userID int, afterID int64, limit int) ([]*UserEvent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, event_id, task_id, payload, created_at
+		 FROM user_events WHERE user_id = ? AND event_id > ?
+		 ORDER BY event_id LIMIT ?`,
+		userID, afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*UserEvent
+	for rows.Next() {
+		event := &UserEvent{}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.EventID, &event.TaskID, &event.Payload, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// LastEventIDs returns the highest stored event ID of every user
+func (r *EventRepository) LastEventIDs(ctx context.Context) (map[int]int64, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id, MAX(event_id) FROM user_events GROUP BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lastIDs := make(map[int]int64)
+	for rows.Next() {
+		var userID int
+		var lastID int64
+		if err := rows.Scan(&userID, &lastID); err != nil {
+			return nil, err
+		}
+		lastIDs[userID] = lastID
+	}
+
+	return lastIDs, rows.Err()
+}
+
+// DeleteBefore removes events created before cutoff and returns how many were removed
+func (r *EventRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM user_events WHERE created_at < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// scheduleColumns lists the crawl_schedules columns read by scanSchedule
+const scheduleColumns = `id, user_id, workspace_id, name, url, crawl_mode, max_depth, max_pages, crawl_scope, ignore_robots, cron_expr, interval_seconds,
+	timezone, enabled, missed_run_policy, next_run_at, last_run_at, last_task_id, created_at, updated_at`
+
+// scanSchedule scans a row selected with scheduleColumns into a CrawlSchedule
+func scanSchedule(row rowScanner) (*CrawlSchedule, error) {
+	var schedule CrawlSchedule
+	err := row.Scan(&schedule.ID, &schedule.UserID, &schedule.WorkspaceID, &schedule.Name, &schedule.URL, &schedule.CrawlMode, &schedule.MaxDepth, &schedule.MaxPages,
+		&schedule.CrawlScope, &schedule.IgnoreRobots, &schedule.CronExpr, &schedule.IntervalSeconds, &schedule.Timezone, &schedule.Enabled,
+		&schedule.MissedRunPolicy, &schedule.NextRunAt, &schedule.LastRunAt, &schedule.LastTaskID, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ScheduleRepository provides database operations for crawl schedules
+type ScheduleRepository struct {
+	db *sql.DB
+}
+
+// NewScheduleRepository creates a new schedule repository
+func NewScheduleRepository(database *sql.DB) *ScheduleRepository {
+	return &ScheduleRepository{db: database}
+}
+
+// Create creates a new crawl schedule
+func (r *ScheduleRepository) Create(ctx context.Context, schedule *CrawlSchedule) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO crawl_schedules (user_id, workspace_id, name, url, crawl_mode, max_depth, max_pages, crawl_scope, ignore_robots, cron_expr, interval_seconds,
+		 timezone, enabled, missed_run_policy, next_run_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schedule.UserID, schedule.WorkspaceID, schedule.Name, schedule.URL, schedule.CrawlMode, schedule.MaxDepth, schedule.MaxPages, schedule.CrawlScope,
+		schedule.IgnoreRobots, schedule.CronExpr, schedule.IntervalSeconds, schedule.Timezone, schedule.Enabled, schedule.MissedRunPolicy, schedule.NextRunAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	schedule.ID = int(id)
+	return nil
+}
+
+// GetByID retrieves a crawl schedule by ID
+func (r *ScheduleRepository) GetByID(ctx context.Context, id int) (*CrawlSchedule, error) {
+	schedule, err := scanSchedule(r.db.QueryRowContext(ctx,
+		"SELECT "+scheduleColumns+" FROM crawl_schedules WHERE id = ?",
+		id,
+	))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// List retrieves the crawl schedules of the workspaces a user is a member
+// of, or of one of them when workspaceID is not 0, with pagination
+func (r *ScheduleRepository) List(ctx context.Context, memberID, workspaceID int, limit, offset int) ([]*CrawlSchedule, error) {
+	where, args := scheduleWhere(memberID, workspaceID)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+scheduleColumns+" FROM crawl_schedules "+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*CrawlSchedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// Count counts the crawl schedules of the workspaces a user is a member of,
+// or of one of them when workspaceID is not 0
+func (r *ScheduleRepository) Count(ctx context.Context, memberID, workspaceID int) (int, error) {
+	where, args := scheduleWhere(memberID, workspaceID)
+
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM crawl_schedules "+where, args...).Scan(&count)
+	return count, err
+}
+
+// scheduleWhere builds the WHERE clause of the schedules listed for a member
+func scheduleWhere(memberID, workspaceID int) (string, []interface{}) {
+	where := "WHERE workspace_id IN (" + memberWorkspaces + ")"
+	args := []interface{}{memberID}
+	if workspaceID != 0 {
+		where += " AND workspace_id = ?"
+		args = append(args, workspaceID)
+	}
+	return where, args
+}
+
+// CountByUserID counts the crawl schedules created by a user
+func (r *ScheduleRepository) CountByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM crawl_schedules WHERE user_id = ?",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// Update saves the settings of a crawl schedule, including its next run
+func (r *ScheduleRepository) Update(ctx context.Context, schedule *CrawlSchedule) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE crawl_schedules SET name = ?, url = ?, crawl_mode = ?, max_depth = ?, max_pages = ?, crawl_scope = ?, ignore_robots = ?,
+		 cron_expr = ?, interval_seconds = ?, timezone = ?, enabled = ?, missed_run_policy = ?, next_run_at = ?
+		 WHERE id = ?`,
+		schedule.Name, schedule.URL, schedule.CrawlMode, schedule.MaxDepth, schedule.MaxPages, schedule.CrawlScope, schedule.IgnoreRobots,
+		schedule.CronExpr, schedule.IntervalSeconds, schedule.Timezone, schedule.Enabled, schedule.MissedRunPolicy, schedule.NextRunAt,
+		schedule.ID,
+	)
+	return err
+}
+
+// Delete deletes a crawl schedule. Tasks it started are kept.
+func (r *ScheduleRepository) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM crawl_schedules WHERE id = ?", id)
+	return err
+}
+
+// ListDue retrieves up to limit enabled schedules whose next run is at or
+// before now, most overdue first. Schedules of disabled users, or of users who
+// left the workspace, never run.
+func (r *ScheduleRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*CrawlSchedule, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+qualify(scheduleColumns, "s")+" FROM crawl_schedules s JOIN users u ON u.id = s.user_id "+
+			"JOIN workspace_members m ON m.workspace_id = s.workspace_id AND m.user_id = s.user_id "+
+			"WHERE s.enabled = TRUE AND u.disabled_at IS NULL AND s.next_run_at <= ? ORDER BY s.next_run_at LIMIT ?",
+		now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*CrawlSchedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// Advance moves a due schedule from its run at due to next, recording a run
+// when ran is set. A nil next means the schedule never runs again. It reports false when the schedule was changed or
+// advanced by someone else in the meantime, so that each run happens once
+// even with several servers.
+func (r *ScheduleRepository) Advance(ctx context.Context, id int, due time.Time, next *time.Time, ran bool) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE crawl_schedules SET next_run_at = ?, last_run_at = IF(?, NOW(), last_run_at)
+		 WHERE id = ? AND enabled = TRUE AND next_run_at = ?`,
+		next, ran, id, due,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// SetLastTask records the task most recently started by a schedule
+func (r *ScheduleRepository) SetLastTask(ctx context.Context, id, taskID int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE crawl_schedules SET last_task_id = ? WHERE id = ?", taskID, id)
+	return err
+}
+
+// webhookColumns lists the webhooks columns read by scanWebhook
+const webhookColumns = "id, user_id, url, secret, events, description, enabled, created_at, updated_at"
+
+// scanWebhook scans a row selected with webhookColumns into a Webhook. The
+// subscribed events are stored as a comma-separated list.
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var webhook Webhook
+	var events string
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &events, &webhook.Description,
+		&webhook.Enabled, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Events = []string{}
+	if events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	return &webhook, nil
+}
+
+// WebhookRepository provides database operations for webhooks
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(database *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: database}
+}
+
+// Create creates a new webhook
+func (r *WebhookRepository) Create(ctx context.Context, webhook *Webhook) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO webhooks (user_id, url, secret, events, description, enabled) VALUES (?, ?, ?, ?, ?, ?)",
+		webhook.UserID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Description, webhook.Enabled,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	webhook.ID = int(id)
+	return nil
+}
+
+// GetByID retrieves a webhook by ID
+func (r *WebhookRepository) GetByID(ctx context.Context, id int) (*Webhook, error) {
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// GetByUserID retrieves every webhook of a user, newest first
+func (r *WebhookRepository) GetByUserID(ctx context.Context, userID int) ([]*Webhook, error) {
+	return r.list(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE user_id = ? ORDER BY id DESC", userID)
+}
+
+// ListSubscribed retrieves the enabled webhooks of a user that subscribed to
+// event, as long as the user is a member of the workspace the event is about
+func (r *WebhookRepository) ListSubscribed(ctx context.Context, userID, workspaceID int, event string) ([]*Webhook, error) {
+	return r.list(ctx,
+		"SELECT "+webhookColumns+" FROM webhooks WHERE user_id = ? AND enabled = TRUE AND FIND_IN_SET(?, events) > 0 "+
+			"AND EXISTS (SELECT 1 FROM workspace_members WHERE workspace_id = ? AND user_id = webhooks.user_id)",
+		userID, event, workspaceID,
+	)
+}
+
+// list runs a query selecting webhookColumns
+func (r *WebhookRepository) list(ctx context.Context, query string, args ...interface{}) ([]*Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// CountByUserID counts the webhooks of a user
+func (r *WebhookRepository) CountByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhooks WHERE user_id = ?", userID).Scan(&count)
+	return count, err
+}
+
+// Update saves the settings of a webhook, including its secret
+func (r *WebhookRepository) Update(ctx context.Context, webhook *Webhook) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE webhooks SET url = ?, secret = ?, events = ?, description = ?, enabled = ? WHERE id = ?",
+		webhook.URL, webhook.Secret, strings.Join(webhook.Events, ","), webhook.Description, webhook.Enabled, webhook.ID,
+	)
+	return err
+}
+
+// Delete deletes a webhook along with its deliveries
+func (r *WebhookRepository) Delete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	return err
+}
+
+// deliveryColumns lists the webhook_deliveries columns read by scanDelivery
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, response_body, error,
+	duration_ms, delivered_at, created_at, updated_at`
+
+// scanDelivery scans a row selected with deliveryColumns into a WebhookDelivery
+func scanDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload []byte
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &payload, &delivery.Status, &delivery.Attempts,
+		&delivery.NextAttemptAt, &delivery.ResponseStatus, &delivery.ResponseBody, &delivery.Error, &delivery.DurationMs,
+		&delivery.DeliveredAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	return &delivery, nil
+}
+
+// DeliveryRepository provides database operations for webhook deliveries
+type DeliveryRepository struct {
+	db *sql.DB
+}
+
+// NewDeliveryRepository creates a new webhook delivery repository
+func NewDeliveryRepository(database *sql.DB) *DeliveryRepository {
+	return &DeliveryRepository{db: database}
+}
+
+// Create stores a new delivery
+func (r *DeliveryRepository) Create(ctx context.Context, delivery *WebhookDelivery) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at) VALUES (?, ?, ?, ?, ?)",
+		delivery.WebhookID, delivery.Event, []byte(delivery.Payload), delivery.Status, delivery.NextAttemptAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	delivery.ID = id
+	return nil
+}
+
+// GetByID retrieves a delivery by ID
+func (r *DeliveryRepository) GetByID(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// GetByWebhookID retrieves the deliveries of a webhook with pagination, newest first
+func (r *DeliveryRepository) GetByWebhookID(ctx context.Context, webhookID int, limit, offset int) ([]*WebhookDelivery, error) {
+	return r.list(ctx,
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ? OFFSET ?",
+		webhookID, limit, offset,
+	)
+}
+
+// CountByWebhookID counts the deliveries of a webhook
+func (r *DeliveryRepository) CountByWebhookID(ctx context.Context, webhookID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?", webhookID).Scan(&count)
+	return count, err
+}
+
+// ListDue retrieves up to limit deliveries whose next attempt is at or before
+// now. This includes deliveries whose sender stopped before recording the
+// outcome, since their next attempt is set to when the attempt times out.
+func (r *DeliveryRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	return r.list(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		 WHERE status IN ('pending', 'delivering') AND next_attempt_at <= ?
+		 ORDER BY next_attempt_at LIMIT ?`,
+		now, limit,
+	)
+}
+
+// list runs a query selecting deliveryColumns
+func (r *DeliveryRepository) list(ctx context.Context, query string, args ...interface{}) ([]*WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// Claim starts a new attempt of a delivery, which times out at until. It
+// reports false when another server claimed the attempt first. On success
+// the delivery's status and attempt count are updated.
+func (r *DeliveryRepository) Claim(ctx context.Context, delivery *WebhookDelivery, until time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = 'delivering', attempts = attempts + 1, next_attempt_at = ?
+		 WHERE id = ? AND attempts = ? AND status IN ('pending', 'delivering')`,
+		until, delivery.ID, delivery.Attempts,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	delivery.Status = DeliveryStatusDelivering
+	delivery.Attempts++
+	delivery.NextAttemptAt = &until
+	return true, nil
+}
+
+// Finish records the outcome of the current attempt of a delivery: its
+// status, the response and, for pending deliveries, the next attempt. It is
+// ignored when the attempt timed out and was claimed again.
+func (r *DeliveryRepository) Finish(ctx context.Context, delivery *WebhookDelivery) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = ?, next_attempt_at = ?, response_status = ?, response_body = ?, error = ?,
+		 duration_ms = ?, delivered_at = ?
+		 WHERE id = ? AND attempts = ?`,
+		delivery.Status, delivery.NextAttemptAt, delivery.ResponseStatus, delivery.ResponseBody, delivery.Error,
+		delivery.DurationMs, delivery.DeliveredAt, delivery.ID, delivery.Attempts,
+	)
+	return err
+}
+
+// DeleteBefore removes deliveries created before cutoff that are no longer
+// waiting to be sent and returns how many were removed
+func (r *DeliveryRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM webhook_deliveries WHERE created_at < ? AND status IN ('succeeded', 'failed')",
+		cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// apiTokenColumns lists the api_tokens columns read by scanAPIToken
+const apiTokenColumns = "id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at"
+
+// scanAPIToken scans a row selected with apiTokenColumns, followed by any
+// extra destinations, into an APIToken. Scopes are stored as a comma-separated list.
+func scanAPIToken(row rowScanner, extra ...interface{}) (*APIToken, error) {
+	var token APIToken
+	var scopes string
+	dest := []interface{}{&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.Hash, &scopes, &token.ExpiresAt,
+		&token.LastUsedAt, &token.LastUsedIP, &token.RevokedAt, &token.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	token.Scopes = []string{}
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, ",")
+	}
+	return &token, nil
+}
+
+// APITokenRepository provides database operations for personal access tokens
+type APITokenRepository struct {
+	db *sql.DB
+}
+
+// NewAPITokenRepository creates a new API token repository
+func NewAPITokenRepository(database *sql.DB) *APITokenRepository {
+	return &APITokenRepository{db: database}
+}
+
+// Create stores a new token
+func (r *APITokenRepository) Create(ctx context.Context, token *APIToken) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		token.UserID, token.Name, token.Prefix, token.Hash, strings.Join(token.Scopes, ","), token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = int(id)
+	return nil
+}
+
+// GetByID retrieves a token by ID
+func (r *APITokenRepository) GetByID(ctx context.Context, id int) (*APIToken, error) {
+	token, err := scanAPIToken(r.db.QueryRowContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetByHash retrieves a token by the hash of its value, along with the
+// username and role of its user. Tokens of disabled users are not found.
+func (r *APITokenRepository) GetByHash(ctx context.Context, hash string) (*APIToken, error) {
+	var username, role string
+	row := r.db.QueryRowContext(ctx,
+		"SELECT "+qualify(apiTokenColumns, "t")+", u.username, u.role FROM api_tokens t JOIN users u ON u.id = t.user_id "+
+			"WHERE t.token_hash = ? AND u.disabled_at IS NULL",
+		hash,
+	)
+	token, err := scanAPIToken(row, &username, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	token.Username = username
+	token.UserRole = role
+	return token, nil
+}
+
+// GetByUserID retrieves the tokens of a user that are not revoked, newest first
+func (r *APITokenRepository) GetByUserID(ctx context.Context, userID int) ([]*APIToken, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// CountActiveByUserID counts the tokens of a user that are neither revoked nor expired
+func (r *APITokenRepository) CountActiveByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM api_tokens WHERE user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+// Revoke revokes a token so that it can no longer be used
+func (r *APITokenRepository) Revoke(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_tokens SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL", id)
+	return err
+}
+
+// TouchLastUsed records that a token was used at from ip. To bound writes,
+// the time is only updated when it moved by more than a minute or the
+// address changed.
+func (r *APITokenRepository) TouchLastUsed(ctx context.Context, id int, at time.Time, ip string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE api_tokens SET last_used_at = ?, last_used_ip = ?
+		 WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ? OR NOT (last_used_ip <=> ?))`,
+		at, ip, id, at.Add(-time.Minute), ip,
+	)
+	return err
+}
+
+// sessionColumns lists the auth_sessions columns read by scanSession
+const sessionColumns = "id, user_id, user_agent, ip, expires_at, last_used_at, revoked_at, revoke_reason, created_at"
+
+// scanSession scans a row selected with sessionColumns into an AuthSession
+func scanSession(row rowScanner) (*AuthSession, error) {
+	var session AuthSession
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.ExpiresAt, &session.LastUsedAt,
+		&session.RevokedAt, &session.RevokeReason, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// SessionRepository provides database operations for login sessions and
+// their refresh tokens
+type SessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository(database *sql.DB) *SessionRepository {
+	return &SessionRepository{db: database}
+}
+
+// Create creates a new session
+func (r *SessionRepository) Create(ctx context.Context, session *AuthSession) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO auth_sessions (user_id, user_agent, ip, expires_at) VALUES (?, ?, ?, ?)",
+		session.UserID, session.UserAgent, session.IP, session.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	return nil
+}
+
+// GetByID retrieves a session by ID
+func (r *SessionRepository) GetByID(ctx context.Context, id int64) (*AuthSession, error) {
+	session, err := scanSession(r.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM auth_sessions WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// Extend moves the expiry of a session to expiresAt and records its use
+func (r *SessionRepository) Extend(ctx context.Context, id int64, expiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE auth_sessions SET expires_at = ?, last_used_at = NOW() WHERE id = ? AND revoked_at IS NULL",
+		expiresAt, id,
+	)
+	return err
+}
+
+// Revoke ends a session for the given reason
+func (r *SessionRepository) Revoke(ctx context.Context, id int64, reason string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE auth_sessions SET revoked_at = NOW(), revoke_reason = ? WHERE id = ? AND revoked_at IS NULL",
+		reason, id,
+	)
+	return err
+}
+
+// RevokeByUserID ends every session of a user and returns how many were ended
+func (r *SessionRepository) RevokeByUserID(ctx context.Context, userID int, reason string) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE auth_sessions SET revoked_at = NOW(), revoke_reason = ? WHERE user_id = ? AND revoked_at IS NULL",
+		reason, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RevokeOthersByUserID ends every session of a user except keepID and
+// returns how many were ended
+func (r *SessionRepository) RevokeOthersByUserID(ctx context.Context, userID int, keepID int64, reason string) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE auth_sessions SET revoked_at = NOW(), revoke_reason = ? WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+		reason, userID, keepID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteEndedByUserID removes the sessions of a user that expired or were
+// revoked before cutoff, along with their refresh tokens
+func (r *SessionRepository) DeleteEndedByUserID(ctx context.Context, userID int, cutoff time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM auth_sessions WHERE user_id = ? AND (expires_at < ? OR revoked_at < ?)",
+		userID, cutoff, cutoff,
+	)
+	return err
+}
+
+// CreateRefreshToken stores a new refresh token of a session
+func (r *SessionRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		token.SessionID, token.Hash, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = id
+	return nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by the hash of its value
+func (r *SessionRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, session_id, token_hash, expires_at, used_at, created_at FROM refresh_tokens WHERE token_hash = ?",
+		hash,
+	).Scan(&token.ID, &token.SessionID, &token.Hash, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// UseRefreshToken marks a refresh token as used. It reports false when the
+// token was already used, e.g. by a concurrent request.
+func (r *SessionRepository) UseRefreshToken(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = ? AND used_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UserTokenRepository provides database operations for the single-use
+// tokens emailed to users
+type UserTokenRepository struct {
+	db *sql.DB
+}
+
+// NewUserTokenRepository creates a new user token repository
+func NewUserTokenRepository(database *sql.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: database}
+}
+
+// Create stores a new token
+func (r *UserTokenRepository) Create(ctx context.Context, token *UserToken) error {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token.UserID, token.Purpose, token.Hash, token.Email, token.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	token.ID = id
+	return nil
+}
+
+// GetByHash retrieves a token for purpose by the hash of its value
+func (r *UserTokenRepository) GetByHash(ctx context.Context, purpose, hash string) (*UserToken, error) {
+	var token UserToken
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, user_id, purpose, token_hash, email, expires_at, used_at, created_at FROM user_tokens WHERE token_hash = ? AND purpose = ?",
+		hash, purpose,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.Hash, &token.Email, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Use marks a token as used. It reports false when the token was already
+// used, e.g. by a concurrent request.
+func (r *UserTokenRepository) Use(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, "UPDATE user_tokens SET used_at = NOW() WHERE id = ? AND used_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// InvalidateByUserID marks the unused tokens of a user for purpose as used,
+// so only the token sent last works
+func (r *UserTokenRepository) InvalidateByUserID(ctx context.Context, userID int, purpose string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE user_tokens SET used_at = NOW() WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		userID, purpose,
+	)
+	return err
+}
+
+// LastCreatedAt returns when the latest token of a user for purpose was
+// created, or nil when there is none
+func (r *UserTokenRepository) LastCreatedAt(ctx context.Context, userID int, purpose string) (*time.Time, error) {
+	var createdAt sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		"SELECT MAX(created_at) FROM user_tokens WHERE user_id = ? AND purpose = ?",
+		userID, purpose,
+	).Scan(&createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if !createdAt.Valid {
+		return nil, nil
+	}
+	return &createdAt.Time, nil
+}
+
+// DeleteExpiredByUserID removes the tokens of a user that expired before cutoff
+func (r *UserTokenRepository) DeleteExpiredByUserID(ctx context.Context, userID int, cutoff time.Time) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id = ? AND expires_at < ?", userID, cutoff)
+	return err
+}
+
+// workspaceColumns lists the workspaces columns read by scanWorkspace
+const workspaceColumns = "id, name, personal_user_id, created_at, updated_at"
+
+// scanWorkspace scans a row selected with workspaceColumns into a Workspace
+func scanWorkspace(row rowScanner) (*Workspace, error) {
+	var workspace Workspace
+	err := row.Scan(&workspace.ID, &workspace.Name, &workspace.PersonalUserID, &workspace.CreatedAt, &workspace.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// PersonalWorkspaceName returns the name given to the personal workspace of a user
+func PersonalWorkspaceName(username string) string {
+	return username + "'s workspace"
+}
+
+// createWorkspace inserts a workspace and makes ownerID its owner
+func createWorkspace(ctx context.Context, tx *sql.Tx, workspace *Workspace, ownerID int) error {
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO workspaces (name, personal_user_id) VALUES (?, ?)",
+		workspace.Name, workspace.PersonalUserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO workspace_members (workspace_id, user_id, role) VALUES (?, ?, ?)",
+		id, ownerID, WorkspaceRoleOwner,
+	)
+	if err != nil {
+		return err
+	}
+
+	workspace.ID = int(id)
+	return nil
+}
+
+// WorkspaceRepository provides database operations for workspaces and their members
+type WorkspaceRepository struct {
+	db *sql.DB
+}
+
+// NewWorkspaceRepository creates a new workspace repository
+func NewWorkspaceRepository(database *sql.DB) *WorkspaceRepository {
+	return &WorkspaceRepository{db: database}
+}
+
+// Create creates a workspace owned by ownerID
+func (r *WorkspaceRepository) Create(ctx context.Context, workspace *Workspace, ownerID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createWorkspace(ctx, tx, workspace, ownerID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetByID retrieves a workspace by ID
+func (r *WorkspaceRepository) GetByID(ctx context.Context, id int) (*Workspace, error) {
+	return r.getOne(ctx, "SELECT "+workspaceColumns+" FROM workspaces WHERE id = ?", id)
+}
+
+// GetPersonal retrieves the personal workspace of a user
+func (r *WorkspaceRepository) GetPersonal(ctx context.Context, userID int) (*Workspace, error) {
+	return r.getOne(ctx, "SELECT "+workspaceColumns+" FROM workspaces WHERE personal_user_id = ?", userID)
+}
+
+// getOne retrieves the workspace selected by query, or nil if there is none
+func (r *WorkspaceRepository) getOne(ctx context.Context, query string, args ...interface{}) (*Workspace, error) {
+	workspace, err := scanWorkspace(r.db.QueryRowContext(ctx, query, args...))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// GetByUserID retrieves the workspaces a user is a member of, with the role
+// of the user and the number of members, the personal workspace first
+func (r *WorkspaceRepository) GetByUserID(ctx context.Context, userID int) ([]*Workspace, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+qualify(workspaceColumns, "w")+`, m.role,
+		 (SELECT COUNT(*) FROM workspace_members WHERE workspace_id = w.id)
+		 FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		 WHERE m.user_id = ? ORDER BY w.personal_user_id IS NULL, w.name, w.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []*Workspace
+	for rows.Next() {
+		var workspace Workspace
+		err := rows.Scan(&workspace.ID, &workspace.Name, &workspace.PersonalUserID, &workspace.CreatedAt, &workspace.UpdatedAt,
+			&workspace.Role, &workspace.MemberCount)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, &workspace)
+	}
+
+	return workspaces, rows.Err()
+}
+
+// Rename changes the name of a workspace
+func (r *WorkspaceRepository) Rename(ctx context.Context, id int, name string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE workspaces SET name = ? WHERE id = ?", name, id)
+	return err
+}
+
+// Delete deletes a workspace together with its crawl tasks and schedules
+func (r *WorkspaceRepository) Delete(ctx context.Context, id int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"crawl_tasks", "crawl_schedules"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE workspace_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM workspaces WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountActiveTasks counts the pending and running tasks of a workspace
+func (r *WorkspaceRepository) CountActiveTasks(ctx context.Context, id int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM crawl_tasks WHERE workspace_id = ? AND status IN (?, ?) AND deleted_at IS NULL",
+		id, TaskStatusPending, TaskStatusInProgress,
+	).Scan(&count)
+	return count, err
+}
+
+// GetRole retrieves the role of a user in a workspace, or an empty string if
+// the user is not a member
+func (r *WorkspaceRepository) GetRole(ctx context.Context, workspaceID, userID int) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx,
+		"SELECT role FROM workspace_members WHERE workspace_id = ? AND user_id = ?",
+		workspaceID, userID,
+	).Scan(&role)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// GetMemberIDs retrieves the IDs of the members of a workspace
+func (r *WorkspaceRepository) GetMemberIDs(ctx context.Context, workspaceID int) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT user_id FROM workspace_members WHERE workspace_id = ?", workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ListMembers retrieves the members of a workspace, owners first
+func (r *WorkspaceRepository) ListMembers(ctx context.Context, workspaceID int) ([]*WorkspaceMember, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT m.workspace_id, m.user_id, u.username, u.email, m.role, m.created_at
+		 FROM workspace_members m JOIN users u ON u.id = m.user_id
+		 WHERE m.workspace_id = ? ORDER BY FIELD(m.role, ?, ?, ?), u.username`,
+		workspaceID, WorkspaceRoleOwner, WorkspaceRoleEditor, WorkspaceRoleViewer,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*WorkspaceMember
+	for rows.Next() {
+		var member WorkspaceMember
+		err := rows.Scan(&member.WorkspaceID, &member.UserID, &member.Username, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember adds a user to a workspace. It reports false if the user already
+// is a member.
+func (r *WorkspaceRepository) AddMember(ctx context.Context, workspaceID, userID int, role string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		"INSERT IGNORE INTO workspace_members (workspace_id, user_id, role) VALUES (?, ?, ?)",
+		workspaceID, userID, role,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// UpdateMemberRole changes the role of a member of a workspace
+func (r *WorkspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID, userID int, role string) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE workspace_members SET role = ? WHERE workspace_id = ? AND user_id = ?",
+		role, workspaceID, userID,
+	)
+	return err
+}
+
+// RemoveMember removes a user from a workspace and disables the schedules
+// they created in it, which would otherwise keep starting tasks on their behalf
+func (r *WorkspaceRepository) RemoveMember(ctx context.Context, workspaceID, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?",
+		workspaceID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE crawl_schedules SET enabled = FALSE, next_run_at = NULL WHERE workspace_id = ? AND user_id = ?",
+		workspaceID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountMembers counts the members of a workspace
+func (r *WorkspaceRepository) CountMembers(ctx context.Context, workspaceID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ?", workspaceID).Scan(&count)
+	return count, err
+}
+
+// CountOwners counts the owners of a workspace
+func (r *WorkspaceRepository) CountOwners(ctx context.Context, workspaceID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ? AND role = ?",
+		workspaceID, WorkspaceRoleOwner,
+	).Scan(&count)
+	return count, err
+}
+
+// CountOwnedByUserID counts the workspaces, other than their personal one,
+// a user owns
+func (r *WorkspaceRepository) CountOwnedByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM workspace_members m JOIN workspaces w ON w.id = m.workspace_id
+		 WHERE m.user_id = ? AND m.role = ? AND w.personal_user_id IS NULL`,
+		userID, WorkspaceRoleOwner,
+	).Scan(&count)
+	return count, err
+}
+
+// brokenLinkCondition selects links whose check found them inaccessible
+const brokenLinkCondition = "l.is_accessible = FALSE AND l.check_status = 'checked'"
+
+// StatsRepository computes aggregate statistics over crawl tasks
+type StatsRepository struct {
+	db *sql.DB
+}
+
+// NewStatsRepository creates a new stats repository
+func NewStatsRepository(database *sql.DB) *StatsRepository {
+	return &StatsRepository{db: database}
+}
+
+// UserStats aggregates the crawl tasks of the workspaces a user is a member
+// of. The broken links time series covers the days since since, and at most
+// topDomains failing domains are listed.
+func (r *StatsRepository) UserStats(ctx context.Context, userID int, since time.Time, topDomains int) (*CrawlStats, error) {
+	return r.crawlStats(ctx, "t.deleted_at IS NULL AND t.workspace_id IN ("+memberWorkspaces+")", []interface{}{userID}, since, topDomains)
+}
+
+// GlobalStats aggregates the crawl tasks of every user, like UserStats
+func (r *StatsRepository) GlobalStats(ctx context.Context, since time.Time, topDomains int) (*CrawlStats, error) {
+	return r.crawlStats(ctx, "t.deleted_at IS NULL", nil, since, topDomains)
+}
+
+// crawlStats aggregates the crawl tasks t matching the scope condition
+func (r *StatsRepository) crawlStats(ctx context.Context, scope string, scopeArgs []interface{}, since time.Time, topDomains int) (*CrawlStats, error) {
+	stats := &CrawlStats{
+		TasksByStatus:       make(map[string]int),
+		BrokenLinksOverTime: []DailyBrokenLinks{},
+		TopFailingDomains:   []DomainFailures{},
+	}
+
+	// Tasks by status
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT t.status, COUNT(*) FROM crawl_tasks t WHERE "+scope+" GROUP BY t.status",
+		scopeArgs...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.TasksByStatus[status] = count
+		stats.TotalTasks += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats.CompletedTasks = stats.TasksByStatus[TaskStatusCompleted]
+	stats.FailedTasks = stats.TasksByStatus[TaskStatusFailed]
+	if finished := stats.CompletedTasks + stats.FailedTasks; finished > 0 {
+		stats.SuccessRate = float64(stats.CompletedTasks) / float64(finished)
+	}
+
+	// Pages and their response times
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(AVG(r.response_time_ms), 0)
+		 FROM crawl_results r JOIN crawl_tasks t ON t.id = r.task_id WHERE `+scope,
+		scopeArgs...,
+	).Scan(&stats.TotalPages, &stats.AverageResponseTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MIN(ranked.response_time_ms), 0) FROM (
+		   SELECT r.response_time_ms, CUME_DIST() OVER (ORDER BY r.response_time_ms) AS dist
+		   FROM crawl_results r JOIN crawl_tasks t ON t.id = r.task_id WHERE `+scope+`
+		 ) ranked WHERE ranked.dist >= 0.95`,
+		scopeArgs...,
+	).Scan(&stats.P95ResponseTime)
+	if err != nil {
+		return nil, err
+	}
+
+	// Links
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(`+brokenLinkCondition+`), 0)
+		 FROM crawl_links l JOIN crawl_tasks t ON t.id = l.task_id WHERE `+scope,
+		scopeArgs...,
+	).Scan(&stats.TotalLinks, &stats.BrokenLinks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Broken links per day the tasks were created on
+	daily := make(map[string]DailyBrokenLinks)
+	rows, err = r.db.QueryContext(ctx,
+		`SELECT DATE(t.created_at) AS day, COUNT(DISTINCT t.id), COALESCE(SUM(r.inaccessible_links_count), 0)
+		 FROM crawl_tasks t LEFT JOIN crawl_results r ON r.task_id = t.id
+		 WHERE `+scope+` AND t.created_at >= ?
+		 GROUP BY day`,
+		append(append([]interface{}{}, scopeArgs...), since)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var day time.Time
+		var entry DailyBrokenLinks
+		if err := rows.Scan(&day, &entry.Tasks, &entry.BrokenLinks); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entry.Date = day.Format("2006-01-02")
+		daily[entry.Date] = entry
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Report every day of the period so charts have no gaps
+	today := time.Now().Format("2006-01-02")
+	for day := since; ; day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		entry, ok := daily[date]
+		if !ok {
+			entry = DailyBrokenLinks{Date: date}
+		}
+		stats.BrokenLinksOverTime = append(stats.BrokenLinksOverTime, entry)
+		if date >= today {
+			break
+		}
+	}
+
+	// Domains with the most failed tasks
+	rows, err = r.db.QueryContext(ctx,
+		`SELECT t.host, SUM(t.status = 'failed') AS failed, COUNT(*) AS total
+		 FROM crawl_tasks t WHERE `+scope+` AND t.host <> ''
+		 GROUP BY t.host HAVING failed > 0
+		 ORDER BY failed DESC, total DESC, t.host LIMIT ?`,
+		append(append([]interface{}{}, scopeArgs...), topDomains)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var domain DomainFailures
+		if err := rows.Scan(&domain.Domain, &domain.FailedTasks, &domain.TotalTasks); err != nil {
+			return nil, err
+		}
+		domain.FailureRate = float64(domain.FailedTasks) / float64(domain.TotalTasks)
+		stats.TopFailingDomains = append(stats.TopFailingDomains, domain)
+	}
+
+	return stats, rows.Err()
+}
+
+// TaskStats breaks down the pages and links of a task. At most topHosts
+// hosts are listed, those with the most links first.
+func (r *StatsRepository) TaskStats(ctx context.Context, taskID int, topHosts int) (*TaskStats, error) {
+	stats := &TaskStats{
+		StatusCodes:   make(map[int]int),
+		StatusClasses: make(map[string]int),
+		Hosts:         []HostLinks{},
+	}
+
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(DISTINCT COALESCE(page_url, '')), COALESCE(AVG(response_time_ms), 0)
+		 FROM crawl_results WHERE task_id = ?`,
+		taskID,
+	).Scan(&stats.TotalPages, &stats.UniquePages, &stats.AverageResponseTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MIN(ranked.response_time_ms), 0) FROM (
+		   SELECT response_time_ms, CUME_DIST() OVER (ORDER BY response_time_ms) AS dist
+		   FROM crawl_results WHERE task_id = ?
+		 ) ranked WHERE ranked.dist >= 0.95`,
+		taskID,
+	).Scan(&stats.P95ResponseTime)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(l.link_type = 'internal'), 0), COALESCE(SUM(l.link_type = 'external'), 0),
+		 COALESCE(SUM(`+brokenLinkCondition+`), 0)
+		 FROM crawl_links l WHERE l.task_id = ?`,
+		taskID,
+	).Scan(&stats.TotalLinks, &stats.InternalLinks, &stats.ExternalLinks, &stats.BrokenLinks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Status codes, grouped into classes as well
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT status_code, COUNT(*) FROM crawl_links WHERE task_id = ? GROUP BY status_code",
+		taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var code sql.NullInt64
+		var count int
+		if err := rows.Scan(&code, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !code.Valid {
+			stats.StatusClasses["none"] += count
+			continue
+		}
+		stats.StatusCodes[int(code.Int64)] = count
+		stats.StatusClasses[fmt.Sprintf("%dxx", code.Int64/100)] += count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Hosts the links point to
+	rows, err = r.db.QueryContext(ctx,
+		`SELECT l.host, COUNT(*) AS links, COALESCE(SUM(`+brokenLinkCondition+`), 0)
+		 FROM crawl_links l WHERE l.task_id = ?
+		 GROUP BY l.host ORDER BY links DESC, l.host LIMIT ?`,
+		taskID, topHosts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var host HostLinks
+		if err := rows.Scan(&host.Host, &host.Links, &host.BrokenLinks); err != nil {
+			return nil, err
+		}
+		stats.Hosts = append(stats.Hosts, host)
 	}
 
-	return links, nil
+	return stats, rows.Err()
 }
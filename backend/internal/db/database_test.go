@@ -0,0 +1,148 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLinkFilterSeek(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    LinkFilter
+		cursor    LinkCursor
+		condition string
+		args      []interface{}
+	}{
+		{
+			name:      "id ascending",
+			filter:    LinkFilter{},
+			cursor:    LinkCursor{Value: "10", ID: 10},
+			condition: "(id > ? OR (id = ? AND id > ?))",
+			args:      []interface{}{10, 10, 10},
+		},
+		{
+			name:      "status code descending",
+			filter:    LinkFilter{Sort: "status_code", Descending: true},
+			cursor:    LinkCursor{Value: "0", ID: 4},
+			condition: "(COALESCE(status_code, 0) < ? OR (COALESCE(status_code, 0) = ? AND id < ?))",
+			args:      []interface{}{0, 0, 4},
+		},
+		{
+			name:      "text field",
+			filter:    LinkFilter{Sort: "url"},
+			cursor:    LinkCursor{Value: "https://example.com", ID: 2},
+			condition: "(url > ? OR (url = ? AND id > ?))",
+			args:      []interface{}{"https://example.com", "https://example.com", 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args, err := tt.filter.seek(&tt.cursor)
+			if err != nil {
+				t.Fatalf("seek: %v", err)
+			}
+			if condition != tt.condition {
+				t.Errorf("condition = %q, want %q", condition, tt.condition)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestLinkFilterSeekInvalidValue(t *testing.T) {
+	filter := LinkFilter{Sort: "status_code"}
+	if _, _, err := filter.seek(&LinkCursor{Value: "abc", ID: 1}); !errors.Is(err, ErrInvalidLinkFilter) {
+		t.Errorf("error = %v, want ErrInvalidLinkFilter", err)
+	}
+}
+
+// TestLinkStatusCodePaging pages through links sorted by status code the way
+// the database does, with the seek condition evaluated in Go, and checks every
+// link is listed exactly once and in order, including links without a status
+// code, which sort as 0
+func TestLinkStatusCodePaging(t *testing.T) {
+	code := func(n int) *int { return &n }
+	links := []*CrawlLink{
+		{ID: 1, StatusCode: code(404)},
+		{ID: 2},
+		{ID: 3, StatusCode: code(200)},
+		{ID: 4, StatusCode: code(0)},
+		{ID: 5},
+		{ID: 6, StatusCode: code(200)},
+		{ID: 7, StatusCode: code(500)},
+		{ID: 8},
+	}
+	coalesce := func(l *CrawlLink) int {
+		if l.StatusCode == nil {
+			return 0
+		}
+		return *l.StatusCode
+	}
+
+	for _, descending := range []bool{false, true} {
+		for _, pageSize := range []int{1, 2, 3, len(links)} {
+			filter := LinkFilter{Sort: "status_code", Descending: descending}
+
+			// ORDER BY COALESCE(status_code, 0), id in the filter's direction
+			ordered := append([]*CrawlLink(nil), links...)
+			sort.Slice(ordered, func(i, j int) bool {
+				a, b := ordered[i], ordered[j]
+				if coalesce(a) != coalesce(b) {
+					return (coalesce(a) < coalesce(b)) != descending
+				}
+				return (a.ID < b.ID) != descending
+			})
+
+			var listed []*CrawlLink
+			var cursor *LinkCursor
+			for pages := 0; pages <= len(links); pages++ {
+				var page []*CrawlLink
+				for _, link := range ordered {
+					if len(page) == pageSize {
+						break
+					}
+					if cursor != nil && !seekMatches(t, filter, cursor, coalesce(link), link.ID) {
+						continue
+					}
+					page = append(page, link)
+				}
+				if len(page) == 0 {
+					break
+				}
+				listed = append(listed, page...)
+				next := filter.CursorFor(page[len(page)-1])
+				cursor = &next
+			}
+
+			if !reflect.DeepEqual(listed, ordered) {
+				ids := func(ls []*CrawlLink) (out []int) {
+					for _, l := range ls {
+						out = append(out, l.ID)
+					}
+					return out
+				}
+				t.Errorf("descending %v, page size %d: listed %v, want %v", descending, pageSize, ids(listed), ids(ordered))
+			}
+		}
+	}
+}
+
+// seekMatches evaluates the seek condition of a numeric sort field for a
+// row with the given sort value and ID
+func seekMatches(t *testing.T, filter LinkFilter, cursor *LinkCursor, value, id int) bool {
+	t.Helper()
+	_, args, err := filter.seek(cursor)
+	if err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	after, cursorID := args[0].(int), args[2].(int)
+	if filter.Descending {
+		return value < after || (value == after && id < cursorID)
+	}
+	return value > after || (value == after && id > cursorID)
+}
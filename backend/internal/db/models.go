@@ -1,37 +1,55 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // User represents a user in the system
 type User struct {
-	ID           int       `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID              int        `json:"id" db:"id"`
+	Username        string     `json:"username" db:"username"`
+	Email           string     `json:"email" db:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	Role            string     `json:"role" db:"role"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // CrawlTask represents a crawling task
 type CrawlTask struct {
 	ID           int        `json:"id" db:"id"`
 	UserID       int        `json:"user_id" db:"user_id"`
+	WorkspaceID  int        `json:"workspace_id" db:"workspace_id"`
 	URL          string     `json:"url" db:"url"`
+	Host         string     `json:"host" db:"host"`
+	SeriesKey    string     `json:"series_key" db:"series_key"`
+	ParentTaskID *int       `json:"parent_task_id,omitempty" db:"parent_task_id"`
+	ScheduleID   *int       `json:"schedule_id,omitempty" db:"schedule_id"`
+	CrawlMode    string     `json:"crawl_mode" db:"crawl_mode"`
+	MaxDepth     int        `json:"max_depth" db:"max_depth"`
+	MaxPages     int        `json:"max_pages" db:"max_pages"`
+	CrawlScope   string     `json:"crawl_scope" db:"crawl_scope"`
+	IgnoreRobots bool       `json:"ignore_robots" db:"ignore_robots"`
 	Status       string     `json:"status" db:"status"`
 	Progress     float64    `json:"progress" db:"progress"`
 	ErrorMessage *string    `json:"error_message,omitempty" db:"error_message"`
+	Attempts     int        `json:"attempts" db:"attempts"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
 	StartedAt    *time.Time `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt  *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 }
 
 // CrawlResult represents the analysis result of a crawl task
 type CrawlResult struct {
 	ID                     int       `json:"id" db:"id"`
 	TaskID                 int       `json:"task_id" db:"task_id"`
+	PageURL                *string   `json:"page_url,omitempty" db:"page_url"`
+	Depth                  int       `json:"depth" db:"depth"`
 	HTMLVersion            *string   `json:"html_version,omitempty" db:"html_version"`
 	PageTitle              *string   `json:"page_title,omitempty" db:"page_title"`
 	H1Count                int       `json:"h1_count" db:"h1_count"`
@@ -54,16 +72,253 @@ type CrawlResult struct {
 type CrawlLink struct {
 	ID             int        `json:"id" db:"id"`
 	TaskID         int        `json:"task_id" db:"task_id"`
+	PageURL        *string    `json:"page_url,omitempty" db:"page_url"`
 	URL            string     `json:"url" db:"url"`
+	Host           string     `json:"host" db:"host"`
 	LinkType       string     `json:"link_type" db:"link_type"`
 	StatusCode     *int       `json:"status_code,omitempty" db:"status_code"`
 	IsAccessible   bool       `json:"is_accessible" db:"is_accessible"`
+	CheckStatus    string     `json:"check_status" db:"check_status"`
 	AnchorText     *string    `json:"anchor_text,omitempty" db:"anchor_text"`
 	ResponseTimeMs int        `json:"response_time_ms" db:"response_time_ms"`
 	CheckedAt      *time.Time `json:"checked_at,omitempty" db:"checked_at"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 }
 
+// CrawlSchedule starts a crawl task for a URL at the times given by a cron
+// expression or every IntervalSeconds, evaluated in Timezone
+type CrawlSchedule struct {
+	ID              int        `json:"id" db:"id"`
+	UserID          int        `json:"user_id" db:"user_id"`
+	WorkspaceID     int        `json:"workspace_id" db:"workspace_id"`
+	Name            string     `json:"name" db:"name"`
+	URL             string     `json:"url" db:"url"`
+	CrawlMode       string     `json:"crawl_mode" db:"crawl_mode"`
+	MaxDepth        int        `json:"max_depth" db:"max_depth"`
+	MaxPages        int        `json:"max_pages" db:"max_pages"`
+	CrawlScope      string     `json:"crawl_scope" db:"crawl_scope"`
+	IgnoreRobots    bool       `json:"ignore_robots" db:"ignore_robots"`
+	CronExpr        *string    `json:"cron_expr,omitempty" db:"cron_expr"`
+	IntervalSeconds *int       `json:"interval_seconds,omitempty" db:"interval_seconds"`
+	Timezone        string     `json:"timezone" db:"timezone"`
+	Enabled         bool       `json:"enabled" db:"enabled"`
+	MissedRunPolicy string     `json:"missed_run_policy" db:"missed_run_policy"`
+	NextRunAt       *time.Time `json:"next_run_at,omitempty" db:"next_run_at"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastTaskID      *int       `json:"last_task_id,omitempty" db:"last_task_id"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Workspace groups the crawl tasks and schedules shared by its members.
+// Personal workspaces belong to a single user and cannot be shared.
+type Workspace struct {
+	ID             int       `json:"id" db:"id"`
+	Name           string    `json:"name" db:"name"`
+	PersonalUserID *int      `json:"personal_user_id,omitempty" db:"personal_user_id"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+
+	// Role is the role of the user the workspace was loaded for, and
+	// MemberCount the number of its members, loaded by GetByUserID
+	Role        string `json:"role,omitempty"`
+	MemberCount int    `json:"member_count,omitempty"`
+}
+
+// Personal reports whether the workspace is the personal workspace of a user
+func (w *Workspace) Personal() bool {
+	return w.PersonalUserID != nil
+}
+
+// WorkspaceMember is the membership of a user in a workspace
+type WorkspaceMember struct {
+	WorkspaceID int       `json:"workspace_id" db:"workspace_id"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	Username    string    `json:"username" db:"username"`
+	Email       string    `json:"email" db:"email"`
+	Role        string    `json:"role" db:"role"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserEvent is a real-time update sent to a user, kept so that reconnecting
+// clients can catch up on what they missed
+type UserEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	EventID   int64     `json:"event_id" db:"event_id"`
+	TaskID    *int      `json:"task_id,omitempty" db:"task_id"`
+	Payload   []byte    `json:"payload" db:"payload"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Webhook posts the task lifecycle events its user subscribed to to a URL,
+// signed with Secret
+type Webhook struct {
+	ID          int       `json:"id" db:"id"`
+	UserID      int       `json:"user_id" db:"user_id"`
+	URL         string    `json:"url" db:"url"`
+	Secret      string    `json:"-" db:"secret"`
+	Events      []string  `json:"events" db:"events"`
+	Description string    `json:"description" db:"description"`
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WebhookDelivery is one event sent to a webhook, with the outcome of its
+// latest attempt. Pending deliveries are retried at NextAttemptAt.
+type WebhookDelivery struct {
+	ID             int64           `json:"id" db:"id"`
+	WebhookID      int             `json:"webhook_id" db:"webhook_id"`
+	Event          string          `json:"event" db:"event"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status,omitempty" db:"response_status"`
+	ResponseBody   *string         `json:"response_body,omitempty" db:"response_body"`
+	Error          *string         `json:"error,omitempty" db:"error"`
+	DurationMs     int             `json:"duration_ms" db:"duration_ms"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// APIToken is a personal access token that authenticates its user without a
+// password. Only the hash of the token is stored; Prefix identifies it in
+// listings.
+type APIToken struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"token_prefix"`
+	Hash       string     `json:"-" db:"token_hash"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+
+	// Username and UserRole are the name and role of the token's user,
+	// loaded by GetByHash
+	Username string `json:"-"`
+	UserRole string `json:"-"`
+}
+
+// HasScope reports whether the token grants scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the token can be used at now
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+// AuthSession is a login of a user on one device. Its access tokens stop
+// working as soon as it is revoked.
+type AuthSession struct {
+	ID           int64      `json:"id" db:"id"`
+	UserID       int        `json:"user_id" db:"user_id"`
+	UserAgent    string     `json:"user_agent" db:"user_agent"`
+	IP           string     `json:"ip" db:"ip"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokeReason *string    `json:"revoke_reason,omitempty" db:"revoke_reason"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Active reports whether the session can be used at now
+func (s *AuthSession) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is an opaque single-use token that renews the access token of
+// a session. Only its hash is stored.
+type RefreshToken struct {
+	ID        int64      `json:"id" db:"id"`
+	SessionID int64      `json:"session_id" db:"session_id"`
+	Hash      string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// UserToken is a single-use token emailed to a user to reset their password
+// or verify their email address. Only its hash is stored.
+type UserToken struct {
+	ID      int64  `json:"id" db:"id"`
+	UserID  int    `json:"user_id" db:"user_id"`
+	Purpose string `json:"purpose" db:"purpose"`
+	Hash    string `json:"-" db:"token_hash"`
+	// Email is the address the token was sent to
+	Email     string     `json:"email" db:"email"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CrawlStats aggregates the crawl tasks of a user, or of every user. Its JSON
+// field names follow the frontend's existing stats types.
+type CrawlStats struct {
+	TotalTasks          int                `json:"totalTasks"`
+	CompletedTasks      int                `json:"completedTasks"`
+	FailedTasks         int                `json:"failedTasks"`
+	TasksByStatus       map[string]int     `json:"tasksByStatus"`
+	SuccessRate         float64            `json:"successRate"`
+	TotalPages          int                `json:"totalPages"`
+	TotalLinks          int                `json:"totalLinks"`
+	BrokenLinks         int                `json:"brokenLinks"`
+	AverageResponseTime float64            `json:"averageResponseTime"`
+	P95ResponseTime     int                `json:"p95ResponseTime"`
+	BrokenLinksOverTime []DailyBrokenLinks `json:"brokenLinksOverTime"`
+	TopFailingDomains   []DomainFailures   `json:"topFailingDomains"`
+}
+
+// DailyBrokenLinks counts the broken links found by the tasks created on a day
+type DailyBrokenLinks struct {
+	Date        string `json:"date"`
+	Tasks       int    `json:"tasks"`
+	BrokenLinks int    `json:"brokenLinks"`
+}
+
+// DomainFailures counts the failed crawl tasks of a domain
+type DomainFailures struct {
+	Domain      string  `json:"domain"`
+	FailedTasks int     `json:"failedTasks"`
+	TotalTasks  int     `json:"totalTasks"`
+	FailureRate float64 `json:"failureRate"`
+}
+
+// TaskStats breaks down the pages and links of a single crawl task
+type TaskStats struct {
+	TotalPages          int            `json:"totalPages"`
+	UniquePages         int            `json:"uniquePages"`
+	TotalLinks          int            `json:"totalLinks"`
+	InternalLinks       int            `json:"internalLinks"`
+	ExternalLinks       int            `json:"externalLinks"`
+	BrokenLinks         int            `json:"brokenLinks"`
+	AverageResponseTime float64        `json:"averageResponseTime"`
+	P95ResponseTime     int            `json:"p95ResponseTime"`
+	StatusCodes         map[int]int    `json:"statusCodes"`
+	StatusClasses       map[string]int `json:"statusClasses"`
+	Hosts               []HostLinks    `json:"hosts"`
+}
+
+// HostLinks counts the links of a task that point to a host
+type HostLinks struct {
+	Host        string `json:"host"`
+	Links       int    `json:"links"`
+	BrokenLinks int    `json:"brokenLinks"`
+}
+
 // TaskStatus constants
 const (
 	TaskStatusPending    = "pending"
@@ -73,6 +328,104 @@ const (
 	TaskStatusCancelled  = "cancelled"
 )
 
+// CrawlMode constants
+const (
+	CrawlModePage = "page"
+	CrawlModeSite = "site"
+)
+
+// CrawlScope constants
+const (
+	CrawlScopeHost      = "host"
+	CrawlScopeSubdomain = "subdomain"
+)
+
+// MissedRunPolicy constants decide what happens to runs missed while the
+// server was down
+const (
+	MissedRunRunOnce = "run_once"
+	MissedRunSkip    = "skip"
+)
+
+// DeliveryStatus constants of webhook deliveries
+const (
+	DeliveryStatusPending    = "pending"
+	DeliveryStatusDelivering = "delivering"
+	DeliveryStatusSucceeded  = "succeeded"
+	DeliveryStatusFailed     = "failed"
+)
+
+// Scope constants of API tokens
+const (
+	// ScopeRead allows reading tasks, results, statistics, schedules and webhooks
+	ScopeRead = "read"
+	// ScopeCrawl allows starting, stopping and deleting crawls and managing
+	// schedules and webhooks
+	ScopeCrawl = "crawl"
+	// ScopeAdmin allows using the admin privileges of the token's user
+	ScopeAdmin = "admin"
+)
+
+// SessionRevokeReason constants record why a session ended
+const (
+	SessionRevokedLogout    = "logout"
+	SessionRevokedLogoutAll = "logout_all"
+	SessionRevokedReuse     = "refresh_token_reuse"
+	SessionRevokedPassword  = "password_change"
+	SessionRevokedRole      = "role_change"
+	SessionRevokedDisabled  = "account_disabled"
+)
+
+// Role constants. Admins can do anything, members can crawl and read-only
+// users can only view their own data.
+const (
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read_only"
+)
+
+// Roles lists every role
+var Roles = []string{RoleAdmin, RoleMember, RoleReadOnly}
+
+// RoleScopes returns the scopes a role grants. Requests are limited to these
+// whether they use a JWT or a personal access token.
+func RoleScopes(role string) []string {
+	switch role {
+	case RoleAdmin:
+		return []string{ScopeRead, ScopeCrawl, ScopeAdmin}
+	case RoleMember:
+		return []string{ScopeRead, ScopeCrawl}
+	case RoleReadOnly:
+		return []string{ScopeRead}
+	default:
+		return nil
+	}
+}
+
+// WorkspaceRole constants. Owners manage the workspace and its members,
+// editors start and manage crawls, and viewers can only look at them.
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+// WorkspaceRoles lists every workspace role
+var WorkspaceRoles = []string{WorkspaceRoleOwner, WorkspaceRoleEditor, WorkspaceRoleViewer}
+
+// UserTokenPurpose constants
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+// LinkCheckStatus constants
+const (
+	LinkCheckStatusChecked    = "checked"
+	LinkCheckStatusSkipped    = "skipped"
+	LinkCheckStatusDisallowed = "disallowed"
+)
+
 // LinkType constants
 const (
 	LinkTypeInternal = "internal"
@@ -0,0 +1,339 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"web-crawler/config"
+	"web-crawler/internal/db"
+)
+
+// Event types published by the crawler
+const (
+	TypeProgress = "progress_update"
+	TypeResults  = "results_update"
+	TypeFailed   = "crawl_failed"
+	TypeStopped  = "crawl_stopped"
+	TypeDeleted  = "task_deleted"
+	TypeRestored = "task_restored"
+)
+
+// Types of the messages that end the replay of missed events
+const (
+	TypeResumed        = "resumed"
+	TypeResyncRequired = "resync_required"
+)
+
+// Message is a JSON object published to a user. The bus adds an "event_id"
+// field to every message it publishes.
+type Message map[string]interface{}
+
+// Event is an encoded message delivered to a subscriber. Messages meant for a
+// single subscriber, such as acknowledgements, have an ID of zero and are not
+// replayed.
+type Event struct {
+	ID   int64
+	Type string
+	Data []byte
+}
+
+// Subscriber receives the events of a single user, e.g. one WebSocket
+// connection or one Server-Sent Events stream
+type Subscriber struct {
+	UserID int
+	events chan *Event
+
+	// tasks holds the task IDs the subscriber follows and replaying is set
+	// while missed events are being loaded. Both are owned by the bus's Run
+	// loop and must not be accessed elsewhere.
+	tasks     map[int]bool
+	replaying bool
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscriber is removed, including when it falls too far behind.
+func (s *Subscriber) Events() <-chan *Event {
+	return s.events
+}
+
+// follows reports whether the subscriber wants events about a task.
+// Subscribers that do not follow any task receive events for all of them.
+func (s *Subscriber) follows(taskID int) bool {
+	return len(s.tasks) == 0 || s.tasks[taskID]
+}
+
+// SubscribeOptions controls what a new subscriber receives
+type SubscribeOptions struct {
+	// TaskIDs limits the subscriber to events about these tasks
+	TaskIDs []int
+	// Resume replays the events after LastEventID before any new ones
+	Resume      bool
+	LastEventID int64
+}
+
+// outbound is a message waiting to be published to a set of users. A taskID
+// of zero means the message is not about a specific task.
+type outbound struct {
+	userIDs []int
+	taskID  int
+	message Message
+}
+
+// registration adds a subscriber to the bus
+type registration struct {
+	sub  *Subscriber
+	opts SubscribeOptions
+}
+
+// follow is a request from a subscriber to follow or stop following a task
+type follow struct {
+	sub    *Subscriber
+	taskID int
+	follow bool
+}
+
+// resumeRequest asks the bus to replay the events a subscriber missed
+type resumeRequest struct {
+	sub         *Subscriber
+	lastEventID int64
+}
+
+// Bus delivers crawl events to every subscriber of a user, whatever transport
+// the subscriber uses. The subscriber maps, event logs and each subscriber's
+// state are only touched by Run, so every change goes through a channel.
+type Bus struct {
+	subscribers map[*Subscriber]bool
+	users       map[int]map[*Subscriber]bool
+	logs        map[int]*eventLog
+	publish     chan outbound
+	register    chan registration
+	unregister  chan *Subscriber
+	follow      chan follow
+	resume      chan resumeRequest
+	replayed    chan replayResult
+	disconnect  chan struct{}
+
+	logSize int
+	store   *eventStore
+	members *memberCache
+}
+
+// NewBus creates a new event bus. Events are also written to eventRepo when
+// event persistence is enabled, so they survive a restart. Events about a
+// task go to every member of its workspace, as found in workspaceRepo.
+func NewBus(eventRepo *db.EventRepository, workspaceRepo *db.WorkspaceRepository) *Bus {
+	cfg := config.Load()
+	logSize := cfg.Events.LogSize
+	if logSize < 1 {
+		logSize = 1
+	}
+
+	var store *eventStore
+	if cfg.Events.Persist && eventRepo != nil {
+		store = newEventStore(eventRepo, cfg.Events.Retention)
+	}
+
+	return &Bus{
+		publish:     make(chan outbound, 256),
+		register:    make(chan registration),
+		unregister:  make(chan *Subscriber),
+		follow:      make(chan follow),
+		resume:      make(chan resumeRequest),
+		replayed:    make(chan replayResult),
+		disconnect:  make(chan struct{}),
+		subscribers: make(map[*Subscriber]bool),
+		users:       make(map[int]map[*Subscriber]bool),
+		logs:        make(map[int]*eventLog),
+		logSize:     logSize,
+		store:       store,
+		members:     newMemberCache(workspaceRepo),
+	}
+}
+
+// Run starts the bus
+func (b *Bus) Run() {
+	if b.store != nil {
+		lastIDs, err := b.store.start()
+		if err != nil {
+			// Without the stored IDs new events would reuse old ones
+			log.Printf("Failed to load stored events, persistence disabled: %v", err)
+			b.store = nil
+		}
+		for userID, lastID := range lastIDs {
+			b.logs[userID] = &eventLog{lastID: lastID}
+		}
+	}
+
+	for {
+		select {
+		case reg := <-b.register:
+			sub := reg.sub
+			b.subscribers[sub] = true
+			if b.users[sub.UserID] == nil {
+				b.users[sub.UserID] = make(map[*Subscriber]bool)
+			}
+			b.users[sub.UserID][sub] = true
+
+			if reg.opts.Resume {
+				b.replay(sub, reg.opts.LastEventID)
+			} else {
+				b.send(sub, Message{"type": "connected", "last_event_id": b.log(sub.UserID).lastID})
+			}
+
+		case sub := <-b.unregister:
+			b.remove(sub)
+
+		case f := <-b.follow:
+			if !b.subscribers[f.sub] {
+				continue
+			}
+			msgType := "subscribed"
+			if f.follow {
+				f.sub.tasks[f.taskID] = true
+			} else {
+				delete(f.sub.tasks, f.taskID)
+				msgType = "unsubscribed"
+			}
+			b.send(f.sub, Message{"type": msgType, "task_id": f.taskID})
+
+		case req := <-b.resume:
+			if b.subscribers[req.sub] {
+				b.replay(req.sub, req.lastEventID)
+			}
+
+		case result := <-b.replayed:
+			b.finishReplay(result)
+
+		case <-b.disconnect:
+			for sub := range b.subscribers {
+				b.remove(sub)
+			}
+
+		case msg := <-b.publish:
+			for i, userID := range msg.userIDs {
+				message := msg.message
+				// Every user numbers their events, so each gets their own copy
+				if i < len(msg.userIDs)-1 {
+					message = maps.Clone(message)
+				}
+				event := b.record(userID, msg.taskID, message)
+				if event == nil {
+					continue
+				}
+				for sub := range b.users[userID] {
+					if sub.replaying || !sub.follows(msg.taskID) {
+						continue
+					}
+					b.deliver(sub, event)
+				}
+			}
+		}
+	}
+}
+
+// Publish sends a message to every subscriber of a user. The bus takes
+// ownership of message.
+func (b *Bus) Publish(userID int, message Message) {
+	b.publish <- outbound{userIDs: []int{userID}, message: message}
+}
+
+// PublishTask sends a message about a task to the subscribers of every member
+// of the task's workspace that follow the task. The bus takes ownership of
+// message.
+func (b *Bus) PublishTask(workspaceID, taskID int, message Message) {
+	userIDs := b.members.get(workspaceID)
+	if len(userIDs) == 0 {
+		return
+	}
+	b.publish <- outbound{userIDs: userIDs, taskID: taskID, message: message}
+}
+
+// ForgetMembers makes the bus reload the members of a workspace, which must
+// be called whenever they change
+func (b *Bus) ForgetMembers(workspaceID int) {
+	b.members.forget(workspaceID)
+}
+
+// Subscribe adds a subscriber for a user. It must be removed with Unsubscribe.
+func (b *Bus) Subscribe(userID int, opts SubscribeOptions) *Subscriber {
+	sub := &Subscriber{
+		UserID: userID,
+		// Leave room for a full replay on top of the usual backlog
+		events: make(chan *Event, 256+b.logSize),
+		tasks:  make(map[int]bool),
+	}
+	for _, taskID := range opts.TaskIDs {
+		sub.tasks[taskID] = true
+	}
+
+	b.register <- registration{sub: sub, opts: opts}
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its event channel
+func (b *Bus) Unsubscribe(sub *Subscriber) {
+	b.unregister <- sub
+}
+
+// Follow makes a subscriber receive events about a task. Once it follows a
+// task, it only receives events about the tasks it follows.
+func (b *Bus) Follow(sub *Subscriber, taskID int) {
+	b.follow <- follow{sub: sub, taskID: taskID, follow: true}
+}
+
+// Unfollow stops a subscriber from receiving events about a task
+func (b *Bus) Unfollow(sub *Subscriber, taskID int) {
+	b.follow <- follow{sub: sub, taskID: taskID, follow: false}
+}
+
+// Resume replays the events a subscriber missed after lastEventID
+func (b *Bus) Resume(sub *Subscriber, lastEventID int64) {
+	b.resume <- resumeRequest{sub: sub, lastEventID: lastEventID}
+}
+
+// DisconnectAll removes every subscriber, which ends their streams
+func (b *Bus) DisconnectAll() {
+	b.disconnect <- struct{}{}
+}
+
+// deliver queues an event for a subscriber, removing it if it cannot keep up
+func (b *Bus) deliver(sub *Subscriber, event *Event) {
+	select {
+	case sub.events <- event:
+	default:
+		if b.remove(sub) {
+			log.Printf("Subscriber of user %d too slow, disconnected", sub.UserID)
+		}
+	}
+}
+
+// send delivers a message that is meant for a single subscriber and is not
+// recorded in the event log
+func (b *Bus) send(sub *Subscriber, message Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to marshal %v message: %v", message["type"], err)
+		return
+	}
+	msgType, _ := message["type"].(string)
+	b.deliver(sub, &Event{Type: msgType, Data: data})
+}
+
+// remove forgets a subscriber and closes its event channel. It reports
+// whether the subscriber was still registered, so the channel is only ever
+// closed once.
+func (b *Bus) remove(sub *Subscriber) bool {
+	if !b.subscribers[sub] {
+		return false
+	}
+
+	delete(b.subscribers, sub)
+	if subs := b.users[sub.UserID]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(b.users, sub.UserID)
+		}
+	}
+	close(sub.events)
+	return true
+}
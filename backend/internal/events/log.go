@@ -0,0 +1,259 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+	"web-crawler/internal/db"
+)
+
+// eventLog holds the most recent events of a user. Event IDs increase by one
+// with every event, so a subscriber that remembers the last ID it saw can ask
+// for exactly the events it missed.
+type eventLog struct {
+	lastID int64
+	events []*db.UserEvent
+}
+
+// replayResult carries events loaded from the database back to the bus
+type replayResult struct {
+	sub     *Subscriber
+	afterID int64
+	events  []*db.UserEvent
+	err     error
+}
+
+// log returns the event log of a user, creating it if needed
+func (b *Bus) log(userID int) *eventLog {
+	lg, ok := b.logs[userID]
+	if !ok {
+		lg = &eventLog{}
+		b.logs[userID] = lg
+	}
+	return lg
+}
+
+// record assigns the next event ID of a user to a message and keeps the
+// resulting event for replay. It returns nil if the message cannot be encoded.
+func (b *Bus) record(userID, taskID int, message Message) *Event {
+	lg := b.log(userID)
+	eventID := lg.lastID + 1
+	message["event_id"] = eventID
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Failed to marshal %v message: %v", message["type"], err)
+		return nil
+	}
+
+	stored := &db.UserEvent{
+		UserID:    userID,
+		EventID:   eventID,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	if taskID != 0 {
+		stored.TaskID = &taskID
+	}
+
+	lg.lastID = eventID
+	lg.events = append(lg.events, stored)
+	if len(lg.events) > b.logSize {
+		lg.events = lg.events[len(lg.events)-b.logSize:]
+	}
+
+	if b.store != nil {
+		b.store.save(stored)
+	}
+
+	msgType, _ := message["type"].(string)
+	return &Event{ID: eventID, Type: msgType, Data: payload}
+}
+
+// replay sends a subscriber the events it missed since afterID, followed by a
+// "resumed" message. Events older than the in-memory log are loaded from the
+// database; live events are held back until they have been sent. When the
+// missed events cannot be replayed the subscriber is asked to reload its state.
+func (b *Bus) replay(sub *Subscriber, afterID int64) {
+	lg := b.log(sub.UserID)
+
+	switch {
+	case afterID == lg.lastID:
+		b.finishReplay(replayResult{sub: sub, afterID: afterID})
+	case afterID > lg.lastID || lg.lastID-afterID > int64(b.logSize):
+		b.resync(sub)
+	case len(lg.events) > 0 && lg.events[0].EventID <= afterID+1:
+		b.finishReplay(replayResult{sub: sub, afterID: afterID})
+	case b.store != nil:
+		sub.replaying = true
+		go func() {
+			events, err := b.store.fetch(sub.UserID, afterID, b.logSize)
+			b.replayed <- replayResult{sub: sub, afterID: afterID, events: events, err: err}
+		}()
+	default:
+		b.resync(sub)
+	}
+}
+
+// finishReplay merges events loaded from the database with the in-memory log
+// and sends the subscriber everything after the ID it asked for
+func (b *Bus) finishReplay(result replayResult) {
+	sub := result.sub
+	if !b.subscribers[sub] {
+		return
+	}
+	sub.replaying = false
+
+	if result.err != nil {
+		log.Printf("Failed to load events of user %d: %v", sub.UserID, result.err)
+		b.resync(sub)
+		return
+	}
+
+	lg := b.log(sub.UserID)
+	byID := make(map[int64]*db.UserEvent)
+	for _, event := range append(result.events, lg.events...) {
+		if event.EventID > result.afterID {
+			byID[event.EventID] = event
+		}
+	}
+
+	missed := make([]*db.UserEvent, 0, len(byID))
+	for _, event := range byID {
+		missed = append(missed, event)
+	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].EventID < missed[j].EventID })
+
+	// Any gap means some events are gone, so a partial replay would mislead
+	for i, event := range missed {
+		if event.EventID != result.afterID+int64(i)+1 {
+			b.resync(sub)
+			return
+		}
+	}
+	if result.afterID+int64(len(missed)) != lg.lastID {
+		b.resync(sub)
+		return
+	}
+
+	replayed := 0
+	for _, event := range missed {
+		taskID := 0
+		if event.TaskID != nil {
+			taskID = *event.TaskID
+		}
+		if !sub.follows(taskID) {
+			continue
+		}
+		b.deliver(sub, storedEvent(event))
+		replayed++
+	}
+
+	b.send(sub, Message{"type": TypeResumed, "last_event_id": lg.lastID, "replayed": replayed})
+}
+
+// resync tells a subscriber that its missed events cannot be replayed, so it
+// must reload its state and continue from the current event ID
+func (b *Bus) resync(sub *Subscriber) {
+	sub.replaying = false
+	b.send(sub, Message{"type": TypeResyncRequired, "last_event_id": b.log(sub.UserID).lastID})
+}
+
+// storedEvent turns a logged event back into an event to deliver
+func storedEvent(stored *db.UserEvent) *Event {
+	var header struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(stored.Payload, &header)
+	return &Event{ID: stored.EventID, Type: header.Type, Data: stored.Payload}
+}
+
+// eventStore writes events to the database in the background and removes
+// them once they are older than the retention period
+type eventStore struct {
+	repo      *db.EventRepository
+	retention time.Duration
+	queue     chan *db.UserEvent
+}
+
+// newEventStore creates a new event store
+func newEventStore(repo *db.EventRepository, retention time.Duration) *eventStore {
+	return &eventStore{
+		repo:      repo,
+		retention: retention,
+		queue:     make(chan *db.UserEvent, 1024),
+	}
+}
+
+// start loads the last stored event ID of every user and starts writing events
+func (s *eventStore) start() (map[int]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lastIDs, err := s.repo.LastEventIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.run()
+	return lastIDs, nil
+}
+
+// save queues an event to be written. Events are dropped rather than blocking
+// the bus when the database falls behind.
+func (s *eventStore) save(event *db.UserEvent) {
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Event queue full, event %d of user %d not stored", event.EventID, event.UserID)
+	}
+}
+
+// fetch loads up to limit events of a user after afterID
+func (s *eventStore) fetch(userID int, afterID int64, limit int) ([]*db.UserEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.repo.ListAfter(ctx, userID, afterID, limit)
+}
+
+// run writes queued events and periodically purges expired ones
+func (s *eventStore) run() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	s.purge()
+	for {
+		select {
+		case event := <-s.queue:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := s.repo.Create(ctx, event); err != nil {
+				log.Printf("Failed to store event %d of user %d: %v", event.EventID, event.UserID, err)
+			}
+			cancel()
+		case <-ticker.C:
+			s.purge()
+		}
+	}
+}
+
+// purge removes events older than the retention period
+func (s *eventStore) purge() {
+	if s.retention <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	removed, err := s.repo.DeleteBefore(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		log.Printf("Failed to purge events: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Purged %d expired events", removed)
+	}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"web-crawler/internal/db"
+)
+
+// membersTTL is how long the members of a workspace are cached. Membership
+// changes made through the API clear the cache right away.
+const membersTTL = 30 * time.Second
+
+// memberCache remembers the members of workspaces, so that publishing the
+// frequent progress updates of a crawl does not query the database every time
+type memberCache struct {
+	repo    *db.WorkspaceRepository
+	mu      sync.Mutex
+	entries map[int]memberEntry
+}
+
+// memberEntry is the cached member list of a workspace
+type memberEntry struct {
+	userIDs   []int
+	expiresAt time.Time
+}
+
+// newMemberCache creates a new member cache
+func newMemberCache(repo *db.WorkspaceRepository) *memberCache {
+	return &memberCache{
+		repo:    repo,
+		entries: make(map[int]memberEntry),
+	}
+}
+
+// get returns the IDs of the members of a workspace. When they cannot be
+// loaded, the last known members are returned.
+func (c *memberCache) get(workspaceID int) []int {
+	c.mu.Lock()
+	entry, ok := c.entries[workspaceID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.userIDs
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	userIDs, err := c.repo.GetMemberIDs(ctx, workspaceID)
+	if err != nil {
+		log.Printf("Failed to load the members of workspace %d: %v", workspaceID, err)
+		return entry.userIDs
+	}
+
+	c.mu.Lock()
+	c.entries[workspaceID] = memberEntry{userIDs: userIDs, expiresAt: time.Now().Add(membersTTL)}
+	c.mu.Unlock()
+	return userIDs
+}
+
+// forget clears the cached members of a workspace
+func (c *memberCache) forget(workspaceID int) {
+	c.mu.Lock()
+	delete(c.entries, workspaceID)
+	c.mu.Unlock()
+}
@@ -0,0 +1,46 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"web-crawler/internal/db"
+)
+
+func init() {
+	Register("csv", csvExporter{})
+}
+
+// csvExporter writes a CSV file with a summary section, followed by the
+// pages and the links, separated by empty lines
+type csvExporter struct{}
+
+func (csvExporter) ContentType() string { return "text/csv" }
+
+func (csvExporter) Extension() string { return "csv" }
+
+func (csvExporter) Write(w io.Writer, t *Task) error {
+	cw := csv.NewWriter(w)
+
+	cw.Write([]string{"Field", "Value"})
+	for _, row := range summaryRows(t) {
+		cw.Write([]string{text(row[0]), text(row[1])})
+	}
+
+	cw.Write([]string{})
+	cw.Write(pageColumns)
+	for _, page := range t.Pages {
+		cw.Write(texts(pageRow(page)))
+	}
+
+	cw.Write([]string{})
+	cw.Write(linkColumns)
+	err := t.Links(func(link *db.CrawlLink) error {
+		return cw.Write(texts(linkRow(link)))
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,177 @@
+// Package export writes the results of crawl tasks in several file formats.
+// Exporters register themselves by format name, so a format is added by
+// implementing Exporter and calling Register.
+package export
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"web-crawler/internal/db"
+)
+
+// Task is the data of a crawl task to export. Pages are bounded by the
+// task's page limit and are loaded up front, while links can be numerous and
+// are streamed.
+type Task struct {
+	Task  *db.CrawlTask
+	Pages []*db.CrawlResult
+	// Links calls fn for every link of the task, in the order they were found
+	Links func(fn func(*db.CrawlLink) error) error
+}
+
+// Root returns the result of the start page, or nil when there is none
+func (t *Task) Root() *db.CrawlResult {
+	for _, page := range t.Pages {
+		if page.Depth == 0 {
+			return page
+		}
+	}
+	return nil
+}
+
+// Exporter writes a task in one file format. Write must stream links to w
+// rather than collecting them in memory.
+type Exporter interface {
+	// ContentType is the MIME type of the written file
+	ContentType() string
+	// Extension is the file name extension, without the dot
+	Extension() string
+	Write(w io.Writer, task *Task) error
+}
+
+// registry holds the exporters by format name
+var registry = make(map[string]Exporter)
+
+// Register makes an exporter available under a format name. It is meant to
+// be called from init functions and panics on duplicate names.
+func Register(format string, exporter Exporter) {
+	if _, exists := registry[format]; exists {
+		panic("export: format registered twice: " + format)
+	}
+	registry[format] = exporter
+}
+
+// Get returns the exporter of a format
+func Get(format string) (Exporter, bool) {
+	exporter, ok := registry[format]
+	return exporter, ok
+}
+
+// Formats returns the names of the registered formats
+func Formats() []string {
+	formats := make([]string, 0, len(registry))
+	for format := range registry {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// pageColumns are the column titles of a page row
+var pageColumns = []string{"Page URL", "Depth", "Page Title", "HTML Version", "H1 Count", "H2 Count", "H3 Count",
+	"H4 Count", "H5 Count", "H6 Count", "Internal Links", "External Links", "Inaccessible Links",
+	"Total Links", "Has Login Form", "Response Time (ms)", "Page Size (bytes)"}
+
+// pageRow returns the cells of a page row, numbers as numbers
+func pageRow(page *db.CrawlResult) []interface{} {
+	return []interface{}{
+		derefStr(page.PageURL),
+		page.Depth,
+		derefStr(page.PageTitle),
+		derefStr(page.HTMLVersion),
+		page.H1Count,
+		page.H2Count,
+		page.H3Count,
+		page.H4Count,
+		page.H5Count,
+		page.H6Count,
+		page.InternalLinksCount,
+		page.ExternalLinksCount,
+		page.InaccessibleLinksCount,
+		page.TotalLinksCount,
+		page.HasLoginForm,
+		page.ResponseTimeMs,
+		page.PageSizeBytes,
+	}
+}
+
+// linkColumns are the column titles of a link row
+var linkColumns = []string{"Page URL", "URL", "Type", "Status Code", "Accessible", "Check Status", "Anchor Text", "Response Time (ms)"}
+
+// linkRow returns the cells of a link row. A missing status code is nil.
+func linkRow(link *db.CrawlLink) []interface{} {
+	var statusCode interface{}
+	if link.StatusCode != nil {
+		statusCode = *link.StatusCode
+	}
+	return []interface{}{
+		derefStr(link.PageURL),
+		link.URL,
+		link.LinkType,
+		statusCode,
+		link.IsAccessible,
+		link.CheckStatus,
+		derefStr(link.AnchorText),
+		link.ResponseTimeMs,
+	}
+}
+
+// summaryRows returns the field and value pairs describing a task and its
+// start page
+func summaryRows(t *Task) [][2]interface{} {
+	rows := [][2]interface{}{
+		{"Task ID", t.Task.ID},
+		{"URL", t.Task.URL},
+		{"Crawl Mode", t.Task.CrawlMode},
+		{"Status", t.Task.Status},
+		{"Created At", t.Task.CreatedAt.Format("2006-01-02 15:04:05")},
+		{"Pages Crawled", len(t.Pages)},
+	}
+	if t.Task.CompletedAt != nil {
+		rows = append(rows, [2]interface{}{"Completed At", t.Task.CompletedAt.Format("2006-01-02 15:04:05")})
+	}
+
+	root := t.Root()
+	if root == nil {
+		return rows
+	}
+	// The start page fields, apart from its URL and depth
+	cells := pageRow(root)
+	for i := 2; i < len(pageColumns); i++ {
+		rows = append(rows, [2]interface{}{pageColumns[i], cells[i]})
+	}
+	return rows
+}
+
+// text formats a cell value as text
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+// texts formats a row of cells as text
+func texts(values []interface{}) []string {
+	row := make([]string, len(values))
+	for i, value := range values {
+		row[i] = text(value)
+	}
+	return row
+}
+
+func derefStr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,215 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"web-crawler/internal/db"
+)
+
+// testTask returns a task with a start page, a second page and two links
+func testTask() *Task {
+	str := func(s string) *string { return &s }
+	code := 404
+	pages := []*db.CrawlResult{
+		{Depth: 0, PageTitle: str("Home"), H1Count: 1, H4Count: 4, H5Count: 5, H6Count: 6, HasLoginForm: true},
+		{Depth: 1, PageURL: str("https://example.com/about"), PageTitle: str("About")},
+	}
+	links := []*db.CrawlLink{
+		{URL: "https://example.com/about", LinkType: db.LinkTypeInternal, IsAccessible: true, CheckStatus: db.LinkCheckStatusChecked},
+		{URL: "https://example.com/missing", LinkType: db.LinkTypeInternal, StatusCode: &code, CheckStatus: db.LinkCheckStatusChecked},
+	}
+
+	return &Task{
+		Task:  &db.CrawlTask{ID: 7, URL: "https://example.com", Status: db.TaskStatusCompleted, CreatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		Pages: pages,
+		Links: func(fn func(*db.CrawlLink) error) error {
+			for _, link := range links {
+				if err := fn(link); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// checkPageFields checks the heading counts and login form flag of the start
+// page as decoded from JSON
+func checkPageFields(t *testing.T, page map[string]interface{}) {
+	t.Helper()
+	want := map[string]interface{}{"h4_count": 4.0, "h5_count": 5.0, "h6_count": 6.0, "has_login_form": true}
+	for field, value := range want {
+		if page[field] != value {
+			t.Errorf("%s = %v, want %v", field, page[field], value)
+		}
+	}
+}
+
+// checkPageRow checks the heading counts and login form flag of the start
+// page in a row of text cells under pageColumns
+func checkPageRow(t *testing.T, header, row []string) {
+	t.Helper()
+	if !reflect.DeepEqual(header, pageColumns) {
+		t.Fatalf("page header = %v, want %v", header, pageColumns)
+	}
+	want := map[string]string{"H4 Count": "4", "H5 Count": "5", "H6 Count": "6", "Has Login Form": "true"}
+	for i, column := range header {
+		if value, ok := want[column]; ok && row[i] != value {
+			t.Errorf("%s = %q, want %q", column, row[i], value)
+		}
+	}
+}
+
+// xlsxWorksheet is the part of a worksheet needed to read its cells
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSXSheet returns the cells of worksheet name as text
+func readXLSXSheet(t *testing.T, archive *zip.Reader, name string) [][]string {
+	t.Helper()
+	f, err := archive.Open("xl/worksheets/" + name + ".xml")
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	var sheet xlsxWorksheet
+	if err := xml.NewDecoder(f).Decode(&sheet); err != nil {
+		t.Fatalf("decode %s: %v", name, err)
+	}
+	rows := make([][]string, len(sheet.Rows))
+	for i, row := range sheet.Rows {
+		for _, cell := range row.Cells {
+			value := cell.Value
+			switch cell.Type {
+			case "inlineStr":
+				value = cell.Inline
+			case "b":
+				value = map[string]string{"0": "false", "1": "true"}[cell.Value]
+			}
+			rows[i] = append(rows[i], value)
+		}
+	}
+	return rows
+}
+
+func TestExporters(t *testing.T) {
+	checks := map[string]func(t *testing.T, output []byte){
+		"json": func(t *testing.T, output []byte) {
+			var doc struct {
+				Task    map[string]interface{}   `json:"task"`
+				Summary map[string]interface{}   `json:"summary"`
+				Pages   []map[string]interface{} `json:"pages"`
+				Links   []map[string]interface{} `json:"links"`
+			}
+			if err := json.Unmarshal(output, &doc); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+			if doc.Task["id"] != 7.0 || len(doc.Pages) != 2 || len(doc.Links) != 2 {
+				t.Fatalf("got task %v, %d pages and %d links", doc.Task["id"], len(doc.Pages), len(doc.Links))
+			}
+			checkPageFields(t, doc.Summary)
+			checkPageFields(t, doc.Pages[0])
+			if doc.Links[1]["url"] != "https://example.com/missing" || doc.Links[1]["status_code"] != 404.0 {
+				t.Errorf("second link = %v", doc.Links[1])
+			}
+		},
+		"ndjson": func(t *testing.T, output []byte) {
+			var types []string
+			var pages []map[string]interface{}
+			scanner := bufio.NewScanner(bytes.NewReader(output))
+			for scanner.Scan() {
+				var record struct {
+					Type string                 `json:"type"`
+					Data map[string]interface{} `json:"data"`
+				}
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Fatalf("line %d: %v", len(types)+1, err)
+				}
+				types = append(types, record.Type)
+				if record.Type == "page" {
+					pages = append(pages, record.Data)
+				}
+			}
+			if want := []string{"task", "page", "page", "link", "link"}; !reflect.DeepEqual(types, want) {
+				t.Fatalf("record types = %v, want %v", types, want)
+			}
+			checkPageFields(t, pages[0])
+		},
+		"xlsx": func(t *testing.T, output []byte) {
+			archive, err := zip.NewReader(bytes.NewReader(output), int64(len(output)))
+			if err != nil {
+				t.Fatalf("zip.NewReader: %v", err)
+			}
+			pages := readXLSXSheet(t, archive, "sheet2")
+			if len(pages) != 3 {
+				t.Fatalf("pages sheet has %d rows, want 3", len(pages))
+			}
+			checkPageRow(t, pages[0], pages[1])
+
+			links := readXLSXSheet(t, archive, "sheet3")
+			if len(links) != 3 {
+				t.Fatalf("links sheet has %d rows, want 3", len(links))
+			}
+			if !reflect.DeepEqual(links[0], linkColumns) {
+				t.Errorf("link header = %v, want %v", links[0], linkColumns)
+			}
+			want := []string{"", "https://example.com/missing", db.LinkTypeInternal, "404", "false", db.LinkCheckStatusChecked, "", "0"}
+			if !reflect.DeepEqual(links[2], want) {
+				t.Errorf("second link = %v, want %v", links[2], want)
+			}
+		},
+		"csv": func(t *testing.T, output []byte) {
+			r := csv.NewReader(bytes.NewReader(output))
+			r.FieldsPerRecord = -1
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("csv: %v", err)
+			}
+			for i, record := range records {
+				if len(record) > 0 && record[0] == pageColumns[0] && i+1 < len(records) {
+					checkPageRow(t, record, records[i+1])
+					return
+				}
+			}
+			t.Error("no page header found")
+		},
+		"html": func(t *testing.T, output []byte) {
+			for _, want := range []string{"H4 Count", "H5 Count", "H6 Count", "Has Login Form", "https://example.com/missing"} {
+				if !strings.Contains(string(output), want) {
+					t.Errorf("output does not contain %q", want)
+				}
+			}
+		},
+	}
+
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			check, ok := checks[format]
+			if !ok {
+				t.Fatalf("no check for format %q", format)
+			}
+			exporter, _ := Get(format)
+			var buf bytes.Buffer
+			if err := exporter.Write(&buf, testTask()); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			check(t, buf.Bytes())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"web-crawler/internal/db"
+)
+
+func init() {
+	Register("html", htmlExporter{})
+}
+
+// htmlExporter writes a standalone HTML report with the summary, pages and
+// links of a task. Styles are inlined so the file can be opened anywhere.
+type htmlExporter struct{}
+
+func (htmlExporter) ContentType() string { return "text/html; charset=utf-8" }
+
+func (htmlExporter) Extension() string { return "html" }
+
+func (htmlExporter) Write(w io.Writer, t *Task) error {
+	bw := bufio.NewWriter(w)
+	title := "Crawl report: " + t.Task.URL
+
+	bw.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>")
+	bw.WriteString(html.EscapeString(title))
+	bw.WriteString("</title>\n<style>" + htmlReportStyle + "</style>\n</head>\n<body>\n<h1>")
+	bw.WriteString(html.EscapeString(title))
+	bw.WriteString("</h1>\n")
+
+	bw.WriteString("<h2>Summary</h2>\n<table>\n")
+	for _, row := range summaryRows(t) {
+		bw.WriteString("<tr><th>" + html.EscapeString(text(row[0])) + "</th><td>" + html.EscapeString(text(row[1])) + "</td></tr>\n")
+	}
+	bw.WriteString("</table>\n")
+
+	bw.WriteString("<h2>Pages</h2>\n<table>\n")
+	writeHTMLHeader(bw, pageColumns)
+	for _, page := range t.Pages {
+		writeHTMLRow(bw, pageRow(page), "")
+	}
+	bw.WriteString("</table>\n")
+
+	bw.WriteString("<h2>Links</h2>\n<table>\n")
+	writeHTMLHeader(bw, linkColumns)
+	err := t.Links(func(link *db.CrawlLink) error {
+		class := ""
+		if !link.IsAccessible {
+			class = "broken"
+		}
+		writeHTMLRow(bw, linkRow(link), class)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString("</table>\n</body>\n</html>\n")
+
+	return bw.Flush()
+}
+
+// writeHTMLHeader writes a table header row
+func writeHTMLHeader(bw *bufio.Writer, columns []string) {
+	bw.WriteString("<tr>")
+	for _, column := range columns {
+		bw.WriteString("<th>" + html.EscapeString(column) + "</th>")
+	}
+	bw.WriteString("</tr>\n")
+}
+
+// writeHTMLRow writes a table row with an optional class
+func writeHTMLRow(bw *bufio.Writer, cells []interface{}, class string) {
+	if class != "" {
+		bw.WriteString(`<tr class="` + class + `">`)
+	} else {
+		bw.WriteString("<tr>")
+	}
+	for _, cell := range cells {
+		bw.WriteString("<td>" + html.EscapeString(text(cell)) + "</td>")
+	}
+	bw.WriteString("</tr>\n")
+}
+
+// htmlReportStyle is the stylesheet of the HTML report
+const htmlReportStyle = `
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 2rem; color: #1f2937; }
+h1 { font-size: 1.5rem; word-break: break-all; }
+h2 { font-size: 1.2rem; margin-top: 2rem; }
+table { border-collapse: collapse; width: 100%; font-size: 0.875rem; }
+th, td { border: 1px solid #e5e7eb; padding: 0.35rem 0.6rem; text-align: left; vertical-align: top; word-break: break-all; }
+th { background: #f3f4f6; }
+tr.broken td { background: #fef2f2; color: #b91c1c; }
+`
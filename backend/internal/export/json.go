@@ -0,0 +1,97 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"web-crawler/internal/db"
+)
+
+func init() {
+	Register("json", jsonExporter{})
+	Register("ndjson", ndjsonExporter{})
+}
+
+// jsonExporter writes a single JSON document with the task, its pages and
+// its links. The links array is written one link at a time.
+type jsonExporter struct{}
+
+func (jsonExporter) ContentType() string { return "application/json" }
+
+func (jsonExporter) Extension() string { return "json" }
+
+func (jsonExporter) Write(w io.Writer, t *Task) error {
+	pages := t.Pages
+	if pages == nil {
+		pages = []*db.CrawlResult{}
+	}
+
+	head, err := json.Marshal(struct {
+		Task    *db.CrawlTask     `json:"task"`
+		Summary *db.CrawlResult   `json:"summary"`
+		Pages   []*db.CrawlResult `json:"pages"`
+	}{t.Task, t.Root(), pages})
+	if err != nil {
+		return err
+	}
+
+	// Reopen the object to append the links array
+	head[len(head)-1] = ','
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `"links":[`); err != nil {
+		return err
+	}
+
+	first := true
+	err = t.Links(func(link *db.CrawlLink) error {
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// ndjsonRecord is one line of an NDJSON export
+type ndjsonRecord struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// ndjsonExporter writes one JSON object per line: the task, then every page
+// and every link, each tagged with its type
+type ndjsonExporter struct{}
+
+func (ndjsonExporter) ContentType() string { return "application/x-ndjson" }
+
+func (ndjsonExporter) Extension() string { return "ndjson" }
+
+func (ndjsonExporter) Write(w io.Writer, t *Task) error {
+	enc := json.NewEncoder(w)
+
+	if err := enc.Encode(ndjsonRecord{Type: "task", Data: t.Task}); err != nil {
+		return err
+	}
+	for _, page := range t.Pages {
+		if err := enc.Encode(ndjsonRecord{Type: "page", Data: page}); err != nil {
+			return err
+		}
+	}
+	return t.Links(func(link *db.CrawlLink) error {
+		return enc.Encode(ndjsonRecord{Type: "link", Data: link})
+	})
+}
@@ -0,0 +1,190 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"web-crawler/internal/db"
+)
+
+func init() {
+	Register("xlsx", xlsxExporter{})
+}
+
+// xlsxMaxRows is the number of rows an Excel worksheet can hold
+const xlsxMaxRows = 1048576
+
+// xlsxExporter writes an Excel workbook with Summary, Pages and Links
+// sheets. Strings are stored inline rather than in a shared strings table,
+// so each row is written as soon as it is read.
+type xlsxExporter struct{}
+
+func (xlsxExporter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (xlsxExporter) Extension() string { return "xlsx" }
+
+func (xlsxExporter) Write(w io.Writer, t *Task) error {
+	archive := zip.NewWriter(w)
+
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	// Summary
+	sheet, err := newXLSXSheet(archive, 1)
+	if err != nil {
+		return err
+	}
+	sheet.row([]interface{}{"Field", "Value"})
+	for _, row := range summaryRows(t) {
+		sheet.row([]interface{}{row[0], row[1]})
+	}
+	if err := sheet.close(); err != nil {
+		return err
+	}
+
+	// Pages
+	if sheet, err = newXLSXSheet(archive, 2); err != nil {
+		return err
+	}
+	sheet.row(stringCells(pageColumns))
+	for _, page := range t.Pages {
+		sheet.row(pageRow(page))
+	}
+	if err := sheet.close(); err != nil {
+		return err
+	}
+
+	// Links
+	if sheet, err = newXLSXSheet(archive, 3); err != nil {
+		return err
+	}
+	sheet.row(stringCells(linkColumns))
+	err = t.Links(func(link *db.CrawlLink) error {
+		// Links beyond the sheet's capacity are left out
+		if sheet.rows >= xlsxMaxRows {
+			return nil
+		}
+		sheet.row(linkRow(link))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := sheet.close(); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// xlsxSheet writes the rows of one worksheet
+type xlsxSheet struct {
+	w    *bufio.Writer
+	rows int
+}
+
+// newXLSXSheet starts worksheet number n of the archive
+func newXLSXSheet(archive *zip.Writer, n int) (*xlsxSheet, error) {
+	f, err := archive.Create("xl/worksheets/sheet" + strconv.Itoa(n) + ".xml")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &xlsxSheet{w: bufio.NewWriter(f)}
+	s.w.WriteString(xml.Header)
+	s.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return s, nil
+}
+
+// row writes a row of cells. Write errors surface when the sheet is flushed.
+func (s *xlsxSheet) row(cells []interface{}) {
+	s.rows++
+	s.w.WriteString("<row>")
+	for _, cell := range cells {
+		switch v := cell.(type) {
+		case nil:
+			s.w.WriteString("<c/>")
+		case int:
+			s.w.WriteString(`<c><v>` + strconv.Itoa(v) + `</v></c>`)
+		case bool:
+			value := "0"
+			if v {
+				value = "1"
+			}
+			s.w.WriteString(`<c t="b"><v>` + value + `</v></c>`)
+		default:
+			s.w.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(s.w, []byte(text(v)))
+			s.w.WriteString(`</t></is></c>`)
+		}
+	}
+	s.w.WriteString("</row>")
+}
+
+// close ends the worksheet
+func (s *xlsxSheet) close() error {
+	s.w.WriteString(`</sheetData></worksheet>`)
+	return s.w.Flush()
+}
+
+// stringCells converts column titles to cells
+func stringCells(values []string) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = value
+	}
+	return cells
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet3.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+	`<sheet name="Summary" sheetId="1" r:id="rId1"/>` +
+	`<sheet name="Pages" sheetId="2" r:id="rId2"/>` +
+	`<sheet name="Links" sheetId="3" r:id="rId3"/>` +
+	`</sheets></workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>` +
+	`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet3.xml"/>` +
+	`<Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/></cellXfs>` +
+	`</styleSheet>`
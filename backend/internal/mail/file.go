@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each email to a .eml file in a directory instead of
+// sending it, for local development
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+// NewFileMailer creates a mailer that writes emails to dir, creating it when
+// needed
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Send writes a message to a file named after the time it was sent
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%s-%d.eml", now.Format("20060102-150405.000"), m.seq.Add(1))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg, now), 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote email %q to %s", msg.Subject, path)
+	return nil
+}
+
+// LogMailer logs each email instead of sending it, for local development.
+// Links in the body, such as password reset links, appear in the log.
+type LogMailer struct{}
+
+// NewLogMailer creates a mailer that logs emails
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs a message
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
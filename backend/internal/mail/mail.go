@@ -0,0 +1,86 @@
+// Package mail sends the emails of the account flows, such as password
+// resets and email verification. The driver is chosen by configuration:
+// SMTP in production, or writing messages to files or the log in local
+// development.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"time"
+	"web-crawler/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewMailer creates the mailer selected by the MAIL_DRIVER setting: "smtp",
+// "file" or "log"
+func NewMailer() (Mailer, error) {
+	cfg := config.Load()
+
+	switch cfg.Mail.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From), nil
+	case "file":
+		return NewFileMailer(cfg.Mail.Dir, cfg.Mail.From), nil
+	case "log":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Mail.Driver)
+	}
+}
+
+// format renders a message in Internet Message Format
+func format(from string, msg *Message, now time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(normalizeNewlines(msg.Body))
+	return buf.Bytes()
+}
+
+// normalizeNewlines converts the line endings of body to CRLF
+func normalizeNewlines(body string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\r' && i+1 < len(body) && body[i+1] == '\n':
+			buf.WriteString("\r\n")
+			i++
+		case body[i] == '\n' || body[i] == '\r':
+			buf.WriteString("\r\n")
+		default:
+			buf.WriteByte(body[i])
+		}
+	}
+	return buf.String()
+}
+
+// address returns the bare address of a possibly named address such as
+// "Web Crawler <no-reply@example.com>"
+func address(addr string) (string, error) {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
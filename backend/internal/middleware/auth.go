@@ -1,16 +1,28 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 	"web-crawler/internal/auth"
+	"web-crawler/internal/db"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates JWT tokens and sets user context
-func AuthMiddleware() gin.HandlerFunc {
-	jwtService := auth.NewJWTService()
+// tokenScopesKey is the context key of the scopes granted by a personal
+// access token. It is not set for requests authenticated with a JWT, which
+// may do anything their user can.
+const tokenScopesKey = "token_scopes"
+
+// roleKey is the context key of the role of the authenticated user
+const roleKey = "role"
+
+// AuthMiddleware validates JWTs and personal access tokens and sets user context
+func AuthMiddleware(sessionRepo *db.SessionRepository, tokenRepo *db.APITokenRepository) gin.HandlerFunc {
+	jwtService := auth.NewJWTService(sessionRepo)
 
 	return func(c *gin.Context) {
 		// Get token from Authorization header
@@ -35,8 +47,38 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := tokenParts[1]
 
+		if auth.IsAPIToken(tokenString) {
+			token, err := tokenRepo.GetByHash(c.Request.Context(), auth.HashToken(tokenString))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to validate token",
+				})
+				c.Abort()
+				return
+			}
+			now := time.Now()
+			if token == nil || !token.Active(now) {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid, expired or revoked token",
+				})
+				c.Abort()
+				return
+			}
+
+			if err := tokenRepo.TouchLastUsed(c.Request.Context(), token.ID, now, c.ClientIP()); err != nil {
+				log.Printf("Failed to record use of API token %d: %v", token.ID, err)
+			}
+
+			c.Set("user_id", token.UserID)
+			c.Set("username", token.Username)
+			c.Set(roleKey, token.UserRole)
+			c.Set(tokenScopesKey, token.Scopes)
+			c.Next()
+			return
+		}
+
 		// Validate token
-		claims, err := jwtService.ValidateToken(tokenString)
+		claims, err := jwtService.ValidateToken(c.Request.Context(), tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid or expired token",
@@ -48,6 +90,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
+		// Tokens issued before roles existed belong to members
+		role := claims.Role
+		if role == "" {
+			role = db.RoleMember
+		}
+		c.Set(roleKey, role)
 
 		// Continue to next handler
 		c.Next()
@@ -55,8 +104,8 @@ func AuthMiddleware() gin.HandlerFunc {
 }
 
 // OptionalAuthMiddleware validates JWT tokens but doesn't require them
-func OptionalAuthMiddleware() gin.HandlerFunc {
-	jwtService := auth.NewJWTService()
+func OptionalAuthMiddleware(sessionRepo *db.SessionRepository) gin.HandlerFunc {
+	jwtService := auth.NewJWTService(sessionRepo)
 
 	return func(c *gin.Context) {
 		// Get token from Authorization header
@@ -76,14 +125,87 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		tokenString := tokenParts[1]
 
 		// Validate token (ignore errors for optional auth)
-		claims, err := jwtService.ValidateToken(tokenString)
+		claims, err := jwtService.ValidateToken(c.Request.Context(), tokenString)
 		if err == nil {
 			// Set user information in context if token is valid
 			c.Set("user_id", claims.UserID)
 			c.Set("username", claims.Username)
+			c.Set(roleKey, claims.Role)
 		}
 
 		// Continue to next handler regardless of token validity
 		c.Next()
 	}
 }
+
+// Role returns the role of the authenticated user
+func Role(c *gin.Context) string {
+	return c.GetString(roleKey)
+}
+
+// HasScope reports whether the request may use scope. The role of the user
+// must grant the scope, and so must the personal access token if one was
+// used; requests authenticated with a JWT have every scope of their role.
+func HasScope(c *gin.Context, scope string) bool {
+	if !slices.Contains(db.RoleScopes(Role(c)), scope) {
+		return false
+	}
+	scopes, ok := c.Get(tokenScopesKey)
+	if !ok {
+		return true
+	}
+	return slices.Contains(scopes.([]string), scope)
+}
+
+// IsAdmin reports whether the request is made by an admin with the admin scope
+func IsAdmin(c *gin.Context) bool {
+	return HasScope(c, db.ScopeAdmin)
+}
+
+// RequireRole rejects requests from users without one of the given roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, Role(c)) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your role does not allow this action",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests whose role, or personal access token, does
+// not grant scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			message := "Token lacks the required scope: " + scope
+			if !slices.Contains(db.RoleScopes(Role(c)), scope) {
+				message = "Your role does not allow this action"
+			}
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": message,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests made with a personal access token, for
+// endpoints that manage the account itself
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(tokenScopesKey); ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint requires logging in, API tokens cannot be used",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,60 +1,183 @@
 package queue
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"sync"
+	"time"
+	"web-crawler/config"
 	"web-crawler/internal/crawler"
 	"web-crawler/internal/db"
-	"web-crawler/internal/websocket"
+	"web-crawler/internal/events"
+	"web-crawler/internal/webhook"
 )
 
-// TaskQueue manages crawling tasks
+// Lower bounds of the configured queue timings, which drive tickers
+const (
+	minPollInterval  = time.Second
+	minLeaseDuration = 3 * time.Second
+)
+
+// ErrQuotaExceeded is returned when a user has too many tasks waiting to run
+var ErrQuotaExceeded = errors.New("too many queued tasks")
+
+// TaskQueue runs crawl tasks stored in the database on a fixed pool of
+// workers. Tasks are claimed with a lease that is renewed while they run, so
+// tasks abandoned by a crashed or restarted server are picked up again once
+// their lease expires. Workers are shared fairly between users, each of whom
+// can run at most maxConcurrentPerUser tasks at once.
 type TaskQueue struct {
-	mu        sync.RWMutex
-	tasks     map[int]*db.CrawlTask
-	stopChan  map[int]chan bool
-	processor *crawler.Processor
+	mu          sync.RWMutex
+	tasks       map[int]*db.CrawlTask
+	cancels     map[int]context.CancelCauseFunc
+	taskRepo    *db.TaskRepository
+	processor   *crawler.Processor
+	hooks       *webhook.Dispatcher
+	taskTimeout time.Duration
+
+	owner                string
+	workers              int
+	maxConcurrentPerUser int
+	maxQueuedPerUser     int
+	leaseDuration        time.Duration
+	pollInterval         time.Duration
+	maxAttempts          int
+	restoreWindow        time.Duration
+	wake                 chan struct{}
+
+	// ctx is the parent of every task context and is cancelled on shutdown
+	ctx      context.Context
+	shutdown context.CancelCauseFunc
+	wg       sync.WaitGroup
 }
 
 // NewTaskQueue creates a new task queue
-func NewTaskQueue(taskRepo *db.TaskRepository, resultRepo *db.ResultRepository, linkRepo *db.LinkRepository, wsHub *websocket.Hub) *TaskQueue {
+func NewTaskQueue(taskRepo *db.TaskRepository, resultRepo *db.ResultRepository, linkRepo *db.LinkRepository, bus *events.Bus, hooks *webhook.Dispatcher) *TaskQueue {
+	cfg := config.Load()
+	ctx, shutdown := context.WithCancelCause(context.Background())
+	workers := cfg.Queue.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	leaseDuration := cfg.Queue.LeaseDuration
+	if leaseDuration < minLeaseDuration {
+		leaseDuration = minLeaseDuration
+	}
+	pollInterval := cfg.Queue.PollInterval
+	if pollInterval < minPollInterval {
+		pollInterval = minPollInterval
+	}
+
 	return &TaskQueue{
-		tasks:     make(map[int]*db.CrawlTask),
-		stopChan:  make(map[int]chan bool),
-		processor: crawler.NewProcessor(taskRepo, resultRepo, linkRepo, wsHub),
+		tasks:                make(map[int]*db.CrawlTask),
+		cancels:              make(map[int]context.CancelCauseFunc),
+		taskRepo:             taskRepo,
+		processor:            crawler.NewProcessor(taskRepo, resultRepo, linkRepo, bus, hooks),
+		hooks:                hooks,
+		taskTimeout:          cfg.Crawler.TaskTimeout,
+		owner:                newOwnerID(),
+		workers:              workers,
+		maxConcurrentPerUser: cfg.Queue.MaxConcurrentPerUser,
+		maxQueuedPerUser:     cfg.Queue.MaxQueuedPerUser,
+		leaseDuration:        leaseDuration,
+		pollInterval:         pollInterval,
+		maxAttempts:          cfg.Queue.MaxAttempts,
+		restoreWindow:        cfg.Tasks.RestoreWindow,
+		wake:                 make(chan struct{}, workers),
+		ctx:                  ctx,
+		shutdown:             shutdown,
 	}
 }
 
-// AddTask adds a new task to the queue
-func (tq *TaskQueue) AddTask(task *db.CrawlTask) {
-	tq.mu.Lock()
-	defer tq.mu.Unlock()
+// newOwnerID identifies this server process as a lease owner
+func newOwnerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// Start launches the workers, which begin claiming tasks from the database
+// including pending tasks left over from before a restart, and the purger of
+// deleted tasks
+func (tq *TaskQueue) Start() {
+	for i := 0; i < tq.workers; i++ {
+		tq.wg.Add(1)
+		go tq.worker()
+	}
+	tq.wg.Add(1)
+	go tq.purger()
+	log.Printf("Task queue started as %s with %d workers", tq.owner, tq.workers)
+}
 
-	tq.tasks[task.ID] = task
-	tq.stopChan[task.ID] = make(chan bool, 1)
+// Enqueue stores a new pending task and wakes a worker to run it. It returns
+// ErrQuotaExceeded, storing nothing, when the user who starts the task already
+// has the maximum number of tasks waiting to run.
+func (tq *TaskQueue) Enqueue(ctx context.Context, task *db.CrawlTask) error {
+	created, err := tq.taskRepo.CreateWithinQuota(ctx, task, tq.maxQueuedPerUser)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("%w: limit is %d", ErrQuotaExceeded, tq.maxQueuedPerUser)
+	}
 
+	tq.AddTask(task)
+	return nil
+}
+
+// AddTask notifies the queue that a new pending task was stored
+func (tq *TaskQueue) AddTask(task *db.CrawlTask) {
 	log.Printf("Task %d added to queue for URL: %s", task.ID, task.URL)
 
-	// Start processing the task in a goroutine
-	go tq.processTask(task)
+	select {
+	case tq.wake <- struct{}{}:
+	default:
+	}
 }
 
-// StopTask stops a running task
+// StopTask stops a task running on this server, aborting its in-flight
+// requests. Tasks running elsewhere notice the stop when renewing their lease.
 func (tq *TaskQueue) StopTask(taskID int) {
-	tq.mu.Lock()
-	defer tq.mu.Unlock()
+	tq.mu.RLock()
+	defer tq.mu.RUnlock()
 
-	if stopCh, exists := tq.stopChan[taskID]; exists {
-		select {
-		case stopCh <- true:
-			log.Printf("Stop signal sent to task %d", taskID)
-		default:
-			log.Printf("Task %d already has stop signal", taskID)
-		}
+	if cancel, exists := tq.cancels[taskID]; exists {
+		cancel(crawler.ErrTaskStopped)
+		log.Printf("Stop signal sent to task %d", taskID)
 	}
 }
 
-// GetTask retrieves a task by ID
+// CancelTask marks a pending or running task as cancelled, stops it if it
+// runs on this server and reports it as stopped, wherever it was running. It
+// reports false when the task had already finished.
+func (tq *TaskQueue) CancelTask(ctx context.Context, taskID int) (bool, error) {
+	cancelled, err := tq.taskRepo.Cancel(ctx, taskID)
+	if err != nil || !cancelled {
+		return false, err
+	}
+	tq.StopTask(taskID)
+
+	task, err := tq.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		log.Printf("Failed to load stopped task %d: %v", taskID, err)
+		return true, nil
+	}
+	if task != nil {
+		tq.processor.NotifyStopped(ctx, task)
+	}
+	return true, nil
+}
+
+// GetTask retrieves a task running on this server by ID
 func (tq *TaskQueue) GetTask(taskID int) *db.CrawlTask {
 	tq.mu.RLock()
 	defer tq.mu.RUnlock()
@@ -62,24 +185,214 @@ func (tq *TaskQueue) GetTask(taskID int) *db.CrawlTask {
 	return tq.tasks[taskID]
 }
 
-// processTask processes a single crawl task using the crawler processor
+// Shutdown stops claiming tasks, cancels every running task so it is put
+// back in the queue, and waits for them to finish, or until ctx is done
+func (tq *TaskQueue) Shutdown(ctx context.Context) error {
+	tq.mu.Lock()
+	tq.shutdown(crawler.ErrShuttingDown)
+	tq.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tq.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// worker claims and runs tasks one at a time. When nothing can be claimed
+// it sleeps until a task is added or the poll interval passes.
+func (tq *TaskQueue) worker() {
+	defer tq.wg.Done()
+
+	ticker := time.NewTicker(tq.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for tq.ctx.Err() == nil {
+			task, err := tq.taskRepo.ClaimNext(tq.ctx, tq.owner, tq.leaseDuration, tq.maxConcurrentPerUser)
+			if err != nil {
+				if tq.ctx.Err() == nil {
+					log.Printf("Failed to claim task: %v", err)
+				}
+				break
+			}
+			if task == nil {
+				break
+			}
+
+			if tq.maxAttempts > 0 && task.Attempts > tq.maxAttempts {
+				tq.giveUp(task)
+				continue
+			}
+
+			tq.processTask(task)
+		}
+
+		select {
+		case <-tq.wake:
+		case <-ticker.C:
+		case <-tq.ctx.Done():
+			return
+		}
+	}
+}
+
+// giveUp fails a task that keeps getting interrupted
+func (tq *TaskQueue) giveUp(task *db.CrawlTask) {
+	log.Printf("Task %d exceeded %d attempts, marking as failed", task.ID, tq.maxAttempts)
+
+	errorMsg := fmt.Sprintf("Crawl was interrupted %d times", tq.maxAttempts)
+	finished, err := tq.taskRepo.FinishRun(tq.ctx, task.ID, tq.owner, db.TaskStatusFailed, &errorMsg)
+	if err != nil {
+		log.Printf("Failed to update task status: %v", err)
+	}
+	if finished {
+		data := webhook.NewTaskEvent(task, db.TaskStatusFailed)
+		data.Error = errorMsg
+		tq.hooks.Notify(tq.ctx, task, webhook.EventTaskFailed, data)
+	}
+	if err := tq.taskRepo.ReleaseLease(tq.ctx, task.ID, tq.owner); err != nil {
+		log.Printf("Failed to release lease of task %d: %v", task.ID, err)
+	}
+}
+
+// processTask processes a single claimed task using the crawler processor
+// while keeping its lease alive
 func (tq *TaskQueue) processTask(task *db.CrawlTask) {
 	taskID := task.ID
-	stopCh := tq.stopChan[taskID]
+
+	ctx, cancelTask := context.WithCancelCause(tq.ctx)
+	tq.mu.Lock()
+	tq.tasks[taskID] = task
+	tq.cancels[taskID] = cancelTask
+	tq.mu.Unlock()
+
+	if tq.taskTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tq.taskTimeout)
+		defer cancel()
+	}
 
 	defer func() {
+		cancelTask(nil)
 		tq.mu.Lock()
 		delete(tq.tasks, taskID)
-		delete(tq.stopChan, taskID)
+		delete(tq.cancels, taskID)
 		tq.mu.Unlock()
+
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tq.taskRepo.ReleaseLease(releaseCtx, taskID, tq.owner); err != nil {
+			log.Printf("Failed to release lease of task %d: %v", taskID, err)
+		}
 	}()
 
-	log.Printf("Starting to process task %d with crawler", taskID)
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go tq.heartbeat(ctx, taskID, heartbeatDone)
+
+	log.Printf("Starting to process task %d with crawler (attempt %d)", taskID, task.Attempts)
 
 	// Use the crawler processor to handle the task
-	if err := tq.processor.ProcessTask(task, stopCh); err != nil {
+	if err := tq.processor.ProcessTask(ctx, task, tq.owner); err != nil {
 		log.Printf("Failed to process task %d: %v", taskID, err)
 	} else {
 		log.Printf("Task %d processed successfully", taskID)
 	}
 }
+
+// heartbeat renews the lease of a running task. When the lease is lost the
+// task is cancelled, since it was stopped or taken over by another worker.
+// It is also cancelled when renewals keep failing until the lease is about to
+// expire, so that it never runs alongside a worker that reclaimed it.
+func (tq *TaskQueue) heartbeat(ctx context.Context, taskID int, done <-chan struct{}) {
+	interval := tq.leaseDuration / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	loseLease := func() {
+		tq.mu.RLock()
+		if cancel, exists := tq.cancels[taskID]; exists {
+			cancel(crawler.ErrLeaseLost)
+		}
+		tq.mu.RUnlock()
+	}
+
+	lastRenewed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			ok, err := tq.taskRepo.RenewLease(ctx, taskID, tq.owner, tq.leaseDuration)
+			if err != nil {
+				log.Printf("Failed to renew lease of task %d: %v", taskID, err)
+				// Give up one interval before the lease expires
+				if time.Since(lastRenewed) >= tq.leaseDuration-interval {
+					log.Printf("Lease of task %d is about to expire, stopping it", taskID)
+					loseLease()
+					return
+				}
+				continue
+			}
+			if !ok {
+				loseLease()
+				return
+			}
+			lastRenewed = time.Now()
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purgeBatchSize limits how many deleted tasks are removed per query
+const purgeBatchSize = 100
+
+// purger permanently removes deleted tasks once their restore window passed
+func (tq *TaskQueue) purger() {
+	defer tq.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		tq.purgeDeleted()
+
+		select {
+		case <-ticker.C:
+		case <-tq.ctx.Done():
+			return
+		}
+	}
+}
+
+// purgeDeleted removes every task whose restore window has passed
+func (tq *TaskQueue) purgeDeleted() {
+	cutoff := time.Now().Add(-tq.restoreWindow)
+	total := 0
+	for tq.ctx.Err() == nil {
+		purged, err := tq.taskRepo.PurgeDeleted(tq.ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			if tq.ctx.Err() == nil {
+				log.Printf("Failed to purge deleted tasks: %v", err)
+			}
+			break
+		}
+		total += purged
+		if purged < purgeBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("Purged %d deleted tasks", total)
+	}
+}
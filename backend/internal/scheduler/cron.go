@@ -0,0 +1,311 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Embed the time zone database so schedules work on hosts without one
+	_ "time/tzdata"
+)
+
+// MinInterval is the shortest interval a schedule may repeat at
+const MinInterval = 5 * time.Minute
+
+// Spec computes when a schedule runs
+type Spec interface {
+	// Next returns the first run strictly after t, or the zero time if
+	// there is none
+	Next(t time.Time) time.Time
+}
+
+// ParseSpec builds the Spec of a schedule from either a cron expression or an
+// interval, evaluated in the named time zone
+func ParseSpec(cronExpr string, interval time.Duration, timezone string) (Spec, error) {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cronExpr != "" && interval > 0:
+		return nil, errors.New("set either a cron expression or an interval, not both")
+	case cronExpr != "":
+		cron, err := ParseCron(cronExpr, loc)
+		if err != nil {
+			return nil, err
+		}
+		if cron.minGap() < MinInterval {
+			return nil, fmt.Errorf("cron expression must not run more often than every %s", MinInterval)
+		}
+		return cron, nil
+	case interval > 0:
+		if interval < MinInterval {
+			return nil, fmt.Errorf("interval must be at least %s", MinInterval)
+		}
+		return intervalSpec(interval), nil
+	default:
+		return nil, errors.New("a cron expression or an interval is required")
+	}
+}
+
+// LoadLocation loads a time zone by IANA name, defaulting to UTC
+func LoadLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", timezone)
+	}
+	return loc, nil
+}
+
+// intervalSpec runs every interval after the previous run
+type intervalSpec time.Duration
+
+// Next returns t plus the interval
+func (s intervalSpec) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s)).Truncate(time.Second)
+}
+
+// cronMacros are the shorthands accepted in place of the five fields
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the range and names of one field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Both 0 and 7 are Sunday
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Cron is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week. Fields accept "*", numbers, ranges ("1-5"), steps
+// ("*/15", "10-50/10"), lists ("1,15") and month or weekday names.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set when the field is "*". As in standard cron,
+	// a day matches either day field when both are restricted.
+	domAny, dowAny bool
+	loc            *time.Location
+}
+
+// ParseCron parses a cron expression or one of the @yearly, @monthly,
+// @weekly, @daily and @hourly macros, evaluated in loc
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	c := &Cron{loc: loc}
+	var err error
+	if c.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+
+	return c, nil
+}
+
+// minGap returns the shortest time between two consecutive runs. Only the
+// minute and hour fields are considered, as if every day matched, so the
+// result never overstates how often the expression can run.
+func (c *Cron) minGap() time.Duration {
+	var minutes []int
+	for m := minuteField.min; m <= minuteField.max; m++ {
+		if c.minute&(1<<uint(m)) != 0 {
+			minutes = append(minutes, m)
+		}
+	}
+
+	gap := 24 * 60
+	for i := 1; i < len(minutes); i++ {
+		if d := minutes[i] - minutes[i-1]; d < gap {
+			gap = d
+		}
+	}
+
+	// The last run of an hour is followed by the first of the next hour,
+	// which may be on the next day
+	for h := hourField.min; h <= hourField.max; h++ {
+		next := (h + 1) % 24
+		if c.hour&(1<<uint(h)) != 0 && c.hour&(1<<uint(next)) != 0 {
+			if d := 60 - minutes[len(minutes)-1] + minutes[0]; d < gap {
+				gap = d
+			}
+			break
+		}
+	}
+
+	return time.Duration(gap) * time.Minute
+}
+
+// parseCronField parses one field into a bit set of the values it matches
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, field.name)
+			}
+			step = n
+		}
+
+		var start, end int
+		switch {
+		case rangePart == "*":
+			start, end = field.min, field.max
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = field.value(from); err != nil {
+				return 0, err
+			}
+			if end, err = field.value(to); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, field.name)
+			}
+		default:
+			var err error
+			if start, err = field.value(rangePart); err != nil {
+				return 0, err
+			}
+			end = start
+			// "5/15" means every 15 starting at 5
+			if hasStep {
+				end = field.max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single number or name of the field
+func (f cronField) value(s string) (int, error) {
+	if n, ok := f.names[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field, expected %d-%d", s, f.name, f.min, f.max)
+	}
+	return n, nil
+}
+
+// cronSearchLimit bounds the search for the next run of expressions that
+// rarely or never match, such as February 30
+const cronSearchLimit = 5
+
+// Next returns the first time after t that matches the expression. Times
+// that do not exist because clocks move forward are skipped, and times that
+// repeat because clocks move back only match once.
+func (c *Cron) Next(t time.Time) time.Time {
+	after := wallClock(t.In(c.loc))
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			// Add rather than rebuild the time so repeated hours at the end
+			// of daylight saving time still move forward
+			t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 || !wallClock(t).After(after) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// wallClock returns the local date and time of t as if it were UTC, so that
+// times are compared the way they read on a clock
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// dayMatches reports whether the day of t matches the day fields
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
@@ -0,0 +1,300 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q): %v", name, err)
+	}
+	return loc
+}
+
+func TestCronNext(t *testing.T) {
+	utc := time.UTC
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "every minute is strictly after",
+			expr: "* * * * *",
+			from: time.Date(2024, 5, 1, 10, 7, 0, 0, utc),
+			want: time.Date(2024, 5, 1, 10, 8, 0, 0, utc),
+		},
+		{
+			name: "seconds are dropped",
+			expr: "* * * * *",
+			from: time.Date(2024, 5, 1, 10, 7, 59, 0, utc),
+			want: time.Date(2024, 5, 1, 10, 8, 0, 0, utc),
+		},
+		{
+			name: "step",
+			expr: "*/15 * * * *",
+			from: time.Date(2024, 5, 1, 10, 7, 0, 0, utc),
+			want: time.Date(2024, 5, 1, 10, 15, 0, 0, utc),
+		},
+		{
+			name: "step wraps to the next hour",
+			expr: "*/15 * * * *",
+			from: time.Date(2024, 5, 1, 10, 45, 0, 0, utc),
+			want: time.Date(2024, 5, 1, 11, 0, 0, 0, utc),
+		},
+		{
+			name: "step from a start value",
+			expr: "5/20 * * * *",
+			from: time.Date(2024, 5, 1, 10, 26, 0, 0, utc),
+			want: time.Date(2024, 5, 1, 10, 45, 0, 0, utc),
+		},
+		{
+			name: "step over a range",
+			expr: "0 9-17/4 * * *",
+			from: time.Date(2024, 5, 1, 13, 0, 0, 0, utc),
+			want: time.Date(2024, 5, 1, 17, 0, 0, 0, utc),
+		},
+		{
+			name: "list",
+			expr: "0 8,20 * * *",
+			from: time.Date(2024, 5, 1, 8, 0, 0, 0, utc),
+			want: time.Date(2024, 5, 1, 20, 0, 0, 0, utc),
+		},
+		{
+			name: "month and weekday names",
+			expr: "0 9 * feb mon-fri",
+			from: time.Date(2024, 1, 15, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 2, 1, 9, 0, 0, 0, utc),
+		},
+		{
+			name: "names are case insensitive",
+			expr: "0 9 * * SAT",
+			from: time.Date(2024, 5, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 5, 4, 9, 0, 0, 0, utc),
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			from: time.Date(2024, 5, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 5, 5, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "day of month only",
+			expr: "0 0 13 * *",
+			from: time.Date(2024, 9, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 9, 13, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "day of week only",
+			expr: "0 0 * * fri",
+			from: time.Date(2024, 9, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 9, 6, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "both day fields match either day",
+			expr: "0 0 13 * fri",
+			from: time.Date(2024, 9, 7, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 9, 13, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "both day fields match the weekday first",
+			expr: "0 0 20 * mon",
+			from: time.Date(2024, 9, 14, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 9, 16, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "both day fields match the day of month first",
+			expr: "0 0 1 * mon",
+			from: time.Date(2024, 5, 28, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 6, 1, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "31st skips shorter months",
+			expr: "0 0 31 * *",
+			from: time.Date(2024, 4, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 5, 31, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			from: time.Date(2024, 3, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2028, 2, 29, 0, 0, 0, 0, utc),
+		},
+		{
+			name: "never matches",
+			expr: "0 0 30 2 *",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, utc),
+			want: time.Time{},
+		},
+		{
+			name: "macro",
+			expr: "@weekly",
+			from: time.Date(2024, 5, 1, 0, 0, 0, 0, utc),
+			want: time.Date(2024, 5, 5, 0, 0, 0, 0, utc),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr, utc)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			if got := cron.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	// Clocks moved forward from 02:00 to 03:00 on 10 March 2024 and back
+	// from 02:00 to 01:00 on 3 November 2024
+	edt := time.FixedZone("EDT", -4*60*60)
+	est := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{
+			name: "time in the gap is skipped",
+			expr: "30 2 * * *",
+			from: time.Date(2024, 3, 9, 12, 0, 0, 0, est),
+			want: time.Date(2024, 3, 11, 2, 30, 0, 0, edt),
+		},
+		{
+			name: "hourly runs skip the missing hour",
+			expr: "0 * * * *",
+			from: time.Date(2024, 3, 10, 1, 30, 0, 0, est),
+			want: time.Date(2024, 3, 10, 3, 0, 0, 0, edt),
+		},
+		{
+			name: "repeated time runs at its first occurrence",
+			expr: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 0, 0, 0, 0, edt),
+			want: time.Date(2024, 11, 3, 1, 30, 0, 0, edt),
+		},
+		{
+			name: "repeated time does not run twice",
+			expr: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 1, 30, 0, 0, edt),
+			want: time.Date(2024, 11, 4, 1, 30, 0, 0, est),
+		},
+		{
+			name: "hourly runs continue after the repeated hour",
+			expr: "0 * * * *",
+			from: time.Date(2024, 11, 3, 1, 0, 0, 0, edt),
+			want: time.Date(2024, 11, 3, 2, 0, 0, 0, est),
+		},
+		{
+			name: "daily runs keep the wall clock time",
+			expr: "0 9 * * *",
+			from: time.Date(2024, 3, 9, 10, 0, 0, 0, est),
+			want: time.Date(2024, 3, 10, 9, 0, 0, 0, edt),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr, newYork)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			if got := cron.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"* * * * funday",
+		"@every",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseCron(expr, time.UTC); err == nil {
+				t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+			}
+		})
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		cron     string
+		interval time.Duration
+		timezone string
+		wantErr  bool
+	}{
+		{name: "cron", cron: "0 9 * * mon-fri", timezone: "Europe/Berlin"},
+		{name: "interval", interval: time.Hour},
+		{name: "cron at the minimum interval", cron: "*/5 * * * *"},
+		{name: "interval at the minimum", interval: MinInterval},
+		{name: "close runs within one hour only", cron: "0,59 9 * * *"},
+		{name: "last and first minute of matching hours", cron: "59 8,9 * * *"},
+		{name: "cron too frequent", cron: "*/4 * * * *", wantErr: true},
+		{name: "every minute", cron: "* * * * *", wantErr: true},
+		{name: "close minutes in a list", cron: "0,3 * * * *", wantErr: true},
+		{name: "close runs across an hour", cron: "0,58 8,9 * * *", wantErr: true},
+		{name: "close runs across midnight", cron: "0,57 0,23 * * *", wantErr: true},
+		{name: "interval too short", interval: 4 * time.Minute, wantErr: true},
+		{name: "both", cron: "0 9 * * *", interval: time.Hour, wantErr: true},
+		{name: "neither", wantErr: true},
+		{name: "unknown time zone", cron: "0 9 * * *", timezone: "Mars/Olympus", wantErr: true},
+		{name: "invalid cron", cron: "0 9 * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := ParseSpec(tt.cron, tt.interval, tt.timezone)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSpec: %v", err)
+			}
+			if spec == nil {
+				t.Fatal("spec is nil")
+			}
+		})
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	spec := intervalSpec(time.Hour)
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	now := base.Add(150 * time.Minute)
+
+	// Runs missed while the server was down are skipped over
+	want := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	if got := NextRun(spec, base, now); !got.Equal(want) {
+		t.Errorf("NextRun = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,231 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"web-crawler/config"
+	"web-crawler/internal/crawler"
+	"web-crawler/internal/db"
+	"web-crawler/internal/queue"
+)
+
+const (
+	// dueBatchSize limits how many due schedules are loaded per query
+	dueBatchSize = 100
+	// minPollInterval is the lower bound of the configured poll interval
+	minPollInterval = time.Second
+)
+
+// Scheduler starts crawl tasks for schedules when they are due. Runs that
+// were missed while the server was down are handled according to each
+// schedule's missed run policy: either run once to catch up or skipped.
+type Scheduler struct {
+	scheduleRepo *db.ScheduleRepository
+	taskQueue    *queue.TaskQueue
+
+	pollInterval time.Duration
+	// missedGrace is how late a run may start before it counts as missed
+	missedGrace time.Duration
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewScheduler creates a new scheduler
+func NewScheduler(scheduleRepo *db.ScheduleRepository, taskQueue *queue.TaskQueue) *Scheduler {
+	cfg := config.Load()
+	ctx, shutdown := context.WithCancel(context.Background())
+	pollInterval := cfg.Scheduler.PollInterval
+	if pollInterval < minPollInterval {
+		pollInterval = minPollInterval
+	}
+
+	return &Scheduler{
+		scheduleRepo: scheduleRepo,
+		taskQueue:    taskQueue,
+		pollInterval: pollInterval,
+		missedGrace:  cfg.Scheduler.MissedRunGrace,
+		ctx:          ctx,
+		shutdown:     shutdown,
+	}
+}
+
+// Start launches the scheduler loop
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+	log.Printf("Scheduler started, checking schedules every %s", s.pollInterval)
+}
+
+// Shutdown stops the scheduler and waits for it to finish, or until ctx is done
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run checks for due schedules every poll interval
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDue()
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// runDue runs every schedule that is due
+func (s *Scheduler) runDue() {
+	for s.ctx.Err() == nil {
+		schedules, err := s.scheduleRepo.ListDue(s.ctx, time.Now(), dueBatchSize)
+		if err != nil {
+			if s.ctx.Err() == nil {
+				log.Printf("Failed to list due schedules: %v", err)
+			}
+			return
+		}
+
+		for _, schedule := range schedules {
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.runSchedule(schedule)
+		}
+
+		if len(schedules) < dueBatchSize {
+			return
+		}
+	}
+}
+
+// runSchedule advances a due schedule to its next run and starts its crawl,
+// unless the run was missed and the schedule skips missed runs
+func (s *Scheduler) runSchedule(schedule *db.CrawlSchedule) {
+	due := *schedule.NextRunAt
+	now := time.Now()
+
+	missed := now.Sub(due) > s.missedGrace
+	run := !missed || schedule.MissedRunPolicy != db.MissedRunSkip
+
+	spec, err := SpecOf(schedule)
+	if err != nil {
+		// Only reachable when the stored schedule was edited by hand
+		log.Printf("Schedule %d is invalid, disabling it: %v", schedule.ID, err)
+		schedule.Enabled = false
+		schedule.NextRunAt = nil
+		if err := s.scheduleRepo.Update(s.ctx, schedule); err != nil {
+			log.Printf("Failed to disable schedule %d: %v", schedule.ID, err)
+		}
+		return
+	}
+
+	// Missed runs collapse into at most one, so the next run is the first
+	// one in the future
+	base := due
+	if missed {
+		base = now
+	}
+	var next *time.Time
+	if t := NextRun(spec, base, now); !t.IsZero() {
+		next = &t
+	}
+
+	ok, err := s.scheduleRepo.Advance(s.ctx, schedule.ID, due, next, run)
+	if err != nil {
+		log.Printf("Failed to advance schedule %d: %v", schedule.ID, err)
+		return
+	}
+	if !ok {
+		// Another server ran it, or the schedule was edited since it was loaded
+		return
+	}
+
+	if !run {
+		log.Printf("Skipped missed run of schedule %d due at %s", schedule.ID, due.Format(time.RFC3339))
+		return
+	}
+
+	task, err := s.startTask(schedule)
+	if err != nil {
+		if errors.Is(err, queue.ErrQuotaExceeded) {
+			log.Printf("Skipped run of schedule %d: %v", schedule.ID, err)
+		} else {
+			log.Printf("Failed to start run of schedule %d: %v", schedule.ID, err)
+		}
+		return
+	}
+
+	if err := s.scheduleRepo.SetLastTask(s.ctx, schedule.ID, task.ID); err != nil {
+		log.Printf("Failed to record task %d of schedule %d: %v", task.ID, schedule.ID, err)
+	}
+	log.Printf("Schedule %d started task %d", schedule.ID, task.ID)
+}
+
+// startTask creates and queues the crawl task of a schedule run
+func (s *Scheduler) startTask(schedule *db.CrawlSchedule) (*db.CrawlTask, error) {
+	scheduleID := schedule.ID
+	task := &db.CrawlTask{
+		UserID:       schedule.UserID,
+		WorkspaceID:  schedule.WorkspaceID,
+		URL:          schedule.URL,
+		SeriesKey:    crawler.NormalizeURL(schedule.URL),
+		ScheduleID:   &scheduleID,
+		CrawlMode:    schedule.CrawlMode,
+		MaxDepth:     schedule.MaxDepth,
+		MaxPages:     schedule.MaxPages,
+		CrawlScope:   schedule.CrawlScope,
+		IgnoreRobots: schedule.IgnoreRobots,
+		Status:       db.TaskStatusPending,
+		Progress:     0.0,
+	}
+	if err := s.taskQueue.Enqueue(s.ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// SpecOf returns the Spec of a stored schedule
+func SpecOf(schedule *db.CrawlSchedule) (Spec, error) {
+	var cronExpr string
+	if schedule.CronExpr != nil {
+		cronExpr = *schedule.CronExpr
+	}
+	var interval time.Duration
+	if schedule.IntervalSeconds != nil {
+		interval = time.Duration(*schedule.IntervalSeconds) * time.Second
+	}
+	return ParseSpec(cronExpr, interval, schedule.Timezone)
+}
+
+// NextRun returns the first run of spec after base that is also after now,
+// or the zero time if there is none
+func NextRun(spec Spec, base, now time.Time) time.Time {
+	next := spec.Next(base)
+	for !next.IsZero() && !next.After(now) {
+		next = spec.Next(next)
+	}
+	return next
+}
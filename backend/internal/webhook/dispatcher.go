@@ -0,0 +1,408 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"web-crawler/config"
+	"web-crawler/internal/db"
+)
+
+const (
+	// dueBatchSize limits how many due deliveries are loaded per query
+	dueBatchSize = 100
+	// maxResponseBody limits how much of a response body is kept in the log
+	maxResponseBody = 2048
+	// maxErrorLength is the size of the error column
+	maxErrorLength = 1024
+	// purgeInterval is how often old deliveries are removed
+	purgeInterval = time.Hour
+	// minPollInterval is the lower bound of the configured poll interval
+	minPollInterval = time.Second
+)
+
+// Dispatcher stores the deliveries of events and sends them on a pool of
+// workers. Attempts are claimed in the database, so several servers can
+// share the work, and an attempt whose server stopped midway is made again
+// once it times out.
+type Dispatcher struct {
+	webhookRepo  *db.WebhookRepository
+	deliveryRepo *db.DeliveryRepository
+	client       *http.Client
+	userAgent    string
+	allowPrivate bool
+
+	workers      int
+	timeout      time.Duration
+	maxAttempts  int
+	retryBase    time.Duration
+	retryMax     time.Duration
+	pollInterval time.Duration
+	retention    time.Duration
+	wake         chan struct{}
+
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(webhookRepo *db.WebhookRepository, deliveryRepo *db.DeliveryRepository) *Dispatcher {
+	cfg := config.Load()
+	ctx, shutdown := context.WithCancel(context.Background())
+	workers := cfg.Webhooks.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	maxAttempts := cfg.Webhooks.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	pollInterval := cfg.Webhooks.PollInterval
+	if pollInterval < minPollInterval {
+		pollInterval = minPollInterval
+	}
+
+	return &Dispatcher{
+		webhookRepo:  webhookRepo,
+		deliveryRepo: deliveryRepo,
+		client: &http.Client{
+			Timeout:   cfg.Webhooks.Timeout,
+			Transport: newTransport(cfg.Webhooks.AllowPrivateTargets),
+			// A redirect is reported as the response, not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		userAgent:    cfg.Crawler.UserAgent + "-Webhooks",
+		allowPrivate: cfg.Webhooks.AllowPrivateTargets,
+		workers:      workers,
+		timeout:      cfg.Webhooks.Timeout,
+		maxAttempts:  maxAttempts,
+		retryBase:    cfg.Webhooks.RetryBaseDelay,
+		retryMax:     cfg.Webhooks.RetryMaxDelay,
+		pollInterval: pollInterval,
+		retention:    cfg.Webhooks.DeliveryRetention,
+		wake:         make(chan struct{}, 1),
+		ctx:          ctx,
+		shutdown:     shutdown,
+	}
+}
+
+// Start launches the delivery loop
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go d.run()
+	log.Printf("Webhook dispatcher started with %d workers", d.workers)
+}
+
+// Shutdown stops the dispatcher and waits for in-flight deliveries, or until
+// ctx is done. Interrupted attempts are made again after a restart.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify stores a delivery of event for every webhook subscribed to it of the
+// user who created task and wakes the workers. Users who left the workspace
+// of the task are no longer notified. Failures are logged, so callers are
+// never held up by webhooks.
+func (d *Dispatcher) Notify(ctx context.Context, task *db.CrawlTask, event string, data interface{}) {
+	webhooks, err := d.webhookRepo.ListSubscribed(ctx, task.UserID, task.WorkspaceID, event)
+	if err != nil {
+		log.Printf("Failed to list webhooks of user %d: %v", task.UserID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(Payload{Event: event, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		log.Printf("Failed to marshal %s webhook payload: %v", event, err)
+		return
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		delivery := &db.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       payload,
+			Status:        db.DeliveryStatusPending,
+			NextAttemptAt: &now,
+		}
+		if err := d.deliveryRepo.Create(ctx, delivery); err != nil {
+			log.Printf("Failed to store %s delivery for webhook %d: %v", event, webhook.ID, err)
+		}
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// SendTest sends a ping event to a webhook right away and returns the
+// recorded delivery. Test deliveries are attempted once and never retried.
+func (d *Dispatcher) SendTest(ctx context.Context, webhook *db.Webhook) (*db.WebhookDelivery, error) {
+	payload, err := json.Marshal(Payload{
+		Event:     EventPing,
+		CreatedAt: time.Now(),
+		Data:      map[string]interface{}{"webhook_id": webhook.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a next attempt the workers never pick it up
+	delivery := &db.WebhookDelivery{
+		WebhookID: webhook.ID,
+		Event:     EventPing,
+		Payload:   payload,
+		Status:    db.DeliveryStatusPending,
+	}
+	if err := d.deliveryRepo.Create(ctx, delivery); err != nil {
+		return nil, err
+	}
+	if _, err := d.deliveryRepo.Claim(ctx, delivery, time.Now().Add(d.timeout)); err != nil {
+		return nil, err
+	}
+
+	d.attempt(ctx, webhook, delivery, true)
+	return delivery, nil
+}
+
+// run sends due deliveries every poll interval, or as soon as new ones are
+// stored, and purges old ones
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, d.workers)
+	var lastPurge time.Time
+
+	for {
+		d.sendDue(sem)
+
+		if d.retention > 0 && time.Since(lastPurge) >= purgeInterval {
+			lastPurge = time.Now()
+			d.purge()
+		}
+
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDue claims due deliveries and sends them, at most sem's capacity at once
+func (d *Dispatcher) sendDue(sem chan struct{}) {
+	for d.ctx.Err() == nil {
+		deliveries, err := d.deliveryRepo.ListDue(d.ctx, time.Now(), dueBatchSize)
+		if err != nil {
+			if d.ctx.Err() == nil {
+				log.Printf("Failed to list due webhook deliveries: %v", err)
+			}
+			return
+		}
+
+		for _, delivery := range deliveries {
+			ok, err := d.deliveryRepo.Claim(d.ctx, delivery, time.Now().Add(d.timeout+d.pollInterval))
+			if err != nil {
+				if d.ctx.Err() == nil {
+					log.Printf("Failed to claim webhook delivery %d: %v", delivery.ID, err)
+				}
+				return
+			}
+			if !ok {
+				// Another server claimed it first
+				continue
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-d.ctx.Done():
+				return
+			}
+			d.wg.Add(1)
+			go func(delivery *db.WebhookDelivery) {
+				defer d.wg.Done()
+				defer func() { <-sem }()
+				d.deliver(delivery)
+			}(delivery)
+		}
+
+		if len(deliveries) < dueBatchSize {
+			return
+		}
+	}
+}
+
+// deliver makes the claimed attempt of a delivery
+func (d *Dispatcher) deliver(delivery *db.WebhookDelivery) {
+	webhook, err := d.webhookRepo.GetByID(d.ctx, delivery.WebhookID)
+	if err != nil {
+		if d.ctx.Err() == nil {
+			log.Printf("Failed to load webhook %d: %v", delivery.WebhookID, err)
+		}
+		return
+	}
+	if webhook == nil {
+		// Deleted, which also deleted the delivery
+		return
+	}
+	if !webhook.Enabled {
+		d.finish(d.ctx, delivery, db.DeliveryStatusFailed, "Webhook is disabled")
+		return
+	}
+
+	d.attempt(d.ctx, webhook, delivery, false)
+}
+
+// attempt sends a delivery and records the outcome. A failed attempt is
+// retried later unless final is set or the delivery ran out of attempts.
+func (d *Dispatcher) attempt(ctx context.Context, webhook *db.Webhook, delivery *db.WebhookDelivery, final bool) {
+	start := time.Now()
+	status, body, err := d.send(ctx, webhook, delivery)
+	if err != nil && ctx.Err() != nil && !final {
+		// Shutting down: the attempt times out and is made again after a restart
+		return
+	}
+
+	delivery.DurationMs = int(time.Since(start).Milliseconds())
+	delivery.ResponseStatus = nil
+	delivery.ResponseBody = nil
+	if status != 0 {
+		delivery.ResponseStatus = &status
+		delivery.ResponseBody = &body
+	}
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		now := time.Now()
+		delivery.DeliveredAt = &now
+		d.finish(ctx, delivery, db.DeliveryStatusSucceeded, "")
+	case final || delivery.Attempts >= d.maxAttempts:
+		d.finish(ctx, delivery, db.DeliveryStatusFailed, failureMessage(status, err))
+	default:
+		next := time.Now().Add(d.backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		d.finish(ctx, delivery, db.DeliveryStatusPending, failureMessage(status, err))
+	}
+}
+
+// send posts a delivery to its webhook and returns the response status and
+// the start of the response body
+func (d *Dispatcher) send(ctx context.Context, webhook *db.Webhook, delivery *db.WebhookDelivery) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", d.userAgent)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(bytes.ToValidUTF8(body, nil)), nil
+}
+
+// finish records the outcome of an attempt
+func (d *Dispatcher) finish(ctx context.Context, delivery *db.WebhookDelivery, status, errorMsg string) {
+	delivery.Status = status
+	if status != db.DeliveryStatusPending {
+		delivery.NextAttemptAt = nil
+	}
+	delivery.Error = nil
+	if errorMsg != "" {
+		if len(errorMsg) > maxErrorLength {
+			errorMsg = errorMsg[:maxErrorLength]
+		}
+		delivery.Error = &errorMsg
+	}
+
+	// Record the outcome even if ctx was cancelled during the attempt
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := d.deliveryRepo.Finish(writeCtx, delivery); err != nil {
+		log.Printf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// backoff returns the delay before the attempt after the given one: the base
+// delay doubled with every attempt, up to the maximum delay
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.retryBase
+	for i := 1; i < attempts && delay < d.retryMax; i++ {
+		delay *= 2
+	}
+	if delay > d.retryMax {
+		delay = d.retryMax
+	}
+	return delay
+}
+
+// purge removes finished deliveries older than the retention period
+func (d *Dispatcher) purge() {
+	removed, err := d.deliveryRepo.DeleteBefore(d.ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		if d.ctx.Err() == nil {
+			log.Printf("Failed to purge webhook deliveries: %v", err)
+		}
+		return
+	}
+	if removed > 0 {
+		log.Printf("Purged %d old webhook deliveries", removed)
+	}
+}
+
+// failureMessage describes why an attempt failed
+func failureMessage(status int, err error) string {
+	if err != nil {
+		var urlErr interface{ Timeout() bool }
+		if errors.As(err, &urlErr) && urlErr.Timeout() {
+			return "Request timed out"
+		}
+		return err.Error()
+	}
+	return fmt.Sprintf("Unexpected response status %d", status)
+}
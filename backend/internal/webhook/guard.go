@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned when a webhook URL points to a loopback,
+// private or link-local address, which could reach services that are not
+// meant to be exposed
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// forbiddenPrefixes are the special purpose ranges not covered by the net.IP
+// classification methods that can still lead to internal services
+var forbiddenPrefixes = []netip.Prefix{
+	// "This network", which some systems route to the local host
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Shared address space of carrier-grade NAT
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// Benchmarking networks, often used inside data centers
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64, which embeds any IPv4 address
+	netip.MustParsePrefix("64:ff9b::/96"),
+	// 6to4, which embeds any IPv4 address
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// forbiddenIP reports whether webhooks may not be sent to ip
+func forbiddenIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return true
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL rejects webhook URLs whose host is a forbidden address or a name
+// of the local host. Other host names are checked when connecting.
+func (d *Dispatcher) CheckURL(rawURL string) error {
+	if d.allowPrivate {
+		return nil
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenTarget
+	}
+	if ip := net.ParseIP(host); ip != nil && forbiddenIP(ip) {
+		return ErrForbiddenTarget
+	}
+	return nil
+}
+
+// dialControl refuses connections to forbidden addresses. It runs on the
+// resolved address of every connection, so a host name that resolves to an
+// internal address, even only after it was checked, cannot be reached.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+	}
+	return nil
+}
+
+// newTransport creates the transport of webhook requests. Unless private
+// targets are allowed, connections to forbidden addresses are refused and no
+// proxy is used, since it would make the connection on the dispatcher's behalf.
+func newTransport(allowPrivate bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if allowPrivate {
+		return transport
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
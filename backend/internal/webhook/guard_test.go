@@ -0,0 +1,143 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestForbiddenIP(t *testing.T) {
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fc00::1", true},
+		{"224.0.0.1", true},
+		{"ff02::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"198.18.0.1", true},
+		{"198.19.255.254", true},
+		{"64:ff9b::7f00:1", true},
+		{"2002:7f00:1::", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:100.64.0.1", true},
+		{"93.184.216.34", false},
+		{"100.128.0.1", false},
+		{"198.20.0.1", false},
+		{"2606:4700::1111", false},
+		{"::ffff:93.184.216.34", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := forbiddenIP(net.ParseIP(tt.ip)); got != tt.forbidden {
+				t.Errorf("forbiddenIP(%s) = %v, want %v", tt.ip, got, tt.forbidden)
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:4700::1111]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"100.64.0.1:443", false},
+		{"[64:ff9b::a00:1]:443", false},
+		{"example.com:443", false},
+		{"93.184.216.34", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := dialControl("tcp", tt.address, nil)
+			if tt.allowed && err != nil {
+				t.Errorf("dialControl(%q) = %v, want no error", tt.address, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Errorf("dialControl(%q) succeeded, want an error", tt.address)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url          string
+		allowPrivate bool
+		forbidden    bool
+	}{
+		{"https://example.com/hook", false, false},
+		{"https://93.184.216.34/hook", false, false},
+		{"http://localhost:8080/hook", false, true},
+		{"http://LOCALHOST./hook", false, true},
+		{"http://api.localhost/hook", false, true},
+		{"http://127.0.0.1/hook", false, true},
+		{"http://[::1]/hook", false, true},
+		{"http://169.254.169.254/latest/meta-data", false, true},
+		{"http://100.64.0.1/hook", false, true},
+		{"http://[2002:a00:1::]/hook", false, true},
+		{"http://localhost:8080/hook", true, false},
+		{"http://10.0.0.1/hook", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			d := &Dispatcher{allowPrivate: tt.allowPrivate}
+			err := d.CheckURL(tt.url)
+			if got := errors.Is(err, ErrForbiddenTarget); got != tt.forbidden {
+				t.Errorf("CheckURL(%q) = %v, want forbidden %v", tt.url, err, tt.forbidden)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{
+			name:      "known vector",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			body:      `{"event":"task.completed"}`,
+			want:      "sha256=72d60e3c2ab752b968d31a79e53de5d105671d4180995b39eaca9508bececd25",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The timestamp and the secret are part of the signature
+	base := Sign("whsec_test", 1700000000, []byte("{}"))
+	if Sign("whsec_test", 1700000001, []byte("{}")) == base {
+		t.Error("signature does not depend on the timestamp")
+	}
+	if Sign("whsec_other", 1700000000, []byte("{}")) == base {
+		t.Error("signature does not depend on the secret")
+	}
+}
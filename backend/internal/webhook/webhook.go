@@ -0,0 +1,103 @@
+// Package webhook sends task lifecycle events to the URLs users subscribed
+// with. Deliveries are stored before they are sent, so they double as the
+// delivery log and are retried with exponential backoff until they succeed
+// or run out of attempts.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"time"
+	"web-crawler/internal/db"
+)
+
+// Events users can subscribe to
+const (
+	EventTaskStarted   = "task.started"
+	EventTaskCompleted = "task.completed"
+	EventTaskFailed    = "task.failed"
+	EventTaskStopped   = "task.stopped"
+	// EventBrokenLinks is sent along with task.completed when the crawl found
+	// inaccessible links
+	EventBrokenLinks = "task.broken_links"
+)
+
+// EventPing is the event sent by a test delivery. It cannot be subscribed to.
+const EventPing = "ping"
+
+// events lists the events users can subscribe to
+var events = []string{EventTaskStarted, EventTaskCompleted, EventTaskFailed, EventTaskStopped, EventBrokenLinks}
+
+// Events returns the events users can subscribe to
+func Events() []string {
+	return slices.Clone(events)
+}
+
+// IsEvent reports whether users can subscribe to event
+func IsEvent(event string) bool {
+	return slices.Contains(events, event)
+}
+
+// Request headers of a delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// TaskEvent is the data of a task lifecycle event
+type TaskEvent struct {
+	TaskID     int    `json:"task_id"`
+	URL        string `json:"url"`
+	Status     string `json:"status"`
+	CrawlMode  string `json:"crawl_mode"`
+	ScheduleID *int   `json:"schedule_id,omitempty"`
+	// Pages and BrokenLinks are set when the crawl finished
+	Pages       *int            `json:"pages,omitempty"`
+	BrokenLinks *int            `json:"broken_links,omitempty"`
+	Results     *db.CrawlResult `json:"results,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// NewTaskEvent creates the data of an event about a task that reached status
+func NewTaskEvent(task *db.CrawlTask, status string) *TaskEvent {
+	return &TaskEvent{
+		TaskID:     task.ID,
+		URL:        task.URL,
+		Status:     status,
+		CrawlMode:  task.CrawlMode,
+		ScheduleID: task.ScheduleID,
+	}
+}
+
+// Sign returns the signature of a delivery body sent at timestamp: the hex
+// encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+// Receivers should compute it themselves and compare it in constant time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"web-crawler/internal/auth"
+
+	"github.com/gorilla/websocket"
+)
+
+// bearerProtocol is the subprotocol name that precedes the token when the
+// token is sent as a subprotocol, e.g. new WebSocket(url, ["bearer", token])
+const bearerProtocol = "bearer"
+
+// authTimeout is how long a client may take to send its auth message
+const authTimeout = 10 * time.Second
+
+// errMissingToken means the client sent no token with the handshake
+var errMissingToken = errors.New("missing token")
+
+// authMessage is the first message a client sends when it did not pass a
+// token with the handshake
+type authMessage struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+// handshakeToken extracts a token from the "token" query parameter or from
+// the Sec-WebSocket-Protocol header. It also reports whether the token came
+// from a subprotocol, which must then be echoed back to the client.
+func handshakeToken(r *http.Request) (string, bool) {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, false
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if strings.EqualFold(protocol, bearerProtocol) && i+1 < len(protocols) {
+			return protocols[i+1], true
+		}
+	}
+
+	return "", false
+}
+
+// readAuthMessage waits for the client's first message and validates the
+// token it carries
+func readAuthMessage(ctx context.Context, conn *websocket.Conn, jwtService *auth.JWTService) (*auth.Claims, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg authMessage
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "auth" || msg.Token == "" {
+		return nil, errMissingToken
+	}
+
+	return jwtService.ValidateToken(ctx, msg.Token)
+}
+
+// rejectConnection closes an upgraded connection that failed authentication
+func rejectConnection(conn *websocket.Conn, reason string) {
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	conn.Close()
+}
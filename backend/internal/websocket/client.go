@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"web-crawler/internal/auth"
+	"web-crawler/internal/events"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is the time allowed to write a message to the client
+	writeWait = 10 * time.Second
+	// pongWait is the time allowed to read the next pong from the client
+	pongWait = 60 * time.Second
+	// pingPeriod sends pings to the client, must be less than pongWait
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize is the largest message accepted from the client
+	maxMessageSize = 4096
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		// Allow all origins for development (restrict in production)
+		return true
+	},
+}
+
+// Client represents a websocket client connection, which receives the events
+// of its user from the event bus
+type Client struct {
+	bus  *events.Bus
+	conn *websocket.Conn
+	sub  *events.Subscriber
+}
+
+// clientMessage is a message sent by the client, e.g.
+// {"type":"subscribe","task_id":42} or {"type":"resume","last_event_id":17}
+type clientMessage struct {
+	Type        string `json:"type"`
+	TaskID      int    `json:"task_id"`
+	LastEventID *int64 `json:"last_event_id"`
+}
+
+// ServeWS handles websocket requests from clients. The client must present
+// the same JWT used for the REST API, either as a "token" query parameter, as
+// the subprotocol following "bearer", or in a first {"type":"auth"} message.
+// A reconnecting client passes the last event ID it saw as the
+// "last_event_id" query parameter to receive the events it missed before any
+// new ones.
+func ServeWS(bus *events.Bus, jwtService *auth.JWTService, w http.ResponseWriter, r *http.Request) {
+	token, fromProtocol := handshakeToken(r)
+
+	// Reject bad handshake tokens before upgrading the connection
+	var claims *auth.Claims
+	if token != "" {
+		var err error
+		claims, err = jwtService.ValidateToken(r.Context(), token)
+		if err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var responseHeader http.Header
+	if fromProtocol {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": []string{bearerProtocol}}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+
+	// Without a handshake token the first message must authenticate
+	if claims == nil {
+		claims, err = readAuthMessage(r.Context(), conn, jwtService)
+		if err != nil {
+			rejectConnection(conn, "authentication required")
+			return
+		}
+	}
+
+	opts := events.SubscribeOptions{}
+	if lastEventID, err := strconv.ParseInt(r.URL.Query().Get("last_event_id"), 10, 64); err == nil && lastEventID >= 0 {
+		opts.Resume = true
+		opts.LastEventID = lastEventID
+	}
+
+	client := &Client{
+		bus:  bus,
+		conn: conn,
+		sub:  bus.Subscribe(claims.UserID, opts),
+	}
+	log.Printf("Client connected: %d", claims.UserID)
+
+	// Start goroutines for reading and writing
+	go client.writePump()
+	go client.readPump()
+}
+
+// readPump handles messages from the websocket connection
+func (c *Client) readPump() {
+	defer func() {
+		c.bus.Unsubscribe(c.sub)
+		c.conn.Close()
+		log.Printf("Client disconnected: %d", c.sub.UserID)
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "subscribe":
+			if msg.TaskID > 0 {
+				c.bus.Follow(c.sub, msg.TaskID)
+			}
+		case "unsubscribe":
+			if msg.TaskID > 0 {
+				c.bus.Unfollow(c.sub, msg.TaskID)
+			}
+		case "resume":
+			if msg.LastEventID != nil && *msg.LastEventID >= 0 {
+				c.bus.Resume(c.sub, *msg.LastEventID)
+			}
+		}
+	}
+}
+
+// writePump pumps events from the bus to the websocket connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-c.sub.Events():
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The bus dropped the subscriber
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := c.conn.WriteMessage(websocket.TextMessage, event.Data); err != nil {
+				log.Println("WebSocket write error:", err)
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
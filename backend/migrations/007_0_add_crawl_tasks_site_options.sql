@@ -0,0 +1,6 @@
+-- Add site crawl options to crawl_tasks
+ALTER TABLE crawl_tasks
+    ADD COLUMN crawl_mode ENUM('page', 'site') NOT NULL DEFAULT 'page' AFTER url,
+    ADD COLUMN max_depth INT NOT NULL DEFAULT 0 AFTER crawl_mode,
+    ADD COLUMN max_pages INT NOT NULL DEFAULT 1 AFTER max_depth,
+    ADD COLUMN crawl_scope ENUM('host', 'subdomain') NOT NULL DEFAULT 'host' AFTER max_pages;
@@ -0,0 +1,4 @@
+-- Track which page of a site crawl each crawl_results row belongs to
+ALTER TABLE crawl_results
+    ADD COLUMN page_url VARCHAR(2048) NULL AFTER task_id,
+    ADD COLUMN depth INT NOT NULL DEFAULT 0 AFTER page_url;
@@ -0,0 +1,3 @@
+-- Track the page each link was found on during a site crawl
+ALTER TABLE crawl_links
+    ADD COLUMN page_url VARCHAR(2048) NULL AFTER task_id;
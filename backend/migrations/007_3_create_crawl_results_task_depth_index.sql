@@ -0,0 +1,2 @@
+-- Create task_id/depth index for crawl_results
+CREATE INDEX idx_crawl_results_task_depth ON crawl_results(task_id, depth);
@@ -0,0 +1,3 @@
+-- Allow admins to bypass robots.txt for a single crawl task
+ALTER TABLE crawl_tasks
+    ADD COLUMN ignore_robots BOOLEAN NOT NULL DEFAULT FALSE AFTER crawl_scope;
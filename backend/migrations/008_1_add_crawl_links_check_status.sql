@@ -0,0 +1,3 @@
+-- Record whether a link was checked, skipped or disallowed by robots.txt
+ALTER TABLE crawl_links
+    ADD COLUMN check_status ENUM('checked', 'skipped', 'disallowed') NOT NULL DEFAULT 'checked' AFTER is_accessible;
@@ -0,0 +1,5 @@
+-- Add lease columns so queue workers can claim tasks and recover abandoned ones
+ALTER TABLE crawl_tasks
+    ADD COLUMN lease_owner VARCHAR(128) NULL AFTER error_message,
+    ADD COLUMN lease_expires_at TIMESTAMP NULL AFTER lease_owner,
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0 AFTER lease_expires_at;
@@ -0,0 +1,2 @@
+-- Create status/lease index for claiming crawl_tasks
+CREATE INDEX idx_crawl_tasks_status_lease ON crawl_tasks(status, lease_expires_at);
@@ -0,0 +1,11 @@
+-- Create user_events table so real-time updates can be replayed after a restart
+CREATE TABLE user_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    event_id BIGINT NOT NULL,
+    task_id INT NULL,
+    payload MEDIUMTEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Event IDs are unique per user and replayed in order
+CREATE UNIQUE INDEX idx_user_events_user_event ON user_events(user_id, event_id);
@@ -0,0 +1,2 @@
+-- Speed up purging of expired events
+CREATE INDEX idx_user_events_created_at ON user_events(created_at);
@@ -0,0 +1,2 @@
+-- Add deleted_at so deleted tasks can be restored until they are purged
+ALTER TABLE crawl_tasks ADD COLUMN deleted_at TIMESTAMP NULL AFTER completed_at;
@@ -0,0 +1,2 @@
+-- Create deleted_at index for crawl_tasks to find tasks due for purging
+CREATE INDEX idx_crawl_tasks_deleted_at ON crawl_tasks(deleted_at);
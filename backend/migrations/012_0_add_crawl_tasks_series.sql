@@ -0,0 +1,5 @@
+-- Link re-runs of a URL into a series keyed by the normalized URL
+ALTER TABLE crawl_tasks
+    ADD COLUMN series_key VARCHAR(2048) NOT NULL DEFAULT '' AFTER url,
+    ADD COLUMN parent_task_id INT NULL AFTER series_key,
+    ADD CONSTRAINT fk_crawl_tasks_parent FOREIGN KEY (parent_task_id) REFERENCES crawl_tasks(id) ON DELETE SET NULL;
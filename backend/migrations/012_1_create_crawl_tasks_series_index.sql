@@ -0,0 +1,2 @@
+-- Create series index for crawl_tasks to list the runs of a URL
+CREATE INDEX idx_crawl_tasks_user_series ON crawl_tasks(user_id, series_key(255), created_at);
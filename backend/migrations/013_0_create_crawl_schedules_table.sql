@@ -0,0 +1,25 @@
+-- Create crawl_schedules table for crawls that run on a cron expression or interval
+CREATE TABLE crawl_schedules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    url VARCHAR(2048) NOT NULL,
+    crawl_mode ENUM('page', 'site') NOT NULL DEFAULT 'page',
+    max_depth INT NOT NULL DEFAULT 0,
+    max_pages INT NOT NULL DEFAULT 1,
+    crawl_scope ENUM('host', 'subdomain') NOT NULL DEFAULT 'host',
+    ignore_robots BOOLEAN NOT NULL DEFAULT FALSE,
+    cron_expr VARCHAR(255) NULL,
+    interval_seconds INT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    missed_run_policy ENUM('run_once', 'skip') NOT NULL DEFAULT 'run_once',
+    next_run_at TIMESTAMP NULL,
+    last_run_at TIMESTAMP NULL,
+    last_task_id INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (last_task_id) REFERENCES crawl_tasks(id) ON DELETE SET NULL
+);
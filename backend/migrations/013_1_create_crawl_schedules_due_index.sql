@@ -0,0 +1,2 @@
+-- Create due index for crawl_schedules so the scheduler finds due schedules quickly
+CREATE INDEX idx_crawl_schedules_enabled_next_run ON crawl_schedules(enabled, next_run_at);
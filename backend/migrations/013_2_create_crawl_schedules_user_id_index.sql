@@ -0,0 +1,2 @@
+-- Create user_id index for crawl_schedules
+CREATE INDEX idx_crawl_schedules_user_id ON crawl_schedules(user_id);
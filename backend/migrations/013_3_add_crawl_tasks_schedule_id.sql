@@ -0,0 +1,4 @@
+-- Remember which schedule started a crawl task
+ALTER TABLE crawl_tasks
+    ADD COLUMN schedule_id INT NULL AFTER parent_task_id,
+    ADD CONSTRAINT fk_crawl_tasks_schedule FOREIGN KEY (schedule_id) REFERENCES crawl_schedules(id) ON DELETE SET NULL;
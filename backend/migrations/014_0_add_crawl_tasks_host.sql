@@ -0,0 +1,3 @@
+-- Store the host of each crawl task so the task list can be filtered by domain
+ALTER TABLE crawl_tasks
+    ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT '' AFTER url;
@@ -0,0 +1,16 @@
+-- Fill in the host of existing crawl tasks from their URL
+UPDATE crawl_tasks
+SET host = LOWER(
+    SUBSTRING_INDEX(
+        SUBSTRING_INDEX(
+            SUBSTRING_INDEX(
+                SUBSTRING_INDEX(
+                    SUBSTRING_INDEX(
+                        SUBSTRING_INDEX(url, '://', -1),
+                    '/', 1),
+                '?', 1),
+            '#', 1),
+        '@', -1),
+    ':', 1)
+)
+WHERE host = '';
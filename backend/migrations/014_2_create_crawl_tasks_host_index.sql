@@ -0,0 +1,2 @@
+-- Create host index for crawl_tasks to filter the task list by domain
+CREATE INDEX idx_crawl_tasks_user_host ON crawl_tasks(user_id, host);
@@ -0,0 +1,3 @@
+-- Store the host of each link so the links of a task can be filtered by host
+ALTER TABLE crawl_links
+    ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT '' AFTER url;
@@ -0,0 +1,16 @@
+-- Fill in the host of existing links from their URL
+UPDATE crawl_links
+SET host = LOWER(
+    SUBSTRING_INDEX(
+        SUBSTRING_INDEX(
+            SUBSTRING_INDEX(
+                SUBSTRING_INDEX(
+                    SUBSTRING_INDEX(
+                        SUBSTRING_INDEX(url, '://', -1),
+                    '/', 1),
+                '?', 1),
+            '#', 1),
+        '@', -1),
+    ':', 1)
+)
+WHERE host = '' AND url LIKE '%://%';
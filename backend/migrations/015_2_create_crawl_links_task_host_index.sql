@@ -0,0 +1,2 @@
+-- Create task and host index for crawl_links to filter the links of a task by host
+CREATE INDEX idx_crawl_links_task_host ON crawl_links(task_id, host);
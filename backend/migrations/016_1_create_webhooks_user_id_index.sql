@@ -0,0 +1,2 @@
+-- Speed up listing the webhooks of a user
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
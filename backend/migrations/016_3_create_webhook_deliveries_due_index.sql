@@ -0,0 +1,2 @@
+-- Speed up finding deliveries waiting for their next attempt
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
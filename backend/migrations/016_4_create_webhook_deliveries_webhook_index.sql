@@ -0,0 +1,2 @@
+-- Speed up listing the delivery log of a webhook
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
@@ -0,0 +1,2 @@
+-- Speed up purging of old deliveries
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries(created_at);
@@ -0,0 +1,2 @@
+-- Tokens are looked up by their hash on every request
+CREATE UNIQUE INDEX idx_api_tokens_token_hash ON api_tokens(token_hash);
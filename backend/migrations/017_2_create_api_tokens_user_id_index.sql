@@ -0,0 +1,2 @@
+-- Speed up listing the tokens of a user
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
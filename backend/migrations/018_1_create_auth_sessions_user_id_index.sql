@@ -0,0 +1,2 @@
+-- Speed up revoking and purging the sessions of a user
+CREATE INDEX idx_auth_sessions_user_id ON auth_sessions(user_id);
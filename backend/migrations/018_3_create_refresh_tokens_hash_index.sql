@@ -0,0 +1,2 @@
+-- Refresh tokens are looked up by their hash
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens(token_hash);
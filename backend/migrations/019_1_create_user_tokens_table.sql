@@ -0,0 +1,15 @@
+-- Create user_tokens table for the single-use tokens sent by email to reset a
+-- password or verify an email address. Only a SHA-256 hash of each token is
+-- stored, along with the address it was sent to.
+CREATE TABLE user_tokens (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose ENUM('password_reset', 'email_verification') NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Tokens are looked up by their hash
+CREATE UNIQUE INDEX idx_user_tokens_token_hash ON user_tokens(token_hash);
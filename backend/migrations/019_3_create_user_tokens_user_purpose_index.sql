@@ -0,0 +1,2 @@
+-- Create index for finding the latest tokens of a user
+CREATE INDEX idx_user_tokens_user_purpose ON user_tokens(user_id, purpose, created_at);
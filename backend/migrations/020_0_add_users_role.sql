@@ -0,0 +1,4 @@
+-- Give every user a role and allow admins to disable accounts
+ALTER TABLE users
+    ADD COLUMN role ENUM('admin', 'member', 'read_only') NOT NULL DEFAULT 'member' AFTER email_verified_at,
+    ADD COLUMN disabled_at TIMESTAMP NULL AFTER role;
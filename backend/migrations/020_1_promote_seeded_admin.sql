@@ -0,0 +1,2 @@
+-- Make the seeded admin account an admin
+UPDATE users SET role = 'admin' WHERE username = 'admin';
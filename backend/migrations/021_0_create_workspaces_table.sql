@@ -0,0 +1,12 @@
+-- Create workspaces table. Crawl tasks and schedules belong to a workspace
+-- and are shared by its members. Every user has a personal workspace, marked
+-- by personal_user_id, that only they are a member of.
+CREATE TABLE workspaces (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    personal_user_id INT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (personal_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,12 @@
+-- Create workspace_members table. Owners manage the workspace and its
+-- members, editors crawl and viewers only look at the results.
+CREATE TABLE workspace_members (
+    workspace_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role ENUM('owner', 'editor', 'viewer') NOT NULL DEFAULT 'editor',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (workspace_id, user_id),
+    FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
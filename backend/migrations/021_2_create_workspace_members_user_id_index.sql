@@ -0,0 +1,2 @@
+-- Create index for finding the workspaces of a user
+CREATE INDEX idx_workspace_members_user_id ON workspace_members(user_id);
@@ -0,0 +1,3 @@
+-- Give every existing user a personal workspace
+INSERT INTO workspaces (name, personal_user_id)
+SELECT CONCAT(username, '''s workspace'), id FROM users;
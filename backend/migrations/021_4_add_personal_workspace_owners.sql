@@ -0,0 +1,3 @@
+-- Make every user the owner of their personal workspace
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, personal_user_id, 'owner' FROM workspaces WHERE personal_user_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Make crawl tasks belong to a workspace. user_id remains the user who
+-- started the task.
+ALTER TABLE crawl_tasks
+    ADD COLUMN workspace_id INT NULL AFTER user_id,
+    ADD CONSTRAINT fk_crawl_tasks_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE;
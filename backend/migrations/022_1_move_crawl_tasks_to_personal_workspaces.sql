@@ -0,0 +1,4 @@
+-- Move existing crawl tasks to the personal workspace of their user
+UPDATE crawl_tasks t
+JOIN workspaces w ON w.personal_user_id = t.user_id
+SET t.workspace_id = w.id;
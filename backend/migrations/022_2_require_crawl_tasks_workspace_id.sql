@@ -0,0 +1,2 @@
+-- Every crawl task belongs to a workspace from now on
+ALTER TABLE crawl_tasks MODIFY workspace_id INT NOT NULL;
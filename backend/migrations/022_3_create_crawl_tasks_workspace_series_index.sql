@@ -0,0 +1,2 @@
+-- Create series index for crawl_tasks to list the runs of a URL in a workspace
+CREATE INDEX idx_crawl_tasks_workspace_series ON crawl_tasks(workspace_id, series_key(255), created_at);
@@ -0,0 +1,5 @@
+-- Make crawl schedules belong to a workspace. user_id remains the user who
+-- created the schedule.
+ALTER TABLE crawl_schedules
+    ADD COLUMN workspace_id INT NULL AFTER user_id,
+    ADD CONSTRAINT fk_crawl_schedules_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE;
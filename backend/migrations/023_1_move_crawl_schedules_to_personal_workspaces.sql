@@ -0,0 +1,4 @@
+-- Move existing crawl schedules to the personal workspace of their user
+UPDATE crawl_schedules s
+JOIN workspaces w ON w.personal_user_id = s.user_id
+SET s.workspace_id = w.id;
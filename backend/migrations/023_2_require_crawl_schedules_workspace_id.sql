@@ -0,0 +1,2 @@
+-- Every crawl schedule belongs to a workspace from now on
+ALTER TABLE crawl_schedules MODIFY workspace_id INT NOT NULL;
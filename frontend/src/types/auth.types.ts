@@ -12,6 +12,8 @@ export interface UserInfo {
   id: number;
   username: string;
   email: string;
+  email_verified?: boolean;
+  role?: 'admin' | 'member' | 'read_only';
 }
 
 export interface LoginRequest {
@@ -3,6 +3,7 @@
 export interface CrawlTask {
   id: number;
   user_id: number;
+  workspace_id: number;
   url: string;
   status: TaskStatus;
   progress: number;
@@ -54,6 +55,7 @@ export type LinkType = 'internal' | 'external';
 export interface TaskStatusResponse {
   id: number;
   user_id: number;
+  workspace_id: number;
   url: string;
   status: TaskStatus;
   progress: number;
@@ -67,6 +69,28 @@ export interface TaskStatusResponse {
 
 export interface StartCrawlRequest {
   url: string;
+  workspace_id?: number;
+}
+
+export type WorkspaceRole = 'owner' | 'editor' | 'viewer';
+
+export interface Workspace {
+  id: number;
+  name: string;
+  personal_user_id?: number;
+  created_at: string;
+  updated_at: string;
+  role?: WorkspaceRole;
+  member_count?: number;
+}
+
+export interface WorkspaceMember {
+  workspace_id: number;
+  user_id: number;
+  username: string;
+  email: string;
+  role: WorkspaceRole;
+  created_at: string;
 }
 
 export interface CrawlTaskRequest {